@@ -0,0 +1,16 @@
+package main
+
+// keySchemas is the registry of every key families of this lesson
+var keySchemas = NewKeyRegistry()
+
+var (
+	// KeyAutonumber is the running number of cacher.Autonumber
+	KeyAutonumber = keySchemas.Register(&KeyFamily{
+		Name:             "autonumber",
+		Pattern:          "autonumber_{name}",
+		ValueType:        KeyValueCounter,
+		DefaultTTL:       0,
+		EvictionCritical: true,
+		Version:          1,
+	})
+)
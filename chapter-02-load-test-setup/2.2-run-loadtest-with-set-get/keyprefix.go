@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+// keyPrefixHook add KeyPrefix of config to the keys of every commands, so cacher use the keys without prefix
+// and the services that share redis DB do not see (or delete) the keys of each others.
+// The command that is not in commandKeySpecs fail with error instead of being sent with unprefixed keys.
+// SUBSCRIBE is not sent through hooks, so the channels of Sub are prefixed by cacher itself
+type keyPrefixHook struct {
+	prefix string
+}
+
+// commandKeySpec is the position of keys in the arguments of command (like key specs of COMMAND INFO),
+// args[0] is the command name, first is 0 if the command has no key,
+// last is negative to count from the end (-1 is the last argument), step is 2 for key value pairs
+type commandKeySpec struct {
+	first int
+	last  int
+	step  int
+}
+
+var (
+	noKeys       = commandKeySpec{0, 0, 0}
+	firstKey     = commandKeySpec{1, 1, 1}
+	everyKeys    = commandKeySpec{1, -1, 1}
+	keyValueKeys = commandKeySpec{1, -1, 2}
+	twoKeys      = commandKeySpec{1, 2, 1}
+)
+
+// commandKeySpecs are the commands that cacher can send with KeyPrefix,
+// EVAL, EVALSHA, KEYS and SCAN are handled by prefixArgs because their keys are not at fixed positions
+var commandKeySpecs = map[string]commandKeySpec{
+	// Connection, server and transaction
+	"ping":     noKeys,
+	"echo":     noKeys,
+	"auth":     noKeys,
+	"select":   noKeys,
+	"hello":    noKeys,
+	"info":     noKeys,
+	"config":   noKeys,
+	"command":  noKeys,
+	"script":   noKeys,
+	"client":   noKeys,
+	"cluster":  noKeys,
+	"readonly": noKeys,
+	"time":     noKeys,
+	"dbsize":   noKeys,
+	"multi":    noKeys,
+	"exec":     noKeys,
+	"discard":  noKeys,
+	"unwatch":  noKeys,
+
+	// Generic
+	"del":       everyKeys,
+	"unlink":    everyKeys,
+	"exists":    everyKeys,
+	"touch":     everyKeys,
+	"watch":     everyKeys,
+	"type":      firstKey,
+	"expire":    firstKey,
+	"pexpire":   firstKey,
+	"expireat":  firstKey,
+	"pexpireat": firstKey,
+	"persist":   firstKey,
+	"ttl":       firstKey,
+	"pttl":      firstKey,
+	"dump":      firstKey,
+	"restore":   firstKey,
+	"rename":    twoKeys,
+	"renamenx":  twoKeys,
+
+	// String
+	"get":         firstKey,
+	"set":         firstKey,
+	"setnx":       firstKey,
+	"setex":       firstKey,
+	"psetex":      firstKey,
+	"getset":      firstKey,
+	"getdel":      firstKey,
+	"append":      firstKey,
+	"strlen":      firstKey,
+	"incr":        firstKey,
+	"incrby":      firstKey,
+	"incrbyfloat": firstKey,
+	"decr":        firstKey,
+	"decrby":      firstKey,
+	"mget":        everyKeys,
+	"mset":        keyValueKeys,
+	"msetnx":      keyValueKeys,
+
+	// Bitmap and bitfield
+	"setbit":      firstKey,
+	"getbit":      firstKey,
+	"bitcount":    firstKey,
+	"bitpos":      firstKey,
+	"bitfield":    firstKey,
+	"bitfield_ro": firstKey,
+	"bitop":       {2, -1, 1}, // BITOP operation destkey key [key ...]
+
+	// Hash
+	"hget":         firstKey,
+	"hset":         firstKey,
+	"hsetnx":       firstKey,
+	"hmset":        firstKey,
+	"hmget":        firstKey,
+	"hdel":         firstKey,
+	"hexists":      firstKey,
+	"hgetall":      firstKey,
+	"hkeys":        firstKey,
+	"hvals":        firstKey,
+	"hlen":         firstKey,
+	"hincrby":      firstKey,
+	"hincrbyfloat": firstKey,
+	"hscan":        firstKey,
+	"hexpire":      firstKey,
+	"hpexpire":     firstKey,
+	"hpersist":     firstKey,
+	"httl":         firstKey,
+	"hpttl":        firstKey,
+
+	// Set
+	"sadd":        firstKey,
+	"srem":        firstKey,
+	"smembers":    firstKey,
+	"sismember":   firstKey,
+	"scard":       firstKey,
+	"srandmember": firstKey,
+	"spop":        firstKey,
+	"sscan":       firstKey,
+	"smove":       twoKeys, // SMOVE source destination member
+
+	// Sorted set
+	"zadd":             firstKey,
+	"zrem":             firstKey,
+	"zscore":           firstKey,
+	"zincrby":          firstKey,
+	"zcard":            firstKey,
+	"zcount":           firstKey,
+	"zrange":           firstKey,
+	"zrangebyscore":    firstKey,
+	"zrevrange":        firstKey,
+	"zrank":            firstKey,
+	"zremrangebyscore": firstKey,
+	"zscan":            firstKey,
+
+	// List
+	"lpush":     firstKey,
+	"rpush":     firstKey,
+	"lpop":      firstKey,
+	"rpop":      firstKey,
+	"lrange":    firstKey,
+	"llen":      firstKey,
+	"ltrim":     firstKey,
+	"rpoplpush": twoKeys,
+	"blpop":     {1, -2, 1}, // BLPOP key [key ...] timeout
+	"brpop":     {1, -2, 1},
+
+	// Pub/Sub, the channel is prefixed like a key
+	"publish": firstKey,
+}
+
+func newKeyPrefixHook(prefix string) *keyPrefixHook {
+	return &keyPrefixHook{prefix: prefix}
+}
+
+// prefixArgs add prefix to the keys in args of command, args is changed in place,
+// return error if the keys of command are unknown
+func (hook *keyPrefixHook) prefixArgs(args []interface{}) error {
+	if len(args) == 0 {
+		return nil
+	}
+	name, _ := args[0].(string)
+	name = strings.ToLower(name)
+
+	switch name {
+	case "eval", "evalsha":
+		// EVAL script numkeys key [key ...] arg [arg ...]
+		if len(args) < 3 {
+			return fmt.Errorf("cacher: %s has no numkeys", name)
+		}
+		numKeys, err := strconv.Atoi(fmt.Sprint(args[2]))
+		if err != nil || numKeys < 0 || 3+numKeys > len(args) {
+			return fmt.Errorf("cacher: %s has invalid numkeys %v", name, args[2])
+		}
+		return hook.prefixRange(name, args, 3, 2+numKeys, 1)
+	case "keys":
+		return hook.prefixPattern(name, args, 1)
+	case "scan":
+		// SCAN cursor [MATCH pattern] [COUNT count] [TYPE type], SCAN without MATCH is not limited to the prefix
+		for i := 2; i+1 < len(args); i += 2 {
+			if option, ok := args[i].(string); ok && strings.EqualFold(option, "match") {
+				return hook.prefixPattern(name, args, i+1)
+			}
+		}
+		return fmt.Errorf("cacher: scan without match pattern is not supported with key prefix")
+	}
+
+	spec, ok := commandKeySpecs[name]
+	if !ok {
+		return fmt.Errorf("cacher: %s is not supported with key prefix", name)
+	}
+	if spec.first == 0 {
+		return nil
+	}
+	last := spec.last
+	if last < 0 {
+		last += len(args)
+	}
+	return hook.prefixRange(name, args, spec.first, last, spec.step)
+}
+
+// prefixRange add prefix to args[first], args[first+step], ... until args[last]
+func (hook *keyPrefixHook) prefixRange(name string, args []interface{}, first int, last int, step int) error {
+	if last >= len(args) {
+		return fmt.Errorf("cacher: %s has too few arguments", name)
+	}
+	for i := first; i <= last; i += step {
+		key, ok := args[i].(string)
+		if !ok {
+			return fmt.Errorf("cacher: key of %s must be string, got %T", name, args[i])
+		}
+		args[i] = hook.prefix + key
+	}
+	return nil
+}
+
+func (hook *keyPrefixHook) prefixPattern(name string, args []interface{}, i int) error {
+	if i >= len(args) {
+		return fmt.Errorf("cacher: %s has no pattern", name)
+	}
+	pattern, ok := args[i].(string)
+	if !ok {
+		return fmt.Errorf("cacher: pattern of %s must be string, got %T", name, args[i])
+	}
+	args[i] = escapeGlob(hook.prefix) + pattern
+	return nil
+}
+
+func (hook *keyPrefixHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, hook.prefixArgs(cmd.Args())
+}
+
+func (hook *keyPrefixHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+func (hook *keyPrefixHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	for _, cmd := range cmds {
+		err := hook.prefixArgs(cmd.Args())
+		if err != nil {
+			return ctx, err
+		}
+	}
+	return ctx, nil
+}
+
+func (hook *keyPrefixHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+// escapeGlob escape the characters that have meaning in redis glob pattern (* ? [ ] \)
+func escapeGlob(s string) string {
+	if !strings.ContainsAny(s, "*?[]\\") {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// addKeyPrefixHook add keyPrefixHook to client if config has KeyPrefix
+func (cache *Cacher) addKeyPrefixHook(client redis.UniversalClient) {
+	if len(cache.config.KeyPrefix()) > 0 {
+		client.AddHook(newKeyPrefixHook(cache.config.KeyPrefix()))
+	}
+}
+
+// prefixKeys return new slice of keys with KeyPrefix, it is used for the channels of SUBSCRIBE
+// and the keys that are grouped by hash slot before they are sent
+func (cache *Cacher) prefixKeys(keys []string) []string {
+	prefix := cache.config.KeyPrefix()
+	if len(prefix) == 0 {
+		return keys
+	}
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = prefix + key
+	}
+	return prefixed
+}
+
+// pattern return KEYS / SCAN pattern with KeyPrefix, it is used for the clients that have no keyPrefixHook
+// (eg. the node clients of ForEachMaster)
+func (cache *Cacher) pattern(pattern string) string {
+	return escapeGlob(cache.config.KeyPrefix()) + pattern
+}
+
+// unprefixKey remove KeyPrefix from key that is returned from redis (eg. KEYS, SCAN)
+func (cache *Cacher) unprefixKey(key string) string {
+	return strings.TrimPrefix(key, cache.config.KeyPrefix())
+}
+
+// unprefixMessages forward messages with KeyPrefix removed from the channel,
+// the returned channel is closed when messages is closed or done is closed (eg. by Unsub),
+// so the forwarder does not block forever when subscriber stop reading
+func (cache *Cacher) unprefixMessages(messages <-chan *redis.Message, done <-chan struct{}) <-chan *redis.Message {
+	if len(cache.config.KeyPrefix()) == 0 {
+		return messages
+	}
+	unprefixed := make(chan *redis.Message, cap(messages))
+	go func() {
+		defer close(unprefixed)
+		for {
+			select {
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				select {
+				case unprefixed <- &redis.Message{
+					Channel:      cache.unprefixKey(msg.Channel),
+					Pattern:      msg.Pattern,
+					Payload:      msg.Payload,
+					PayloadSlice: msg.PayloadSlice,
+				}:
+				case <-done:
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return unprefixed
+}
@@ -30,6 +30,7 @@ type ICacher interface {
 	HIncr(key string, field string) (int, error)
 	HDecr(key string, field string) (int, error)
 	HMSet(key string, fieldValues map[string]interface{}) error
+	HMSetWithTTL(key string, fieldValues map[string]interface{}, expire time.Duration) error
 	HGet(key string, field string) (string, error)
 	HMGet(key string, fields []string) ([]interface{}, error)
 	HDel(key string, fields ...string) error
@@ -45,12 +46,17 @@ type ICacher interface {
 	Incr(key string) (int, error)
 	Decr(key string) (int, error)
 	MSet(kv map[string]interface{}) error
+	MSetWithTTL(items map[string]Item) error
 	Get(key string) (string, error)
 	MGet(keys []string) ([]interface{}, error)
 	Expire(key string, expire time.Duration) error
 	Expires(keys []string, expire time.Duration) error
 	Del(keys ...string) error
+	// DelIfValue delete key only if its value is value, return false if the key is not deleted
+	DelIfValue(key string, value string) (bool, error)
 	Exists(key string) (bool, error)
+	// SetNX set value only if key does not exist, return false if key exists
+	SetNX(key string, value string, expire time.Duration) (bool, error)
 
 	Pub(channel string, message interface{}) error
 	Sub(channels ...string) (<-chan *redis.Message, string /*subID used for close*/, error)
@@ -67,6 +73,9 @@ type ICacherConfig interface {
 	Endpoint() string
 	Password() string
 	DB() int
+	// KeyPrefix is the namespace of service, it is added to every keys and channels, eg. lesson3.1:
+	// so the services that share redis DB do not see (or delete) the keys of each others
+	KeyPrefix() string
 	ConnectionSettings() ICacherConnectionSettings
 }
 
@@ -131,9 +140,17 @@ func (setting *DefaultCacherConnectionSettings) WriteTimeout() time.Duration {
 	return time.Minute
 }
 
+// Item is the value to cache with its own time to expire, 0 = no expired
+type Item struct {
+	Value  interface{}
+	Expire time.Duration
+}
+
 type pubsubChannels struct {
 	ps       *redis.PubSub
 	channels []string
+	// done is closed by Unsub to stop the forwarder of messages
+	done chan struct{}
 }
 
 // Cacher is the struct for cache service
@@ -158,7 +175,7 @@ func NewCacher(config ICacherConfig) *Cacher {
 func (cache *Cacher) newClient() *redis.Client {
 	cfg := cache.config
 	settings := cfg.ConnectionSettings()
-	return redis.NewClient(&redis.Options{
+	client := redis.NewClient(&redis.Options{
 		Addr:               cfg.Endpoint(),
 		Password:           cfg.Password(),
 		DB:                 cfg.DB(),
@@ -173,6 +190,8 @@ func (cache *Cacher) newClient() *redis.Client {
 		ReadTimeout:        settings.ReadTimeout(),
 		WriteTimeout:       settings.WriteTimeout(),
 	})
+	cache.addKeyPrefixHook(client)
+	return client
 }
 
 func (cache *Cacher) getClient() (*redis.Client, error) {
@@ -296,9 +315,10 @@ func (cache *Cacher) Keys(pattern string) ([]string, error) {
 
 	}
 
+	// The key prefix is removed, so the keys can be passed to other commands
 	retKeys := []string{}
 	for key := range allKeys {
-		retKeys = append(retKeys, key)
+		retKeys = append(retKeys, cache.unprefixKey(key))
 	}
 	return retKeys, nil
 }
@@ -338,6 +358,46 @@ func (cache *Cacher) Exists(key string) (bool, error) {
 	return val == 1, nil
 }
 
+// delIfValueScript delete KEYS[1] only if its value is ARGV[1]
+var delIfValueScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// DelIfValue delete key only if its value is value, so the lock that is taken by other owner is not deleted
+func (cache *Cacher) DelIfValue(key string, value string) (bool, error) {
+
+	c, err := cache.getClient()
+	if err != nil {
+		return false, err
+	}
+
+	deleted, err := delIfValueScript.Run(context.Background(), c, []string{key}, value).Int64()
+	if err != nil {
+		return false, err
+	}
+
+	return deleted == 1, nil
+}
+
+// SetNX set value only if key does not exist, return false if key exists
+func (cache *Cacher) SetNX(key string, value string, expire time.Duration) (bool, error) {
+
+	c, err := cache.getClient()
+	if err != nil {
+		return false, err
+	}
+
+	ok, err := c.SetNX(context.Background(), key, value, expire).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
 // Del the cache by keys
 func (cache *Cacher) Del(keys ...string) error {
 	if len(keys) == 0 {
@@ -466,27 +526,49 @@ func (cache *Cacher) MSet(kv map[string]interface{}) error {
 
 	pairs := []interface{}{}
 	for k, v := range kv {
-
-		str, ok := v.(string)
-		// Check empty string if value string
-		if ok && len(str) == 0 {
-			pairs = append(pairs, k, "")
-			continue
-		}
-		// If value is string, not pass it to json.Marshal
-		if len(str) > 0 {
-			pairs = append(pairs, k, str)
-			continue
+		val, err := cache.toCacheValue(v)
+		if err != nil {
+			return err
 		}
+		pairs = append(pairs, k, val)
+	}
+
+	err = c.MSet(context.Background(), pairs...).Err()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
 
-		strb, err := json.Marshal(v)
+// MSetWithTTL set multiple key value with expiration of each key,
+// all keys are set in single round trip using MULTI/EXEC, so there is no key without TTL
+func (cache *Cacher) MSetWithTTL(items map[string]Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	c, err := cache.getClient()
+	if err != nil {
+		return err
+	}
+
+	vals := map[string]interface{}{}
+	for k, item := range items {
+		val, err := cache.toCacheValue(item.Value)
 		if err != nil {
 			return err
 		}
-		pairs = append(pairs, k, strb)
+		vals[k] = val
 	}
 
-	err = c.MSet(context.Background(), pairs...).Err()
+	_, err = c.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		for k, val := range vals {
+			// 0 = no expired
+			pipe.Set(context.Background(), k, val, items[k].Expire)
+		}
+		return nil
+	})
 	if err != nil {
 		return err
 	}
@@ -494,6 +576,21 @@ func (cache *Cacher) MSet(kv map[string]interface{}) error {
 	return nil
 }
 
+// toCacheValue return string as is, other value is marshal to json
+func (cache *Cacher) toCacheValue(v interface{}) (interface{}, error) {
+	// If value is string, not pass it to json.Marshal
+	str, ok := v.(string)
+	if ok {
+		return str, nil
+	}
+
+	strb, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return strb, nil
+}
+
 // Decr minus 1 to a counter on key, return first counter (-1) if cache expire
 func (cache *Cacher) Decr(key string) (int, error) {
 
@@ -843,6 +940,33 @@ func (cache *Cacher) HMSet(key string, fieldValues map[string]interface{}) error
 	return nil
 }
 
+// HMSetWithTTL set multiple field value and expiration of key in single round trip using MULTI/EXEC,
+// expire 0 does not change the expire of key, so the existing key keep its TTL
+func (cache *Cacher) HMSetWithTTL(key string, fieldValues map[string]interface{}, expire time.Duration) error {
+	// HSET without field is error, and it fail the whole MULTI
+	if len(fieldValues) == 0 {
+		return nil
+	}
+
+	c, err := cache.getClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.HSet(context.Background(), key, fieldValues)
+		if expire > 0 {
+			pipe.Expire(context.Background(), key, expire)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // HDecr minus 1 to a counter on key, return first counter (-1) if cache expire
 func (cache *Cacher) HDecr(key string, field string) (int, error) {
 
@@ -1389,7 +1513,10 @@ func NewBitFieldCmdU32(cmdType BitFieldCmdType, itemPosition int, value int) *Bi
 }
 
 func (cache *Cacher) Autonumber(name string) (int, error) {
-	key := fmt.Sprintf("autonumber_%s", name)
+	key, err := KeyAutonumber.Key(name)
+	if err != nil {
+		return -1, err
+	}
 	nextNumber, err := cache.Incr(key)
 	if err != nil {
 		return -1, err
@@ -1434,15 +1561,19 @@ func (cache *Cacher) Sub(channels ...string) (<-chan *redis.Message /*subID (use
 		return nil, "", err
 	}
 
+	// SUBSCRIBE is not sent through hooks, so add the key prefix here
+	channels = cache.prefixKeys(channels)
 	ps := c.Subscribe(context.Background(), channels...)
 	subID := NewUUID()
+	done := make(chan struct{})
 
 	cache.subsribers.Store(subID, &pubsubChannels{
 		ps:       ps,
 		channels: channels,
+		done:     done,
 	})
 
-	return ps.Channel(), subID, nil
+	return cache.unprefixMessages(ps.Channel(), done), subID, nil
 }
 
 // Unsub will unsub subscriber
@@ -1451,7 +1582,7 @@ func (cache *Cacher) Unsub(subID string) error {
 		return nil
 	}
 
-	psChannels, ok := cache.subsribers.Load(subID)
+	psChannels, ok := cache.subsribers.LoadAndDelete(subID)
 	if !ok {
 		return nil
 	}
@@ -1459,6 +1590,7 @@ func (cache *Cacher) Unsub(subID string) error {
 	if !ok {
 		return nil
 	}
+	close(pubsubChannels.done)
 
 	if pubsubChannels.ps != nil {
 		err := pubsubChannels.ps.Unsubscribe(context.Background(), pubsubChannels.channels...)
@@ -1473,7 +1605,5 @@ func (cache *Cacher) Unsub(subID string) error {
 		}
 	}
 
-	cache.subsribers.Delete(subID)
-
 	return nil
 }
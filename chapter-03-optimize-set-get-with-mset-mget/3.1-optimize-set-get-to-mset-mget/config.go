@@ -37,6 +37,11 @@ func (cfg *CacherConfig) DB() int {
 	return 0
 }
 
+// KeyPrefix is the namespace of this lesson, setup() delete only the keys in this namespace
+func (cfg *CacherConfig) KeyPrefix() string {
+	return "lesson3.1:"
+}
+
 func (cfg *CacherConfig) ConnectionSettings() ICacherConnectionSettings {
 	return NewDefaultCacherConnectionSettings()
 }
@@ -0,0 +1,34 @@
+package main
+
+import "time"
+
+// keySchemas is the registry of every key families of this lesson
+var keySchemas = NewKeyRegistry()
+
+var (
+	// KeyMembersLatest is the JSON of the latest members
+	KeyMembersLatest = keySchemas.Register(&KeyFamily{
+		Name:       "members_latest",
+		Pattern:    "members::latest",
+		ValueType:  KeyValueJSON,
+		DefaultTTL: 5 * time.Minute,
+		Version:    1,
+	})
+	// KeyMembersTotal is the number of every members
+	KeyMembersTotal = keySchemas.Register(&KeyFamily{
+		Name:       "members_total",
+		Pattern:    "members::total",
+		ValueType:  KeyValueString,
+		DefaultTTL: 5 * time.Minute,
+		Version:    1,
+	})
+	// KeyAutonumber is the running number of cacher.Autonumber
+	KeyAutonumber = keySchemas.Register(&KeyFamily{
+		Name:             "autonumber",
+		Pattern:          "autonumber_{name}",
+		ValueType:        KeyValueCounter,
+		DefaultTTL:       0,
+		EvictionCritical: true,
+		Version:          1,
+	})
+)
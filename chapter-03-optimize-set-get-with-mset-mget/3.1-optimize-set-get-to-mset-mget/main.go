@@ -49,7 +49,7 @@ func main() {
 	//    the benefit of data layer cache, is data can be shared at other api
 	// ms.GET("/api", func(ctx IContext) error {
 
-	// 	query1CacheKey := "members::latest"
+	// 	query1CacheKey := KeyMembersLatest.MustKey()
 	// 	members := []*Member{}
 
 	// 	timeToExpire := 60 * 5 * time.Second // 5m
@@ -83,7 +83,7 @@ func main() {
 	// 		}
 	// 	}
 
-	// 	query2CacheKey := "members::total"
+	// 	query2CacheKey := KeyMembersTotal.MustKey()
 	// 	counter := -1
 	// 	counterJS, err := cacher.Get(query2CacheKey)
 	// 	if err != nil {
@@ -127,8 +127,8 @@ func main() {
 	//    using MSET and MGET to optimize
 	// ms.GET("/api", func(ctx IContext) error {
 
-	// 	query1CacheKey := "members::latest"
-	// 	query2CacheKey := "members::total"
+	// 	query1CacheKey := KeyMembersLatest.MustKey()
+	// 	query2CacheKey := KeyMembersTotal.MustKey()
 
 	// 	members := []*Member{}
 	// 	counter := -1
@@ -191,18 +191,13 @@ func main() {
 	// 	if len(itemToCaches) > 0 {
 	// 		timeToExpire := 60 * 5 * time.Second // 5m
 
-	// 		// Set cache using MSET
-	// 		err = cacher.MSet(itemToCaches)
-	// 		if err != nil {
-	// 			ctx.Log(err.Error())
-	// 		}
-
-	// 		// Set time to expire
-	// 		keys := []string{}
-	// 		for k := range itemToCaches {
-	// 			keys = append(keys, k)
+	// 		// Set cache and time to expire using SET with expire of each key in single MULTI/EXEC,
+	// 		// so there is no key without time to expire
+	// 		items := map[string]Item{}
+	// 		for k, v := range itemToCaches {
+	// 			items[k] = Item{Value: v, Expire: timeToExpire}
 	// 		}
-	// 		err = cacher.Expires(keys, timeToExpire)
+	// 		err = cacher.MSetWithTTL(items)
 	// 		if err != nil {
 	// 			ctx.Log(err.Error())
 	// 		}
@@ -220,8 +215,8 @@ func main() {
 	// 6. GET api using cache at data layer and local memcache
 	// ms.GET("/api", func(ctx IContext) error {
 
-	// 	query1CacheKey := "members::latest"
-	// 	query2CacheKey := "members::total"
+	// 	query1CacheKey := KeyMembersLatest.MustKey()
+	// 	query2CacheKey := KeyMembersTotal.MustKey()
 
 	// 	members := []*Member{}
 	// 	counter := -1
@@ -322,18 +317,13 @@ func main() {
 
 	// 		timeToExpire := 60 * 10 * time.Second // 10m
 
-	// 		// Set cache using MSET
-	// 		err = cacher.MSet(remoteItemToCaches)
-	// 		if err != nil {
-	// 			ctx.Log(err.Error())
-	// 		}
-
-	// 		// Set time to expire
-	// 		keys := []string{}
-	// 		for k := range remoteItemToCaches {
-	// 			keys = append(keys, k)
+	// 		// Set cache and time to expire using SET with expire of each key in single MULTI/EXEC,
+	// 		// so there is no key without time to expire
+	// 		items := map[string]Item{}
+	// 		for k, v := range remoteItemToCaches {
+	// 			items[k] = Item{Value: v, Expire: timeToExpire}
 	// 		}
-	// 		err = cacher.Expires(keys, timeToExpire)
+	// 		err = cacher.MSetWithTTL(items)
 	// 		if err != nil {
 	// 			ctx.Log(err.Error())
 	// 		}
@@ -348,6 +338,45 @@ func main() {
 	// 	return nil
 	// })
 
+	// 7. GET api using stale-while-revalidate cache
+	//    when the cache is stale, the request get the stale value immediately
+	//    while only one background refresh query the database,
+	//    and the hot keys are reloaded before they expire
+	// swrCacher := NewSWRCacher(
+	// 	ms.Cacher(cfg.CacherConfig()),
+	// 	NewSWROptions(
+	// 		60*5*time.Second,  // soft expire 5m
+	// 		60*10*time.Second, // hard expire 10m
+	// 	))
+	// ms.GET("/api", func(ctx IContext) error {
+
+	// 	members := []*Member{}
+	// 	err := swrCacher.Get(KeyMembersLatest.MustKey(), &members, func() (interface{}, error) {
+	// 		return queryLastestMembersFromDatabase(ctx, cfg)
+	// 	})
+	// 	if err != nil {
+	// 		ctx.Response(http.StatusInternalServerError, map[string]interface{}{"status": "error"})
+	// 		return nil
+	// 	}
+
+	// 	counter := -1
+	// 	err = swrCacher.Get(KeyMembersTotal.MustKey(), &counter, func() (interface{}, error) {
+	// 		return queryCountAllMembersFromDatabase(ctx, cfg)
+	// 	})
+	// 	if err != nil {
+	// 		ctx.Response(http.StatusInternalServerError, map[string]interface{}{"status": "error"})
+	// 		return nil
+	// 	}
+
+	// 	resp := map[string]interface{}{
+	// 		"status": "ok",
+	// 		"total":  counter,
+	// 		"items":  members,
+	// 	}
+	// 	ctx.Response(http.StatusOK, resp)
+	// 	return nil
+	// })
+
 	// 5. Cleanup when exit
 	defer ms.Cleanup()
 	ms.Start()
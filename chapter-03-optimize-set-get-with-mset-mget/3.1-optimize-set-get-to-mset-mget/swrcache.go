@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SWRLoader load fresh value from the source of truth (eg. database)
+type SWRLoader func() (interface{}, error)
+
+// ISWRCacher is the interface for stale-while-revalidate cache
+type ISWRCacher interface {
+	// Get read value of key into out, if the key is not in cache, loader is used to load it
+	Get(key string, out interface{}, loader SWRLoader) error
+	// Refresh load value using loader and replace the value in cache
+	Refresh(key string, loader SWRLoader) error
+}
+
+// SWROptions is the options of SWRCacher
+type SWROptions struct {
+	// SoftTTL is the time the value is fresh, after this time readers will get
+	// the stale value immediately while one background refresh is running
+	SoftTTL time.Duration
+	// HardTTL is the redis TTL, after this time the key is removed from redis
+	HardTTL time.Duration
+	// Jitter is the maximum random time added to SoftTTL and HardTTL,
+	// so keys that set at the same time will not expire at the same time
+	Jitter time.Duration
+	// RefreshAhead is the time before soft expiry that hot key will be reloaded, 0 = disabled
+	RefreshAhead time.Duration
+	// HotHits is the number of reads since last refresh to count the key as hot key
+	HotHits int64
+	// LockTimeout is the maximum time of one refresh, used to lock refresh between instances
+	LockTimeout time.Duration
+}
+
+// NewSWROptions return SWROptions with default jitter, refresh ahead and lock timeout
+func NewSWROptions(softTTL time.Duration, hardTTL time.Duration) *SWROptions {
+	return &SWROptions{
+		SoftTTL:      softTTL,
+		HardTTL:      hardTTL,
+		Jitter:       softTTL / 10,
+		RefreshAhead: softTTL / 10,
+		HotHits:      10,
+		LockTimeout:  10 * time.Second,
+	}
+}
+
+// swrEntry is the value stored in redis, it wrap the value with the soft expiry
+type swrEntry struct {
+	Value      json.RawMessage `json:"v"`
+	SoftExpire int64           `json:"s"` // unix time in milliseconds
+}
+
+// swrCall is the in-flight load of a key, concurrent readers wait for the same call
+type swrCall struct {
+	wg  sync.WaitGroup
+	val json.RawMessage
+	err error
+}
+
+// SWRCacher is the stale-while-revalidate cache on top of ICacher
+type SWRCacher struct {
+	cacher     ICacher
+	options    *SWROptions
+	callsMutex sync.Mutex
+	calls      map[string]*swrCall
+	refreshing *sync.Map
+	hits       *sync.Map
+}
+
+// NewSWRCacher return new SWRCacher
+func NewSWRCacher(cacher ICacher, options *SWROptions) *SWRCacher {
+	return &SWRCacher{
+		cacher:     cacher,
+		options:    options,
+		calls:      map[string]*swrCall{},
+		refreshing: &sync.Map{},
+		hits:       &sync.Map{},
+	}
+}
+
+// Get read value of key into out, the stale value is returned while the key is refreshing in background
+func (swr *SWRCacher) Get(key string, out interface{}, loader SWRLoader) error {
+
+	entryJS, err := swr.cacher.Get(key)
+	if err != nil {
+		// Cannot read from cache, load from the source directly
+		val, err := swr.load(key, loader)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(val, out)
+	}
+
+	entry := &swrEntry{}
+	if len(entryJS) > 0 {
+		err = json.Unmarshal([]byte(entryJS), entry)
+		if err != nil {
+			swr.cacher.Del(key)
+			entry = &swrEntry{}
+		}
+	}
+
+	// Cache miss, every reader have to wait for the value
+	if len(entry.Value) == 0 {
+		val, err := swr.load(key, loader)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(val, out)
+	}
+
+	now := time.Now()
+	softExpire := time.Unix(0, entry.SoftExpire*int64(time.Millisecond))
+	if !now.Before(softExpire) {
+		// Stale, return the stale value and refresh in background
+		swr.refreshAsync(key, loader)
+	} else if swr.isHot(key) && swr.options.RefreshAhead > 0 &&
+		!now.Before(softExpire.Add(-swr.options.RefreshAhead)) {
+		// Hot key is about to expire, refresh it ahead
+		swr.refreshAsync(key, loader)
+	}
+
+	return json.Unmarshal(entry.Value, out)
+}
+
+// Refresh load value using loader and replace the value in cache
+func (swr *SWRCacher) Refresh(key string, loader SWRLoader) error {
+	_, err := swr.load(key, loader)
+	return err
+}
+
+// isHot count the read of key and return true if the reads reach HotHits
+func (swr *SWRCacher) isHot(key string) bool {
+	counter, _ := swr.hits.LoadOrStore(key, new(int64))
+	hits := atomic.AddInt64(counter.(*int64), 1)
+	return hits >= swr.options.HotHits
+}
+
+// load call loader once for concurrent readers of the same key, then set the value into cache
+func (swr *SWRCacher) load(key string, loader SWRLoader) (json.RawMessage, error) {
+	swr.callsMutex.Lock()
+	call, ok := swr.calls[key]
+	if ok {
+		swr.callsMutex.Unlock()
+		call.wg.Wait()
+		return call.val, call.err
+	}
+	call = &swrCall{}
+	call.wg.Add(1)
+	swr.calls[key] = call
+	swr.callsMutex.Unlock()
+
+	call.val, call.err = swr.loadAndSet(key, loader)
+	call.wg.Done()
+
+	swr.callsMutex.Lock()
+	delete(swr.calls, key)
+	swr.callsMutex.Unlock()
+
+	return call.val, call.err
+}
+
+func (swr *SWRCacher) loadAndSet(key string, loader SWRLoader) (json.RawMessage, error) {
+	val, err := loader()
+	if err != nil {
+		return nil, err
+	}
+
+	valJS, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+
+	jitter := swr.jitter()
+	entry := &swrEntry{
+		Value:      valJS,
+		SoftExpire: time.Now().Add(swr.options.SoftTTL+jitter).UnixNano() / int64(time.Millisecond),
+	}
+	err = swr.cacher.Set(key, entry, swr.options.HardTTL+jitter)
+	if err != nil {
+		// The value is loaded, so just return it even it cannot be cached
+		fmt.Println("swr:", err.Error())
+	}
+
+	// Reset the hits of the key, so the key must be hot again to refresh ahead
+	swr.hits.Delete(key)
+
+	return valJS, nil
+}
+
+// refreshAsync start one background refresh of key,
+// only one refresh per key is running across all instances of service
+func (swr *SWRCacher) refreshAsync(key string, loader SWRLoader) {
+	// Only one refresh per key in this instance
+	_, running := swr.refreshing.LoadOrStore(key, struct{}{})
+	if running {
+		return
+	}
+
+	go func() {
+		defer swr.refreshing.Delete(key)
+
+		// Only one refresh per key across instances, the instance that SET NX the lock will refresh,
+		// the lock is set with expire in the same command, so if this instance die, other instance can refresh later
+		lockKey := swr.refreshLockKey(key)
+		token := NewUUID()
+		locked, err := swr.cacher.SetNX(lockKey, token, swr.options.LockTimeout)
+		if err != nil {
+			fmt.Println("swr:", err.Error())
+			return
+		}
+		if !locked {
+			return
+		}
+		// Delete only our lock, the lock may be expired and taken by other instance while loading
+		defer swr.cacher.DelIfValue(lockKey, token)
+
+		_, err = swr.load(key, loader)
+		if err != nil {
+			fmt.Println("swr:", err.Error())
+		}
+	}()
+}
+
+func (swr *SWRCacher) refreshLockKey(key string) string {
+	return fmt.Sprintf("%s::refresh_lock", key)
+}
+
+func (swr *SWRCacher) jitter() time.Duration {
+	if swr.options.Jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(swr.options.Jitter)))
+}
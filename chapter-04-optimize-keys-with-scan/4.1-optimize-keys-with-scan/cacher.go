@@ -69,6 +69,9 @@ type ICacherConfig interface {
 	Endpoint() string
 	Password() string
 	DB() int
+	// KeyPrefix is the namespace of service, it is added to every keys and channels, eg. lesson4.1:
+	// so the services that share redis DB do not see (or delete) the keys of each others
+	KeyPrefix() string
 	ConnectionSettings() ICacherConnectionSettings
 }
 
@@ -136,6 +139,8 @@ func (setting *DefaultCacherConnectionSettings) WriteTimeout() time.Duration {
 type pubsubChannels struct {
 	ps       *redis.PubSub
 	channels []string
+	// done is closed by Unsub to stop the forwarder of messages
+	done chan struct{}
 }
 
 // Cacher is the struct for cache service
@@ -160,7 +165,7 @@ func NewCacher(config ICacherConfig) *Cacher {
 func (cache *Cacher) newClient() *redis.Client {
 	cfg := cache.config
 	settings := cfg.ConnectionSettings()
-	return redis.NewClient(&redis.Options{
+	client := redis.NewClient(&redis.Options{
 		Addr:               cfg.Endpoint(),
 		Password:           cfg.Password(),
 		DB:                 cfg.DB(),
@@ -175,6 +180,8 @@ func (cache *Cacher) newClient() *redis.Client {
 		ReadTimeout:        settings.ReadTimeout(),
 		WriteTimeout:       settings.WriteTimeout(),
 	})
+	cache.addKeyPrefixHook(client)
+	return client
 }
 
 func (cache *Cacher) getClient() (*redis.Client, error) {
@@ -249,6 +256,10 @@ func (cache *Cacher) KeysN(pattern string) ([]string, error) {
 		return nil, err
 	}
 
+	// The key prefix is removed, so the keys can be passed to other commands
+	for i, key := range res {
+		res[i] = cache.unprefixKey(key)
+	}
 	return res, nil
 }
 
@@ -312,9 +323,10 @@ func (cache *Cacher) Keys(pattern string) ([]string, error) {
 
 	}
 
+	// The key prefix is removed, so the keys can be passed to other commands
 	retKeys := []string{}
 	for key := range allKeys {
-		retKeys = append(retKeys, key)
+		retKeys = append(retKeys, cache.unprefixKey(key))
 	}
 	return retKeys, nil
 }
@@ -1405,7 +1417,10 @@ func NewBitFieldCmdU32(cmdType BitFieldCmdType, itemPosition int, value int) *Bi
 }
 
 func (cache *Cacher) Autonumber(name string) (int, error) {
-	key := fmt.Sprintf("autonumber_%s", name)
+	key, err := KeyAutonumber.Key(name)
+	if err != nil {
+		return -1, err
+	}
 	nextNumber, err := cache.Incr(key)
 	if err != nil {
 		return -1, err
@@ -1450,15 +1465,19 @@ func (cache *Cacher) Sub(channels ...string) (<-chan *redis.Message /*subID (use
 		return nil, "", err
 	}
 
+	// SUBSCRIBE is not sent through hooks, so add the key prefix here
+	channels = cache.prefixKeys(channels)
 	ps := c.Subscribe(context.Background(), channels...)
 	subID := NewUUID()
+	done := make(chan struct{})
 
 	cache.subsribers.Store(subID, &pubsubChannels{
 		ps:       ps,
 		channels: channels,
+		done:     done,
 	})
 
-	return ps.Channel(), subID, nil
+	return cache.unprefixMessages(ps.Channel(), done), subID, nil
 }
 
 // Unsub will unsub subscriber
@@ -1467,7 +1486,7 @@ func (cache *Cacher) Unsub(subID string) error {
 		return nil
 	}
 
-	psChannels, ok := cache.subsribers.Load(subID)
+	psChannels, ok := cache.subsribers.LoadAndDelete(subID)
 	if !ok {
 		return nil
 	}
@@ -1475,6 +1494,7 @@ func (cache *Cacher) Unsub(subID string) error {
 	if !ok {
 		return nil
 	}
+	close(pubsubChannels.done)
 
 	if pubsubChannels.ps != nil {
 		err := pubsubChannels.ps.Unsubscribe(context.Background(), pubsubChannels.channels...)
@@ -1489,7 +1509,5 @@ func (cache *Cacher) Unsub(subID string) error {
 		}
 	}
 
-	cache.subsribers.Delete(subID)
-
 	return nil
 }
@@ -0,0 +1,24 @@
+package main
+
+// keySchemas is the registry of every key families of this lesson
+var keySchemas = NewKeyRegistry()
+
+var (
+	// KeyItem is the key that setup add for the workshop, eg. key::0 to key::299999
+	KeyItem = keySchemas.Register(&KeyFamily{
+		Name:       "item",
+		Pattern:    "key::{id}",
+		ValueType:  KeyValueString,
+		DefaultTTL: 0,
+		Version:    1,
+	})
+	// KeyAutonumber is the running number of cacher.Autonumber
+	KeyAutonumber = keySchemas.Register(&KeyFamily{
+		Name:             "autonumber",
+		Pattern:          "autonumber_{name}",
+		ValueType:        KeyValueCounter,
+		DefaultTTL:       0,
+		EvictionCritical: true,
+		Version:          1,
+	})
+)
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	_ "github.com/3dsinteractive/wrkgo"
@@ -26,7 +27,7 @@ func main() {
 
 	// 3. Random cacheKey and return the value
 	ms.GET("/api", func(ctx IContext) error {
-		cacheKey := fmt.Sprintf("key::%d", RandomMinMax(0, totalKeys-1))
+		cacheKey := KeyItem.MustKey(strconv.Itoa(RandomMinMax(0, totalKeys-1)))
 		cacher := ctx.Cacher(cfg.CacherConfig())
 		val, err := cacher.Get(cacheKey)
 		if err != nil {
@@ -1,10 +1,10 @@
 package main
 
-import "fmt"
+import "strconv"
 
 func setup(cfg IConfig) error {
 
-	// Clear all caches
+	// Clear all caches in the namespace of this service, Keys and Del use KeyPrefix of config
 	cacher := NewCacher(cfg.CacherConfig())
 	allKeys, err := cacher.Keys("*")
 	if err != nil {
@@ -23,7 +23,7 @@ func setup(cfg IConfig) error {
 		kvs := make(map[string]interface{})
 		for j := 0; j < batchSize; j++ {
 			id := i*batchSize + j
-			key := fmt.Sprintf("key::%d", id)
+			key := KeyItem.MustKey(strconv.Itoa(id))
 			kvs[key] = id
 		}
 		err = cacher.MSet(kvs)
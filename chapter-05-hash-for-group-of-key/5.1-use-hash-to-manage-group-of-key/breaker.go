@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of circuit breaker
+type CircuitState string
+
+const (
+	// CircuitClosed let every commands go to redis
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen fail every commands immediately without connect to redis
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen let a few commands go to redis to check if it is recovered
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// ErrCircuitOpen is returned immediately when the circuit of cacher endpoint is open
+var ErrCircuitOpen = errors.New("cacher: circuit is open")
+
+// circuitBreaker stop calling redis after consecutive failures,
+// after open timeout it let a few calls through (half open) and close when they success
+type circuitBreaker struct {
+	mutex            sync.Mutex
+	state            CircuitState
+	failures         int
+	openedAt         time.Time
+	halfOpenCalls    int
+	failureThreshold int
+	openTimeout      time.Duration
+	halfOpenMaxCalls int
+}
+
+func newCircuitBreaker(settings ICacherConnectionSettings) *circuitBreaker {
+	return &circuitBreaker{
+		state:            CircuitClosed,
+		failureThreshold: settings.BreakerFailureThreshold(),
+		openTimeout:      settings.BreakerOpenTimeout(),
+		halfOpenMaxCalls: settings.BreakerHalfOpenMaxCalls(),
+	}
+}
+
+// State return the current state of circuit
+func (breaker *circuitBreaker) State() CircuitState {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	if breaker.state == CircuitOpen && time.Since(breaker.openedAt) >= breaker.openTimeout {
+		return CircuitHalfOpen
+	}
+	return breaker.state
+}
+
+// allow return ErrCircuitOpen if the call is not allowed
+func (breaker *circuitBreaker) allow() error {
+	// Threshold <= 0 means circuit breaker is disabled
+	if breaker.failureThreshold <= 0 {
+		return nil
+	}
+
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	switch breaker.state {
+	case CircuitOpen:
+		if time.Since(breaker.openedAt) < breaker.openTimeout {
+			return ErrCircuitOpen
+		}
+		breaker.state = CircuitHalfOpen
+		breaker.halfOpenCalls = 0
+		fallthrough
+	case CircuitHalfOpen:
+		if breaker.halfOpenCalls >= breaker.halfOpenMaxCalls {
+			return ErrCircuitOpen
+		}
+		breaker.halfOpenCalls++
+	}
+	return nil
+}
+
+// success close the circuit
+func (breaker *circuitBreaker) success() {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	breaker.state = CircuitClosed
+	breaker.failures = 0
+	breaker.halfOpenCalls = 0
+}
+
+// failure open the circuit when failures reach threshold, or when the half open call failed
+func (breaker *circuitBreaker) failure() {
+	if breaker.failureThreshold <= 0 {
+		return
+	}
+
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	breaker.failures++
+	if breaker.state == CircuitHalfOpen || breaker.failures >= breaker.failureThreshold {
+		breaker.state = CircuitOpen
+		breaker.openedAt = time.Now()
+		breaker.halfOpenCalls = 0
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestBreaker(failureThreshold int, halfOpenMaxCalls int) *circuitBreaker {
+	return &circuitBreaker{
+		state:            CircuitClosed,
+		failureThreshold: failureThreshold,
+		openTimeout:      time.Minute,
+		halfOpenMaxCalls: halfOpenMaxCalls,
+	}
+}
+
+// expireOpen move openedAt back, so the open timeout is passed
+func expireOpen(breaker *circuitBreaker) {
+	breaker.openedAt = time.Now().Add(-breaker.openTimeout)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	tests := []struct {
+		name             string
+		failureThreshold int
+		halfOpenMaxCalls int
+		steps            string // f = failure, s = success, a = allowed call, d = denied call, e = open timeout is passed
+		want             CircuitState
+	}{
+		{"closed at start", 3, 1, "a", CircuitClosed},
+		{"failures below threshold", 3, 1, "ffa", CircuitClosed},
+		{"failures reach threshold", 3, 1, "fffd", CircuitOpen},
+		{"success reset failures", 3, 1, "ffsffa", CircuitClosed},
+		{"half open after timeout", 3, 1, "fffe", CircuitHalfOpen},
+		{"half open limit calls", 3, 2, "fffeaad", CircuitHalfOpen},
+		{"half open call success", 3, 1, "fffeasa", CircuitClosed},
+		{"half open call failed", 3, 1, "fffeafd", CircuitOpen},
+		{"open again after timeout", 3, 1, "fffeafea", CircuitHalfOpen},
+		{"threshold 0 disable breaker", 0, 1, "fffffa", CircuitClosed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breaker := newTestBreaker(tt.failureThreshold, tt.halfOpenMaxCalls)
+			for i, step := range tt.steps {
+				switch step {
+				case 'f':
+					breaker.failure()
+				case 's':
+					breaker.success()
+				case 'e':
+					expireOpen(breaker)
+				case 'a':
+					if err := breaker.allow(); err != nil {
+						t.Fatalf("step %d: allow = %v, want nil", i, err)
+					}
+				case 'd':
+					if err := breaker.allow(); !errors.Is(err, ErrCircuitOpen) {
+						t.Fatalf("step %d: allow = %v, want ErrCircuitOpen", i, err)
+					}
+				}
+			}
+			if got := breaker.State(); got != tt.want {
+				t.Errorf("State = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrFallbackLimit is returned when cache is unavailable and too many loaders are running,
+// it is also ErrUnavailable, so HTTPStatusOf return 503
+var ErrFallbackLimit = fmt.Errorf("%w: fallback loaders exceed limit", ErrUnavailable)
+
+// CacheAside read from cache and load from the loader (eg. IPersister) on a miss,
+// when the cache is unavailable (eg. circuit is open) it call the loader directly,
+// the loaders that run without cache are limited, so database is not overloaded
+type CacheAside struct {
+	cacher   ICacher
+	fallback chan struct{}
+}
+
+// NewCacheAside return new CacheAside, maxFallbacks is the max concurrent loaders while cache is unavailable
+func NewCacheAside(cacher ICacher, maxFallbacks int) *CacheAside {
+	if maxFallbacks <= 0 {
+		maxFallbacks = 1
+	}
+	return &CacheAside{
+		cacher:   cacher,
+		fallback: make(chan struct{}, maxFallbacks),
+	}
+}
+
+// Get return value of key from cache, or from loader and set to cache with expire
+func (ca *CacheAside) Get(key string, expire time.Duration, loader func() (string, error)) (string, error) {
+	val, err := ca.cacher.Get(key)
+	if err == nil {
+		return val, nil
+	}
+	if isCacheDown(err) {
+		return ca.fallbackLoad(loader)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return "", err
+	}
+
+	val, err = loader()
+	if err != nil {
+		return "", err
+	}
+	// The value is loaded, so the error of cache is ignored
+	ca.cacher.SetS(key, val, expire)
+	return val, nil
+}
+
+// HGet return value of field from cache, or from loader and set to cache with expire
+func (ca *CacheAside) HGet(key string, field string, expire time.Duration, loader func() (string, error)) (string, error) {
+	val, err := ca.cacher.HGet(key, field)
+	if err == nil {
+		return val, nil
+	}
+	if isCacheDown(err) {
+		return ca.fallbackLoad(loader)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return "", err
+	}
+
+	val, err = loader()
+	if err != nil {
+		return "", err
+	}
+	// The value is loaded, so the error of cache is ignored
+	ca.cacher.HSetS(key, field, val, expire)
+	return val, nil
+}
+
+// isCacheDown return true when the cache cannot answer (unavailable or timeout),
+// the other errors (eg. WRONGTYPE) are returned to the caller, the loader is not called
+func isCacheDown(err error) bool {
+	return errors.Is(err, ErrUnavailable) || errors.Is(err, ErrTimeout)
+}
+
+// fallbackLoad call loader without cache, return ErrFallbackLimit if there are too many loaders
+func (ca *CacheAside) fallbackLoad(loader func() (string, error)) (string, error) {
+	select {
+	case ca.fallback <- struct{}{}:
+		defer func() { <-ca.fallback }()
+		return loader()
+	default:
+		return "", ErrFallbackLimit
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// testAsideCacher return err from Get and count SetS, the other methods of ICacher are not used by CacheAside.Get
+type testAsideCacher struct {
+	ICacher
+	err  error
+	sets int
+}
+
+func (cacher *testAsideCacher) Get(key string) (string, error) {
+	return "", cacher.err
+}
+
+func (cacher *testAsideCacher) SetS(key string, value string, expire time.Duration) error {
+	cacher.sets++
+	return nil
+}
+
+func TestCacheAsideGet(t *testing.T) {
+	errWrongType := errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	tests := []struct {
+		name         string
+		err          error
+		wantLoad     bool
+		wantSet      bool
+		wantErr      error
+		fullFallback bool
+	}{
+		{"miss load and set", &CacherError{Op: "get", Kind: ErrNotFound}, true, true, nil, false},
+		{"unavailable load without set", &CacherError{Op: "get", Kind: ErrUnavailable}, true, false, nil, false},
+		{"timeout load without set", &CacherError{Op: "get", Kind: ErrTimeout}, true, false, nil, false},
+		{"retries exhausted is unavailable", &CacherError{Op: "get", Kind: ErrRetriesExhausted}, true, false, nil, false},
+		{"reply error is returned", &CacherError{Op: "get", Err: errWrongType}, false, false, errWrongType, false},
+		{"fallback limit", &CacherError{Op: "get", Kind: ErrUnavailable}, false, false, ErrUnavailable, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacher := &testAsideCacher{err: tt.err}
+			aside := NewCacheAside(cacher, 1)
+			if tt.fullFallback {
+				aside.fallback <- struct{}{}
+			}
+			loaded := false
+			val, err := aside.Get("user::alice", time.Minute, func() (string, error) {
+				loaded = true
+				return "alice", nil
+			})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Get error = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil || val != "alice" {
+				t.Fatalf("Get = %q, %v, want alice", val, err)
+			}
+			if loaded != tt.wantLoad {
+				t.Errorf("loader called = %v, want %v", loaded, tt.wantLoad)
+			}
+			if (cacher.sets > 0) != tt.wantSet {
+				t.Errorf("SetS called %d times, want set %v", cacher.sets, tt.wantSet)
+			}
+		})
+	}
+}
@@ -3,9 +3,9 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"runtime"
-	"strings"
 	"sync"
 	"time"
 
@@ -32,6 +32,22 @@ type ICacher interface {
 	HMSet(key string, fieldValues map[string]interface{}) error
 	HGet(key string, field string) (string, error)
 	HMGet(key string, fields []string) ([]interface{}, error)
+	HGetAll(key string) (map[string]string, error)
+	HLen(key string) (int64, error)
+	// HSetStruct set the fields of struct v (tagged with redis:"name") into hash, set only fields if any
+	HSetStruct(key string, v interface{}, expire time.Duration, fields ...string) error
+	// HGetAllInto get every fields of hash into struct pointer v, return ErrNotFound if key does not exists
+	HGetAllInto(key string, v interface{}) error
+	// HSetFieldS set field with its own expire, the expire of the other fields in hash are not changed
+	HSetFieldS(key string, field string, value string, expire time.Duration) error
+	// HGetField get field that is set by HSetFieldS, return ErrNotFound if field is expired
+	HGetField(key string, field string) (string, error)
+	// HGetAllFields get every fields of hash that are not expired
+	HGetAllFields(key string) (map[string]string, error)
+	// HFieldTTL return the remaining time of field, -1 if field has no expire, ErrNotFound if field does not exists
+	HFieldTTL(key string, field string) (time.Duration, error)
+	// ReapExpiredFields delete the expired fields of hash now, return number of deleted fields
+	ReapExpiredFields(key string) (int, error)
 	HDel(key string, fields ...string) error
 	HExists(key string, field string) (bool, error)
 	HFields(key string, pattern string) ([]string, error)
@@ -40,6 +56,8 @@ type ICacher interface {
 	SetS(key string, value string, expire time.Duration) error
 	SetNoExpire(key string, value interface{}) error
 	SetSNoExpire(key string, value string) error
+	// SetNX set value only if key does not exist, return false if key exists
+	SetNX(key string, value string, expire time.Duration) (bool, error)
 	IncrBy(key string, val int) (int, error)
 	DecrBy(key string, val int) (int, error)
 	Incr(key string) (int, error)
@@ -58,15 +76,39 @@ type ICacher interface {
 
 	Close() error
 
+	// Primary return cacher that read from primary, use it to read your own writes
+	Primary() ICacher
+
+	// RetryStats return the retry counts by command
+	RetryStats() map[string]RetryStats
+
+	// WithContext return cacher that run commands with ctx, hooks receive ctx (eg. the trace id of request)
+	WithContext(ctx context.Context) ICacher
+	// AddHook add hook that is called before and after every commands
+	AddHook(hook ICacherHook)
+	// CommandStats return the command counts and latency by key prefix
+	CommandStats() map[string]CommandStats
+	// SlowCommands return the latest commands that are slower than SlowCommandThreshold
+	SlowCommands() []*SlowCommand
+
 	// Keys might return value that match the pattern, because it use HScan internally
 	Keys(pattern string) ([]string, error)
+	// Scan return one page of keys that match the pattern, use it to sample keys without scan every keys
+	Scan(cursor uint64, pattern string, count int64) ([]string, uint64 /*next cursor*/, error)
+	// DBSize return the number of keys in DB, it include the keys of other services that share the DB
+	DBSize() (int64, error)
 }
 
 // ICacherConfig is cacher configuration interface
 type ICacherConfig interface {
 	Endpoint() string
+	// ReplicaEndpoints is the read replicas, read commands are routed to replicas if not empty
+	ReplicaEndpoints() []string
 	Password() string
 	DB() int
+	// KeyPrefix is the namespace of service, it is added to every keys and channels, eg. lesson5.1:
+	// so the services that share redis DB do not see (or delete) the keys of each others
+	KeyPrefix() string
 	ConnectionSettings() ICacherConnectionSettings
 }
 
@@ -82,6 +124,20 @@ type ICacherConnectionSettings interface {
 	PoolTimeout() time.Duration
 	ReadTimeout() time.Duration
 	WriteTimeout() time.Duration
+	ReplicaRouting() ReplicaRouting
+	// BreakerFailureThreshold is the consecutive connection failures that open the circuit, 0 means no circuit breaker
+	BreakerFailureThreshold() int
+	// BreakerOpenTimeout is the time that circuit is open before let the calls try again (half open)
+	BreakerOpenTimeout() time.Duration
+	// BreakerHalfOpenMaxCalls is the number of calls that are allowed while circuit is half open
+	BreakerHalfOpenMaxCalls() int
+	// RetryPolicy is how the failed commands are retried by cacher
+	RetryPolicy() *RetryPolicy
+	// SlowCommandThreshold is the duration that command is logged as slow command, 0 means no slow log
+	SlowCommandThreshold() time.Duration
+	// NativeFieldExpire use HPEXPIRE for the field expire of HSetFieldS if redis support it (7.4+),
+	// false always emulate the field expire with sorted set of field deadlines
+	NativeFieldExpire() bool
 }
 
 // DefaultCacherConnectionSettings contains default connection settings, this intend to use as embed struct
@@ -99,8 +155,10 @@ func (setting *DefaultCacherConnectionSettings) MinIdleConns() int {
 	return 5
 }
 
+// MaxRetries is the retries of go-redis, -1 disable it because go-redis retry every commands
+// include Incr, the commands are retried by RetryPolicy instead
 func (setting *DefaultCacherConnectionSettings) MaxRetries() int {
-	return 3
+	return -1
 }
 
 func (setting *DefaultCacherConnectionSettings) MinRetryBackoff() time.Duration {
@@ -131,9 +189,39 @@ func (setting *DefaultCacherConnectionSettings) WriteTimeout() time.Duration {
 	return time.Minute
 }
 
+func (setting *DefaultCacherConnectionSettings) ReplicaRouting() ReplicaRouting {
+	return ReplicaRoutingRoundRobin
+}
+
+func (setting *DefaultCacherConnectionSettings) BreakerFailureThreshold() int {
+	return 3
+}
+
+func (setting *DefaultCacherConnectionSettings) BreakerOpenTimeout() time.Duration {
+	return 5 * time.Second
+}
+
+func (setting *DefaultCacherConnectionSettings) BreakerHalfOpenMaxCalls() int {
+	return 1
+}
+
+func (setting *DefaultCacherConnectionSettings) RetryPolicy() *RetryPolicy {
+	return NewDefaultRetryPolicy()
+}
+
+func (setting *DefaultCacherConnectionSettings) SlowCommandThreshold() time.Duration {
+	return 50 * time.Millisecond
+}
+
+func (setting *DefaultCacherConnectionSettings) NativeFieldExpire() bool {
+	return true
+}
+
 type pubsubChannels struct {
 	ps       *redis.PubSub
 	channels []string
+	// done is closed by Unsub to stop the forwarder of messages
+	done chan struct{}
 }
 
 // Cacher is the struct for cache service
@@ -144,21 +232,130 @@ type Cacher struct {
 	oldClients  []*redis.Client
 	subsribers  *sync.Map
 	serviceID   int
+	replicas    *replicaRouter
+	breaker     *circuitBreaker
+	retries     *retryMetrics
+	hooks       *cacherHooks
+	stats       *CommandStatsHook
+	slowLog     *SlowLogHook
+	fieldTTL    *fieldTTL
+	readPrimary bool
+	// ctx is passed to every commands, it is set when this cacher is created by WithContext()
+	ctx context.Context
+	// parent is the cacher that own the client, it is set when this cacher is created by Primary() or WithContext()
+	parent *Cacher
 }
 
 // NewCacher return new Cacher
 func NewCacher(config ICacherConfig) *Cacher {
+	hooks := &cacherHooks{}
+	stats := NewCommandStatsHook()
+	stats.namespace = config.KeyPrefix()
+	hooks.add(stats)
+	var slowLog *SlowLogHook
+	if threshold := config.ConnectionSettings().SlowCommandThreshold(); threshold > 0 {
+		slowLog = NewSlowLogHook(threshold, 100)
+		hooks.add(slowLog)
+	}
+
+	replicas := newReplicaRouter(config)
+	replicas.hook = hooks
 	return &Cacher{
 		config:     config,
 		oldClients: nil,
 		subsribers: &sync.Map{},
+		replicas:   replicas,
+		breaker:    newCircuitBreaker(config.ConnectionSettings()),
+		retries:    &retryMetrics{},
+		hooks:      hooks,
+		stats:      stats,
+		slowLog:    slowLog,
+		fieldTTL:   newFieldTTL(),
+		ctx:        context.Background(),
+	}
+}
+
+// context return the context that commands run with
+func (cache *Cacher) context() context.Context {
+	if cache.ctx == nil {
+		return context.Background()
+	}
+	return cache.ctx
+}
+
+// root return the cacher that own the client
+func (cache *Cacher) root() *Cacher {
+	if cache.parent != nil {
+		return cache.parent
+	}
+	return cache
+}
+
+// WithContext return cacher that run commands with ctx, the client is shared with this cacher
+func (cache *Cacher) WithContext(ctx context.Context) ICacher {
+	return &Cacher{
+		config:      cache.config,
+		subsribers:  cache.subsribers,
+		replicas:    cache.replicas,
+		hooks:       cache.hooks,
+		readPrimary: cache.readPrimary,
+		ctx:         ctx,
+		parent:      cache.root(),
+	}
+}
+
+// AddHook add hook that is called before and after every commands, include commands of replicas
+func (cache *Cacher) AddHook(hook ICacherHook) {
+	cache.hooks.add(hook)
+}
+
+// CommandStats return the command counts and latency by key prefix
+func (cache *Cacher) CommandStats() map[string]CommandStats {
+	return cache.root().stats.Snapshot()
+}
+
+// SlowCommands return the latest commands that are slower than SlowCommandThreshold
+func (cache *Cacher) SlowCommands() []*SlowCommand {
+	slowLog := cache.root().slowLog
+	if slowLog == nil {
+		return []*SlowCommand{}
+	}
+	return slowLog.Latest()
+}
+
+// RetryStats return the retry counts by command
+func (cache *Cacher) RetryStats() map[string]RetryStats {
+	if cache.parent != nil {
+		return cache.parent.RetryStats()
+	}
+	return cache.retries.Snapshot()
+}
+
+// CircuitState return the state of circuit breaker of this cacher endpoint
+func (cache *Cacher) CircuitState() CircuitState {
+	if cache.parent != nil {
+		return cache.parent.CircuitState()
+	}
+	return cache.breaker.State()
+}
+
+// Primary return cacher that read from primary, use it to read your own writes
+func (cache *Cacher) Primary() ICacher {
+	return &Cacher{
+		config:      cache.config,
+		subsribers:  cache.subsribers,
+		replicas:    cache.replicas,
+		hooks:       cache.hooks,
+		readPrimary: true,
+		ctx:         cache.ctx,
+		parent:      cache.root(),
 	}
 }
 
 func (cache *Cacher) newClient() *redis.Client {
 	cfg := cache.config
 	settings := cfg.ConnectionSettings()
-	return redis.NewClient(&redis.Options{
+	client := redis.NewClient(&redis.Options{
 		Addr:               cfg.Endpoint(),
 		Password:           cfg.Password(),
 		DB:                 cfg.DB(),
@@ -173,41 +370,82 @@ func (cache *Cacher) newClient() *redis.Client {
 		ReadTimeout:        settings.ReadTimeout(),
 		WriteTimeout:       settings.WriteTimeout(),
 	})
+	// The keys are prefixed before cacher hooks, so the hooks see the keys that are sent to redis
+	cache.addKeyPrefixHook(client)
+	client.AddHook(cache.hooks)
+	return client
 }
 
+// getClient return the connected client, it try to connect only once,
+// the retry and circuit breaker are done by do()
 func (cache *Cacher) getClient() (*redis.Client, error) {
+	if cache.parent != nil {
+		return cache.parent.getClient()
+	}
+
 	cache.clientMutex.Lock()
 	defer cache.clientMutex.Unlock()
 
-	retriesDelayMs := cache.getRetriesDelayInMs()
-	retries := -1
-	for {
-		retries++
-		if retries > len(retriesDelayMs)-1 {
-			return nil, fmt.Errorf("cacher: retry exceed limits")
-		}
+	// The circuit may be opened by the call that hold the lock before
+	if cache.breaker.State() == CircuitOpen {
+		return nil, newCacherError("connect", ErrCircuitOpen)
+	}
 
-		client := cache.client
-		if client == nil {
-			client = cache.newClient()
-			cache.client = client
-		}
+	client := cache.client
+	if client == nil {
+		client = cache.newClient()
+		cache.client = client
+	}
 
-		_, err := client.Ping(context.Background()).Result()
-		if err != nil {
-			// Wait by retry delay then reset client and try connect again
-			time.Sleep(time.Millisecond * time.Duration(retriesDelayMs[retries]))
-			cache.client = nil
-			continue
+	_, err := client.Ping(context.Background()).Result()
+	if err != nil {
+		// Reset client, so the next call will connect again,
+		// the client might still run commands of other callers, so it is closed after they are done
+		cache.client = nil
+		go closeWhenDrained(client)
+		return nil, newCacherError("connect", err)
+	}
+
+	// If we can PING without error, just return
+	return client, nil
+}
+
+const (
+	drainCheckInterval = 100 * time.Millisecond
+	drainTimeout       = 30 * time.Second
+)
+
+// closeWhenDrained close client when no connection is used by commands, or when drainTimeout is passed
+func closeWhenDrained(client *redis.Client) {
+	deadline := time.Now().Add(drainTimeout)
+	for time.Now().Before(deadline) {
+		stats := client.PoolStats()
+		if stats.TotalConns == stats.IdleConns {
+			break
 		}
+		time.Sleep(drainCheckInterval)
+	}
 
-		// If we can PING without error, just return
-		return client, nil
+	err := client.Close()
+	if err != nil {
+		fmt.Println("cacher:", err.Error())
 	}
 }
 
 // Close close the redis client
 func (cache *Cacher) Close() error {
+	// The client is owned by parent, so parent will close it
+	if cache.parent != nil {
+		return nil
+	}
+
+	cache.fieldTTL.close()
+
+	err := cache.replicas.Close()
+	if err != nil {
+		return newCacherError("Close", err)
+	}
+
 	cache.clientMutex.Lock()
 	defer cache.clientMutex.Unlock()
 
@@ -218,14 +456,14 @@ func (cache *Cacher) Close() error {
 
 		err := client.Close()
 		if err != nil {
-			return err
+			return newCacherError("Close", err)
 		}
 
 		// Close old clients
 		for _, client := range cache.oldClients {
 			err := client.Close()
 			if err != nil {
-				return err
+				return newCacherError("Close", err)
 			}
 		}
 		if len(cache.oldClients) > 0 {
@@ -238,100 +476,136 @@ func (cache *Cacher) Close() error {
 
 // Keys returns keys by given pattern
 func (cache *Cacher) Keys(pattern string) ([]string, error) {
+	var keys []string
+	err := cache.read("Keys", func(c *redis.Client) error {
+		var err error
+		keys, err = cache.keys(c, pattern)
+		return err
+	})
+	if err != nil {
+		return nil, newCacherError("Keys", err)
+	}
+	return keys, nil
+}
 
-	c, err := cache.getClient()
+// Scan return one page of keys that match the pattern, the next cursor is 0 when scan is done
+func (cache *Cacher) Scan(cursor uint64, pattern string, count int64) ([]string, uint64, error) {
+	var keys []string
+	var nextCursor uint64
+	err := cache.read("Scan", func(c *redis.Client) error {
+		var err error
+		keys, nextCursor, err = c.Scan(cache.context(), cursor, pattern, count).Result()
+		return err
+	})
 	if err != nil {
-		return nil, err
+		return nil, 0, newCacherError("Scan", err)
 	}
+	for i, key := range keys {
+		keys[i] = cache.unprefixKey(key)
+	}
+	return keys, nextCursor, nil
+}
 
-	allKeys := map[string]interface{}{}
+// DBSize return the number of keys in DB, KeyPrefix is not applied because DBSIZE count every keys
+func (cache *Cacher) DBSize() (int64, error) {
+	var size int64
+	err := cache.read("DBSize", func(c *redis.Client) error {
+		var err error
+		size, err = c.DBSize(cache.context()).Result()
+		return err
+	})
+	if err != nil {
+		return 0, newCacherError("DBSize", err)
+	}
+	return size, nil
+}
 
-	var nextCursor uint64
-	var keys []string
+// keys scan every pages, the failed scan is retried from the first page by RetryPolicy
+func (cache *Cacher) keys(c *redis.Client, pattern string) ([]string, error) {
 
-	retryLimit := 3
-	for {
-		retryLimit--
-		if retryLimit < 0 {
-			return nil, err
-		}
+	// Scan can return duplidate item, so we use map to collect result set
+	allKeys := map[string]interface{}{}
 
-		keys, nextCursor, err = c.Scan(context.Background(), 0, pattern, 100).Result()
+	var cursor uint64
+	for {
+		keys, nextCursor, err := c.Scan(cache.context(), cursor, pattern, 100).Result()
 		if err != nil {
-			continue
+			return nil, err
 		}
-		// Scan can return duplidate item, so we use map to collect result set
 		for _, key := range keys {
 			allKeys[key] = struct{}{}
 		}
 
-		break // break retryLimit
-	}
-
-	for {
 		if nextCursor == 0 {
 			break
 		}
-
-		retryLimit := 3
-		for {
-
-			retryLimit--
-			if retryLimit < 0 {
-				return nil, err
-			}
-
-			keys, nextCursor, err = c.Scan(context.Background(), nextCursor, pattern, 100).Result()
-			if err != nil {
-				continue
-			}
-
-			// Scan can return duplidate item, so we use map to collect result set
-			for _, key := range keys {
-				allKeys[key] = struct{}{}
-			}
-
-			break // retryLimit
-		}
-
+		cursor = nextCursor
 	}
 
+	// The key prefix is removed, so the keys can be passed to other commands
 	retKeys := []string{}
 	for key := range allKeys {
-		retKeys = append(retKeys, key)
+		retKeys = append(retKeys, cache.unprefixKey(key))
 	}
 	return retKeys, nil
 }
 
-// getRetriesDelayInMs sum only 1 second
-func (cache *Cacher) getRetriesDelayInMs() []int {
-	return []int{200, 200, 200, 200, 200}
+// read run read command on replica, fallback to primary if there is no replica or replica failed
+func (cache *Cacher) read(op string, cmd func(c *redis.Client) error) error {
+	err := cache.readReplica(cmd)
+	if err == nil || err == redis.Nil {
+		return err
+	}
+	if err == errReplicaClosed {
+		return newCacherError(op, err)
+	}
+	return cache.do(op, cmd)
 }
 
-func (cache *Cacher) isNoConnectionError(err error) bool {
-	if err == nil {
-		return false
+// readReplica run read command on replica, return errNoReplica if there is no replica to read
+func (cache *Cacher) readReplica(cmd func(c *redis.Client) error) error {
+	if cache.readPrimary {
+		return errNoReplica
+	}
+	replica, err := cache.replicas.pick()
+	if err != nil {
+		return err
+	}
+	if replica == nil {
+		return errNoReplica
 	}
 
-	errMsgLower := strings.ToLower(err.Error())
-	if strings.Contains(errMsgLower, "connect: connection refused") {
-		return true
+	start := time.Now()
+	err = cmd(replica.client)
+	if err != nil && err != redis.Nil {
+		// Only the connection error take replica out of rotation,
+		// the command error (eg. errNoBitFieldRO) just fallback to primary
+		if cache.isReplicaDownError(err) {
+			replica.markDown()
+		}
+		return err
 	}
+	replica.recordLatency(time.Since(start))
+	return err
+}
 
-	return false
+func (cache *Cacher) isReplicaDownError(err error) bool {
+	return classifyNetworkError(err) != nil
 }
 
+var errNoReplica = errors.New("cacher: no replica")
+
 // Exists check if key is exists
 func (cache *Cacher) Exists(key string) (bool, error) {
 
-	c, err := cache.getClient()
-	if err != nil {
-		return false, err
-	}
-
-	val, err := c.Exists(context.Background(), key).Result()
+	var val int64
+	err := cache.read("Exists", func(c *redis.Client) error {
+		var err error
+		val, err = c.Exists(cache.context(), key).Result()
+		return err
+	})
 	if err != nil {
-		return false, err
+		return false, newCacherError("Exists", err)
 	}
 
 	// val == 1 means key is exists
@@ -344,11 +618,6 @@ func (cache *Cacher) Del(keys ...string) error {
 		return nil
 	}
 
-	c, err := cache.getClient()
-	if err != nil {
-		return err
-	}
-
 	// Delete 10000 items per page
 	pageLimit := 10000
 	from := 0
@@ -369,12 +638,14 @@ func (cache *Cacher) Del(keys ...string) error {
 			break
 		}
 
-		_, err = c.Del(context.Background(), delKeys...).Result()
+		err := cache.do("Del", func(c *redis.Client) error {
+			return c.Del(cache.context(), delKeys...).Err()
+		})
 		if err != nil {
 			if err == redis.Nil {
 				continue
 			} else {
-				return err
+				return newCacherError("Del", err)
 			}
 		}
 		from += pageLimit
@@ -387,25 +658,22 @@ func (cache *Cacher) Del(keys ...string) error {
 // Expires set expiration for objects in cache
 // if there is error happen, just return last error
 func (cache *Cacher) Expires(keys []string, expire time.Duration) error {
-	return cache.expires(keys, expire)
+	return newCacherError("Expires", cache.expires(keys, expire))
 }
 
 // Expire set expiration for object in cache
 func (cache *Cacher) Expire(key string, expire time.Duration) error {
-	return cache.expires([]string{key}, expire)
+	return newCacherError("Expire", cache.expires([]string{key}, expire))
 }
 
 // Expires set expiration for objects in cache
 // if there is error happen, just return last error
 func (cache *Cacher) expires(keys []string, expire time.Duration) error {
-	c, err := cache.getClient()
-	if err != nil {
-		return err
-	}
-
 	var lastErr error
 	for _, key := range keys {
-		err = c.Expire(context.Background(), key, expire).Err()
+		err := cache.do("Expire", func(c *redis.Client) error {
+			return c.Expire(cache.context(), key, expire).Err()
+		})
 		if err != nil {
 			if err == redis.Nil {
 				// Key does not exists
@@ -421,36 +689,34 @@ func (cache *Cacher) expires(keys []string, expire time.Duration) error {
 // MGet get by multiple keys, the value can be nil, so it will return []interface{} instead of []string
 func (cache *Cacher) MGet(keys []string) ([]interface{}, error) {
 
-	c, err := cache.getClient()
-	if err != nil {
-		return nil, err
-	}
-
-	vals, err := c.MGet(context.Background(), keys...).Result()
+	var vals []interface{}
+	err := cache.read("MGet", func(c *redis.Client) error {
+		var err error
+		vals, err = c.MGet(cache.context(), keys...).Result()
+		return err
+	})
 	if err == redis.Nil {
 		// Key does not exists
 		return nil, nil
 	} else if err != nil {
-		return nil, err
+		return nil, newCacherError("MGet", err)
 	}
 
 	return vals, nil
 }
 
-// Get object from cache
+// Get object from cache, return ErrNotFound if key does not exists
 func (cache *Cacher) Get(key string) (string, error) {
 
-	c, err := cache.getClient()
+	var val string
+	err := cache.read("Get", func(c *redis.Client) error {
+		var err error
+		val, err = c.Get(cache.context(), key).Result()
+		return err
+	})
 	if err != nil {
-		return "", err
-	}
-
-	val, err := c.Get(context.Background(), key).Result()
-	if err == redis.Nil {
-		// Key does not exists
-		return "", nil
-	} else if err != nil {
-		return "", err
+		// Key does not exists is ErrNotFound
+		return "", newCacherError("Get", err)
 	}
 
 	return val, nil
@@ -459,11 +725,6 @@ func (cache *Cacher) Get(key string) (string, error) {
 // MSet set multiple key value
 func (cache *Cacher) MSet(kv map[string]interface{}) error {
 
-	c, err := cache.getClient()
-	if err != nil {
-		return err
-	}
-
 	pairs := []interface{}{}
 	for k, v := range kv {
 
@@ -481,14 +742,16 @@ func (cache *Cacher) MSet(kv map[string]interface{}) error {
 
 		strb, err := json.Marshal(v)
 		if err != nil {
-			return err
+			return newCacherError("MSet", err)
 		}
 		pairs = append(pairs, k, strb)
 	}
 
-	err = c.MSet(context.Background(), pairs...).Err()
+	err := cache.do("MSet", func(c *redis.Client) error {
+		return c.MSet(cache.context(), pairs...).Err()
+	})
 	if err != nil {
-		return err
+		return newCacherError("MSet", err)
 	}
 
 	return nil
@@ -497,17 +760,17 @@ func (cache *Cacher) MSet(kv map[string]interface{}) error {
 // Decr minus 1 to a counter on key, return first counter (-1) if cache expire
 func (cache *Cacher) Decr(key string) (int, error) {
 
-	c, err := cache.getClient()
-	if err != nil {
-		return 0, err
-	}
-
-	val, err := c.Decr(context.Background(), key).Result()
+	var val int64
+	err := cache.do("Decr", func(c *redis.Client) error {
+		var err error
+		val, err = c.Decr(cache.context(), key).Result()
+		return err
+	})
 	if err == redis.Nil {
 		// Key does not exists
 		return 0, nil
 	} else if err != nil {
-		return 0, err
+		return 0, newCacherError("Decr", err)
 	}
 
 	return int(val), nil
@@ -516,17 +779,17 @@ func (cache *Cacher) Decr(key string) (int, error) {
 // Incr do a counter on key, return first counter if cache expire
 func (cache *Cacher) Incr(key string) (int, error) {
 
-	c, err := cache.getClient()
-	if err != nil {
-		return 0, err
-	}
-
-	val, err := c.Incr(context.Background(), key).Result()
+	var val int64
+	err := cache.do("Incr", func(c *redis.Client) error {
+		var err error
+		val, err = c.Incr(cache.context(), key).Result()
+		return err
+	})
 	if err == redis.Nil {
 		// Key does not exists
 		return 0, nil
 	} else if err != nil {
-		return 0, err
+		return 0, newCacherError("Incr", err)
 	}
 
 	return int(val), nil
@@ -535,17 +798,17 @@ func (cache *Cacher) Incr(key string) (int, error) {
 // decrBy decrement the value on key by given value, return first -value if cache expire
 func (cache *Cacher) DecrBy(key string, value int) (int, error) {
 
-	c, err := cache.getClient()
-	if err != nil {
-		return 0, err
-	}
-
-	val, err := c.DecrBy(context.Background(), key, int64(value)).Result()
+	var val int64
+	err := cache.do("DecrBy", func(c *redis.Client) error {
+		var err error
+		val, err = c.DecrBy(cache.context(), key, int64(value)).Result()
+		return err
+	})
 	if err == redis.Nil {
 		// Key does not exists
 		return 0, nil
 	} else if err != nil {
-		return 0, err
+		return 0, newCacherError("DecrBy", err)
 	}
 
 	return int(val), nil
@@ -554,17 +817,17 @@ func (cache *Cacher) DecrBy(key string, value int) (int, error) {
 // IncrBy increment the value on key by given value, return first value if cache expire
 func (cache *Cacher) IncrBy(key string, value int) (int, error) {
 
-	c, err := cache.getClient()
-	if err != nil {
-		return 0, err
-	}
-
-	val, err := c.IncrBy(context.Background(), key, int64(value)).Result()
+	var val int64
+	err := cache.do("IncrBy", func(c *redis.Client) error {
+		var err error
+		val, err = c.IncrBy(cache.context(), key, int64(value)).Result()
+		return err
+	})
 	if err == redis.Nil {
 		// Key does not exists
 		return 0, nil
 	} else if err != nil {
-		return 0, err
+		return 0, newCacherError("IncrBy", err)
 	}
 
 	return int(val), nil
@@ -573,19 +836,16 @@ func (cache *Cacher) IncrBy(key string, value int) (int, error) {
 // SetSNoExpire set value as string into cache no expired
 func (cache *Cacher) SetSNoExpire(key string, value string) error {
 
-	c, err := cache.getClient()
-	if err != nil {
-		return err
-	}
-
 	// 0 = no expired
-	err = c.Set(context.Background(), key, value, 0).Err()
+	err := cache.do("SetSNoExpire", func(c *redis.Client) error {
+		return c.Set(cache.context(), key, value, 0).Err()
+	})
 	if err != nil {
 		if err == redis.Nil {
 			// Key does not exists
 			return nil
 		} else {
-			return err
+			return newCacherError("SetSNoExpire", err)
 		}
 	}
 
@@ -595,24 +855,21 @@ func (cache *Cacher) SetSNoExpire(key string, value string) error {
 // SetNoExpire set object into cache no expired
 func (cache *Cacher) SetNoExpire(key string, value interface{}) error {
 
-	c, err := cache.getClient()
-	if err != nil {
-		return err
-	}
-
 	str, err := json.Marshal(value)
 	if err != nil {
-		return err
+		return newCacherError("SetNoExpire", err)
 	}
 
 	// 0 = no expired
-	err = c.Set(context.Background(), key, str, 0).Err()
+	err = cache.do("SetNoExpire", func(c *redis.Client) error {
+		return c.Set(cache.context(), key, str, 0).Err()
+	})
 	if err != nil {
 		if err == redis.Nil {
 			// Key does not exists
 			return nil
 		} else {
-			return err
+			return newCacherError("SetNoExpire", err)
 		}
 	}
 
@@ -622,38 +879,47 @@ func (cache *Cacher) SetNoExpire(key string, value interface{}) error {
 // SetS set string into cache
 func (cache *Cacher) SetS(key string, value string, expire time.Duration) error {
 
-	c, err := cache.getClient()
-	if err != nil {
-		return err
-	}
-
-	err = c.Set(context.Background(), key, value, expire).Err()
+	err := cache.do("SetS", func(c *redis.Client) error {
+		return c.Set(cache.context(), key, value, expire).Err()
+	})
 	if err != nil {
-		return err
+		return newCacherError("SetS", err)
 	}
 
 	return nil
 }
 
-func (cache *Cacher) Set(key string, value interface{}, expire time.Duration) error {
+// SetNX set value only if key does not exist, return false if key exists
+func (cache *Cacher) SetNX(key string, value string, expire time.Duration) (bool, error) {
 
-	c, err := cache.getClient()
-	if err != nil {
+	var ok bool
+	err := cache.do("SetNX", func(c *redis.Client) error {
+		var err error
+		ok, err = c.SetNX(cache.context(), key, value, expire).Result()
 		return err
+	})
+	if err != nil {
+		return false, newCacherError("SetNX", err)
 	}
+	return ok, nil
+}
+
+func (cache *Cacher) Set(key string, value interface{}, expire time.Duration) error {
 
 	str, err := json.Marshal(value)
 	if err != nil {
-		return err
+		return newCacherError("Set", err)
 	}
 
-	err = c.Set(context.Background(), key, str, expire).Err()
+	err = cache.do("Set", func(c *redis.Client) error {
+		return c.Set(cache.context(), key, str, expire).Err()
+	})
 	if err != nil {
 		if err == redis.Nil {
 			// Key does not exists
 			return nil
 		} else {
-			return err
+			return newCacherError("Set", err)
 		}
 	}
 
@@ -663,76 +929,56 @@ func (cache *Cacher) Set(key string, value interface{}, expire time.Duration) er
 func (cache *Cacher) HScan(
 	key string, cursor uint64, fieldPattern string, count int64) ([]string, uint64 /*next cursor*/, error) {
 
-	c, err := cache.getClient()
-	if err != nil {
-		return nil, 0, err
-	}
-
-	fields, nextCursor, err := c.HScan(context.Background(), key, cursor, fieldPattern, count).Result()
+	var fields []string
+	var nextCursor uint64
+	err := cache.read("HScan", func(c *redis.Client) error {
+		var err error
+		fields, nextCursor, err = c.HScan(cache.context(), key, cursor, fieldPattern, count).Result()
+		return err
+	})
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, newCacherError("HScan", err)
 	}
 
 	return fields, nextCursor, nil
 }
 
 func (cache *Cacher) HFields(key string, pattern string) ([]string, error) {
-
-	c, err := cache.getClient()
+	var fields []string
+	err := cache.read("HFields", func(c *redis.Client) error {
+		var err error
+		fields, err = cache.hfields(c, key, pattern)
+		return err
+	})
 	if err != nil {
-		return nil, err
+		return nil, newCacherError("HFields", err)
 	}
+	return fields, nil
+}
 
+// hfields scan every pages, the failed scan is retried from the first page by RetryPolicy
+func (cache *Cacher) hfields(c *redis.Client, key string, pattern string) ([]string, error) {
+
+	// Scan can return duplidate item, so we use map to collect result set
 	allFields := map[string]interface{}{}
-	var nextCursor uint64
-	var fields []string
 
-	retryLimit := 3
+	var cursor uint64
 	for {
-		retryLimit--
-		if retryLimit < 0 {
-			return nil, err
-		}
-		fields, nextCursor, err = c.HScan(context.Background(), key, 0, pattern, 100).Result()
+		fields, nextCursor, err := c.HScan(cache.context(), key, cursor, pattern, 100).Result()
 		if err != nil {
-			continue
+			return nil, err
 		}
-
-		// Scan can return duplidate item, so we use map to collect result set
+		// HScan return field and value, so take only the field
 		for i, field := range fields {
 			if i%2 == 0 {
 				allFields[field] = struct{}{}
 			}
 		}
-		break // retryLimit
-	}
 
-	for {
 		if nextCursor == 0 {
 			break
 		}
-
-		retryLimit := 3
-		for {
-			retryLimit--
-			if retryLimit < 0 {
-				return nil, err
-			}
-
-			fields, nextCursor, err = c.HScan(context.Background(), key, nextCursor, pattern, 100).Result()
-			if err != nil {
-				continue
-			}
-
-			// Scan can return duplidate item, so we use map to collect result set
-			for i, field := range fields {
-				if i%2 == 0 {
-					allFields[field] = struct{}{}
-				}
-			}
-
-			break // retryLimit
-		}
+		cursor = nextCursor
 	}
 
 	retFields := []string{}
@@ -745,18 +991,18 @@ func (cache *Cacher) HFields(key string, pattern string) ([]string, error) {
 // HExists check if key is exists
 func (cache *Cacher) HExists(key string, field string) (bool, error) {
 
-	c, err := cache.getClient()
-	if err != nil {
-		return false, err
-	}
-
-	val, err := c.HExists(context.Background(), key, field).Result()
+	var val bool
+	err := cache.do("HExists", func(c *redis.Client) error {
+		var err error
+		val, err = c.HExists(cache.context(), key, field).Result()
+		return err
+	})
 	if err != nil {
 		if err == redis.Nil {
 			// Key does not exists
 			return false, nil
 		} else {
-			return false, err
+			return false, newCacherError("HExists", err)
 		}
 	}
 
@@ -766,38 +1012,33 @@ func (cache *Cacher) HExists(key string, field string) (bool, error) {
 // Del the cache by keys
 func (cache *Cacher) HDel(key string, fields ...string) error {
 
-	c, err := cache.getClient()
-	if err != nil {
-		return err
-	}
-
-	_, err = c.HDel(context.Background(), key, fields...).Result()
+	err := cache.do("HDel", func(c *redis.Client) error {
+		return c.HDel(cache.context(), key, fields...).Err()
+	})
 	if err != nil {
 		if err == redis.Nil {
 			// Key does not exists
 			return nil
 		} else {
-			return err
+			return newCacherError("HDel", err)
 		}
 	}
 
 	return nil
 }
 
-// HGet object from cache
+// HGet object from cache, return ErrNotFound if key or field does not exists
 func (cache *Cacher) HGet(key string, field string) (string, error) {
 
-	c, err := cache.getClient()
+	var val string
+	err := cache.read("HGet", func(c *redis.Client) error {
+		var err error
+		val, err = c.HGet(cache.context(), key, field).Result()
+		return err
+	})
 	if err != nil {
-		return "", err
-	}
-
-	val, err := c.HGet(context.Background(), key, field).Result()
-	if err == redis.Nil {
-		// Key does not exists
-		return "", nil
-	} else if err != nil {
-		return "", err
+		// Key does not exists is ErrNotFound
+		return "", newCacherError("HGet", err)
 	}
 
 	return val, nil
@@ -806,37 +1047,72 @@ func (cache *Cacher) HGet(key string, field string) (string, error) {
 // HMGet get by multiple keys, the value can be nil, so it will return []interface{} instead of []string
 func (cache *Cacher) HMGet(key string, fields []string) ([]interface{}, error) {
 
-	c, err := cache.getClient()
-	if err != nil {
-		return nil, err
+	var vals []interface{}
+	err := cache.read("HMGet", func(c *redis.Client) error {
+		var err error
+		vals, err = c.HMGet(cache.context(), key, fields...).Result()
+		return err
+	})
+	if err == redis.Nil {
+		// Key does not exists
+		return nil, nil
+	} else if err != nil {
+		return nil, newCacherError("HMGet", err)
 	}
 
-	vals, err := c.HMGet(context.Background(), key, fields...).Result()
+	return vals, nil
+}
+
+// HGetAll get every fields of hash, return empty map if key does not exists
+func (cache *Cacher) HGetAll(key string) (map[string]string, error) {
+
+	var vals map[string]string
+	err := cache.read("HGetAll", func(c *redis.Client) error {
+		var err error
+		vals, err = c.HGetAll(cache.context(), key).Result()
+		return err
+	})
 	if err == redis.Nil {
 		// Key does not exists
-		return nil, nil
+		return map[string]string{}, nil
 	} else if err != nil {
-		return nil, err
+		return nil, newCacherError("HGetAll", err)
 	}
 
 	return vals, nil
 }
 
-// HMSet set multiple key value
-func (cache *Cacher) HMSet(key string, fieldValues map[string]interface{}) error {
+// HLen return number of fields in hash, return 0 if key does not exists
+func (cache *Cacher) HLen(key string) (int64, error) {
 
-	c, err := cache.getClient()
-	if err != nil {
+	var val int64
+	err := cache.read("HLen", func(c *redis.Client) error {
+		var err error
+		val, err = c.HLen(cache.context(), key).Result()
 		return err
+	})
+	if err == redis.Nil {
+		// Key does not exists
+		return 0, nil
+	} else if err != nil {
+		return 0, newCacherError("HLen", err)
 	}
 
-	err = c.HMSet(context.Background(), key, fieldValues).Err()
+	return val, nil
+}
+
+// HMSet set multiple key value
+func (cache *Cacher) HMSet(key string, fieldValues map[string]interface{}) error {
+
+	err := cache.do("HMSet", func(c *redis.Client) error {
+		return c.HMSet(cache.context(), key, fieldValues).Err()
+	})
 	if err != nil {
 		if err == redis.Nil {
 			// Key does not exists
 			return nil
 		} else {
-			return err
+			return newCacherError("HMSet", err)
 		}
 	}
 
@@ -846,17 +1122,17 @@ func (cache *Cacher) HMSet(key string, fieldValues map[string]interface{}) error
 // HDecr minus 1 to a counter on key, return first counter (-1) if cache expire
 func (cache *Cacher) HDecr(key string, field string) (int, error) {
 
-	c, err := cache.getClient()
-	if err != nil {
-		return 0, err
-	}
-
-	val, err := c.HIncrBy(context.Background(), key, field, -1).Result()
+	var val int64
+	err := cache.do("HDecr", func(c *redis.Client) error {
+		var err error
+		val, err = c.HIncrBy(cache.context(), key, field, -1).Result()
+		return err
+	})
 	if err == redis.Nil {
 		// Key does not exists
 		return 0, nil
 	} else if err != nil {
-		return 0, err
+		return 0, newCacherError("HDecr", err)
 	}
 
 	return int(val), nil
@@ -865,17 +1141,17 @@ func (cache *Cacher) HDecr(key string, field string) (int, error) {
 // Incr do a counter on key, return first counter if cache expire
 func (cache *Cacher) HIncr(key string, field string) (int, error) {
 
-	c, err := cache.getClient()
-	if err != nil {
-		return 0, err
-	}
-
-	val, err := c.HIncrBy(context.Background(), key, field, 1).Result()
+	var val int64
+	err := cache.do("HIncr", func(c *redis.Client) error {
+		var err error
+		val, err = c.HIncrBy(cache.context(), key, field, 1).Result()
+		return err
+	})
 	if err == redis.Nil {
 		// Key does not exists
 		return 0, nil
 	} else if err != nil {
-		return 0, err
+		return 0, newCacherError("HIncr", err)
 	}
 
 	return int(val), nil
@@ -884,17 +1160,17 @@ func (cache *Cacher) HIncr(key string, field string) (int, error) {
 // HDecrBy decrement the value on key by given value, return first -value if cache expire
 func (cache *Cacher) HDecrBy(key string, field string, value int) (int, error) {
 
-	c, err := cache.getClient()
-	if err != nil {
-		return 0, err
-	}
-
-	val, err := c.HIncrBy(context.Background(), key, field, -1*int64(value)).Result()
+	var val int64
+	err := cache.do("HDecrBy", func(c *redis.Client) error {
+		var err error
+		val, err = c.HIncrBy(cache.context(), key, field, -1*int64(value)).Result()
+		return err
+	})
 	if err == redis.Nil {
 		// Key does not exists
 		return 0, nil
 	} else if err != nil {
-		return 0, err
+		return 0, newCacherError("HDecrBy", err)
 	}
 
 	return int(val), nil
@@ -903,17 +1179,17 @@ func (cache *Cacher) HDecrBy(key string, field string, value int) (int, error) {
 // HIncrBy increment the value on key by given value, return first value if cache expire
 func (cache *Cacher) HIncrBy(key string, field string, value int) (int, error) {
 
-	c, err := cache.getClient()
-	if err != nil {
-		return 0, err
-	}
-
-	val, err := c.HIncrBy(context.Background(), key, field, int64(value)).Result()
+	var val int64
+	err := cache.do("HIncrBy", func(c *redis.Client) error {
+		var err error
+		val, err = c.HIncrBy(cache.context(), key, field, int64(value)).Result()
+		return err
+	})
 	if err == redis.Nil {
 		// Key does not exists
 		return 0, nil
 	} else if err != nil {
-		return 0, err
+		return 0, newCacherError("HIncrBy", err)
 	}
 
 	return int(val), nil
@@ -922,14 +1198,11 @@ func (cache *Cacher) HIncrBy(key string, field string, value int) (int, error) {
 // HSetSNoExpire set value as string into cache no expired
 func (cache *Cacher) HSetSNoExpire(key string, field string, value string) error {
 
-	c, err := cache.getClient()
-	if err != nil {
-		return err
-	}
-
-	err = c.HSet(context.Background(), key, field, value).Err()
+	err := cache.do("HSetSNoExpire", func(c *redis.Client) error {
+		return c.HSet(cache.context(), key, field, value).Err()
+	})
 	if err != nil {
-		return err
+		return newCacherError("HSetSNoExpire", err)
 	}
 
 	return nil
@@ -938,24 +1211,21 @@ func (cache *Cacher) HSetSNoExpire(key string, field string, value string) error
 // HSetS set string into cache
 func (cache *Cacher) HSetS(key string, field string, value string, expire time.Duration) error {
 
-	c, err := cache.getClient()
-	if err != nil {
-		return err
-	}
-
-	err = c.HSet(context.Background(), key, field, value).Err()
+	err := cache.do("HSetS", func(c *redis.Client) error {
+		return c.HSet(cache.context(), key, field, value).Err()
+	})
 	if err != nil {
-		return err
+		return newCacherError("HSetS", err)
 	}
 
 	if expire > 0 {
-		err := cache.Expires([]string{key}, expire)
+		err := cache.expires([]string{key}, expire)
 		if err != nil {
 			if err == redis.Nil {
 				// Key does not exists
 				return nil
 			} else {
-				return err
+				return newCacherError("HSetS", err)
 			}
 		}
 	}
@@ -998,14 +1268,36 @@ func (cache *Cacher) BitFieldBulkUpdate(cmds []*BitFieldCmd) error {
 		}
 	}
 
-	return err
+	return newCacherError("BitFieldBulkUpdate", err)
 }
 
 func (cache *Cacher) BitFieldGet(key string, byteSize int, position int) (int64, error) {
-	cmd := NewBitFieldCmdGetU(byteSize, position)
-	ress, err := cache.bitfield(key, []*BitFieldCmd{cmd})
+	cmds := []*BitFieldCmd{NewBitFieldCmdGetU(byteSize, position)}
+
+	// Replica is read only, so read from replica using BITFIELD_RO (redis 6.2+),
+	// the replica of older redis is skipped and read from primary
+	var ress []int64
+	err := cache.readReplica(func(c *redis.Client) error {
+		supported, err := cache.replicas.supportBitFieldRO(cache.context(), c)
+		if err != nil {
+			return err
+		}
+		if !supported {
+			return errNoBitFieldRO
+		}
+		args := append([]interface{}{"BITFIELD_RO", key}, cache.bitfieldArgs(cmds)...)
+		ress, err = c.Do(cache.context(), args...).Int64Slice()
+		return err
+	})
+	if err == errReplicaClosed {
+		return 0, newCacherError("BitFieldGet", err)
+	}
 	if err != nil {
-		return 0, err
+		// No replica or replica failed, read from primary
+		ress, err = cache.bitfield(key, cmds)
+		if err != nil {
+			return 0, newCacherError("BitFieldGet", err)
+		}
 	}
 	return ress[0], nil
 }
@@ -1014,7 +1306,7 @@ func (cache *Cacher) BitFieldSet(key string, byteSize int, position int, value i
 	cmd := NewBitFieldCmdSetU(byteSize, position, value)
 	ress, err := cache.bitfield(key, []*BitFieldCmd{NewBitFieldCmdOverflowSat(), cmd})
 	if err != nil {
-		return 0, err
+		return 0, newCacherError("BitFieldSet", err)
 	}
 	return ress[0], nil
 }
@@ -1023,7 +1315,7 @@ func (cache *Cacher) BitFieldIncrBy(key string, byteSize int, position int, valu
 	cmd := NewBitFieldCmdIncrByU(byteSize, position, value)
 	ress, err := cache.bitfield(key, []*BitFieldCmd{NewBitFieldCmdOverflowSat(), cmd})
 	if err != nil {
-		return 0, err
+		return 0, newCacherError("BitFieldIncrBy", err)
 	}
 	return ress[0], nil
 }
@@ -1032,7 +1324,11 @@ func (cache *Cacher) BitField(
 	key string,
 	cmds []*BitFieldCmd) ([]int64, error) {
 
-	return cache.bitfield(key, cmds)
+	ress, err := cache.bitfield(key, cmds)
+	if err != nil {
+		return nil, newCacherError("BitField", err)
+	}
+	return ress, nil
 }
 
 func (cache *Cacher) bitfield(
@@ -1043,11 +1339,31 @@ func (cache *Cacher) bitfield(
 		return nil, nil
 	}
 
-	c, err := cache.getClient()
+	// BITFIELD with INCRBY is not idempotent, so it is retried as BitFieldIncrBy
+	op := "BitField"
+	for _, cmd := range cmds {
+		if cmd.CmdType == BitFieldCmdTypeIncrBy {
+			op = "BitFieldIncrBy"
+			break
+		}
+	}
+
+	args := cache.bitfieldArgs(cmds)
+	var res []int64
+	err := cache.do(op, func(c *redis.Client) error {
+		var err error
+		res, err = c.BitField(cache.context(), key, args...).Result()
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	return res, nil
+}
+
+// bitfieldArgs convert commands to arguments of BITFIELD
+func (cache *Cacher) bitfieldArgs(cmds []*BitFieldCmd) []interface{} {
 	args := []interface{}{}
 	for _, cmd := range cmds {
 
@@ -1073,13 +1389,7 @@ func (cache *Cacher) bitfield(
 			args = append(args, string(cmd.CmdType), byteSize, itemPosition, valStr)
 		}
 	}
-
-	res, err := c.BitField(context.Background(), key, args...).Result()
-	if err != nil {
-		return nil, err
-	}
-
-	return res, nil
+	return args
 }
 
 type BitFieldCmdType string
@@ -1389,60 +1699,51 @@ func NewBitFieldCmdU32(cmdType BitFieldCmdType, itemPosition int, value int) *Bi
 }
 
 func (cache *Cacher) Autonumber(name string) (int, error) {
-	key := fmt.Sprintf("autonumber_%s", name)
-	nextNumber, err := cache.Incr(key)
+	key, err := KeyAutonumber.Key(name)
 	if err != nil {
 		return -1, err
 	}
+	nextNumber, err := cache.Incr(key)
+	if err != nil {
+		return -1, newCacherError("Autonumber", err)
+	}
 	return nextNumber, nil
 }
 
 // Pub will publish to subscriber
 func (cache *Cacher) Pub(channel string, message interface{}) error {
-
-	c, err := cache.getClient()
+	err := cache.do("Pub", func(c *redis.Client) error {
+		return c.Publish(cache.context(), channel, message).Err()
+	})
 	if err != nil {
-		return err
-	}
-
-	retriesDelayMs := cache.getRetriesDelayInMs()
-	retries := -1
-	for {
-		retries++
-		if retries > len(retriesDelayMs)-1 {
-			return fmt.Errorf("cacher: retry exceed limits")
-		}
-
-		_, err = c.Publish(context.Background(), channel, message).Result()
-		if err != nil {
-			if cache.isNoConnectionError(err) {
-				time.Sleep(time.Millisecond * time.Duration(retriesDelayMs[retries]))
-				continue
-			}
-			return err
-		}
-
-		return nil
+		return newCacherError("Pub", err)
 	}
+	return nil
 }
 
 // Sub subscribe to channel
 func (cache *Cacher) Sub(channels ...string) (<-chan *redis.Message /*subID (used for close)*/, string, error) {
 
-	c, err := cache.getClient()
+	channels = cache.prefixKeys(channels)
+	var ps *redis.PubSub
+	err := cache.do("Sub", func(c *redis.Client) error {
+		ps = c.Subscribe(context.Background(), channels...)
+		return nil
+	})
 	if err != nil {
-		return nil, "", err
+		return nil, "", newCacherError("Sub", err)
 	}
 
-	ps := c.Subscribe(context.Background(), channels...)
 	subID := NewUUID()
+	done := make(chan struct{})
 
 	cache.subsribers.Store(subID, &pubsubChannels{
 		ps:       ps,
 		channels: channels,
+		done:     done,
 	})
 
-	return ps.Channel(), subID, nil
+	return cache.unprefixMessages(ps.Channel(), done), subID, nil
 }
 
 // Unsub will unsub subscriber
@@ -1451,7 +1752,7 @@ func (cache *Cacher) Unsub(subID string) error {
 		return nil
 	}
 
-	psChannels, ok := cache.subsribers.Load(subID)
+	psChannels, ok := cache.subsribers.LoadAndDelete(subID)
 	if !ok {
 		return nil
 	}
@@ -1459,6 +1760,7 @@ func (cache *Cacher) Unsub(subID string) error {
 	if !ok {
 		return nil
 	}
+	close(pubsubChannels.done)
 
 	if pubsubChannels.ps != nil {
 		err := pubsubChannels.ps.Unsubscribe(context.Background(), pubsubChannels.channels...)
@@ -1473,7 +1775,5 @@ func (cache *Cacher) Unsub(subID string) error {
 		}
 	}
 
-	cache.subsribers.Delete(subID)
-
 	return nil
 }
@@ -29,6 +29,14 @@ func (cfg *CacherConfig) Endpoint() string {
 	return "127.0.0.1:6379"
 }
 
+// ReplicaEndpoints return read replicas, read commands (HGet, Get, ...) are sent to replicas
+func (cfg *CacherConfig) ReplicaEndpoints() []string {
+	return nil
+
+	// Use read replica, start with docker compose (redis-replica at 6380)
+	// return []string{"127.0.0.1:6380"}
+}
+
 func (cfg *CacherConfig) Password() string {
 	return ""
 }
@@ -37,6 +45,11 @@ func (cfg *CacherConfig) DB() int {
 	return 0
 }
 
+// KeyPrefix is the namespace of this lesson, setup() delete only the keys in this namespace
+func (cfg *CacherConfig) KeyPrefix() string {
+	return "lesson5.1:"
+}
+
 func (cfg *CacherConfig) ConnectionSettings() ICacherConnectionSettings {
 	return NewDefaultCacherConnectionSettings()
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 
@@ -9,8 +10,9 @@ import (
 
 // HTTPContext implement IContext it is context for HTTP
 type HTTPContext struct {
-	ms *Microservice
-	c  echo.Context
+	ms      *Microservice
+	c       echo.Context
+	traceID string
 }
 
 // NewHTTPContext is the constructor function for HTTPContext
@@ -55,8 +57,20 @@ func (ctx *HTTPContext) ResponseS(responseCode int, responseData string) {
 	ctx.c.String(responseCode, responseData)
 }
 
+// Cacher return cacher that run commands with the context of request, so cacher hooks can trace the request
 func (ctx *HTTPContext) Cacher(cfg ICacherConfig) ICacher {
-	return ctx.ms.Cacher(cfg)
+	return ctx.ms.Cacher(cfg).WithContext(ctx.context())
+}
+
+// context return the context of request with trace id, the trace id is X-Request-ID header or new uuid
+func (ctx *HTTPContext) context() context.Context {
+	if len(ctx.traceID) == 0 {
+		ctx.traceID = ctx.c.Request().Header.Get("X-Request-ID")
+		if len(ctx.traceID) == 0 {
+			ctx.traceID = NewUUID()
+		}
+	}
+	return WithTraceID(ctx.c.Request().Context(), ctx.traceID)
 }
 
 func (ctx *HTTPContext) Persister(cfg IPersisterConfig) IPersister {
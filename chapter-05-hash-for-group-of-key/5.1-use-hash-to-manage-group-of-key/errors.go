@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+
+	redis "github.com/go-redis/redis/v8"
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+// The kinds of error from Cacher and Persister, check with errors.Is(err, ErrNotFound)
+var (
+	// ErrNotFound is returned when key (or record) does not exists
+	ErrNotFound = errors.New("not found")
+	// ErrUnavailable is returned when cannot connect to redis (or database), or circuit is open
+	ErrUnavailable = errors.New("unavailable")
+	// ErrTimeout is returned when the command is timeout
+	ErrTimeout = errors.New("timeout")
+	// ErrConflict is returned when the write conflict with the existing data (eg. duplicate key, WATCH failed)
+	ErrConflict = errors.New("conflict")
+	// ErrRetriesExhausted is returned when every retries failed, it is also ErrUnavailable
+	ErrRetriesExhausted = errors.New("retries exhausted")
+)
+
+// CacherError is the error of cacher command, use errors.As to get the command
+type CacherError struct {
+	Op   string // the command, eg. HGet
+	Kind error  // one of ErrNotFound, ErrUnavailable, ErrTimeout, ErrConflict, ErrRetriesExhausted or nil
+	Err  error  // the cause
+}
+
+func (e *CacherError) Error() string {
+	return formatError("cacher", e.Op, e.Kind, e.Err)
+}
+
+func (e *CacherError) Unwrap() error {
+	return e.Err
+}
+
+func (e *CacherError) Is(target error) bool {
+	return isKind(e.Kind, target)
+}
+
+// PersisterError is the error of persister operation, use errors.As to get the operation
+type PersisterError struct {
+	Op   string // the operation, eg. FindOne
+	Kind error  // one of ErrNotFound, ErrUnavailable, ErrTimeout, ErrConflict or nil
+	Err  error  // the cause
+}
+
+func (e *PersisterError) Error() string {
+	return formatError("persister", e.Op, e.Kind, e.Err)
+}
+
+func (e *PersisterError) Unwrap() error {
+	return e.Err
+}
+
+func (e *PersisterError) Is(target error) bool {
+	return isKind(e.Kind, target)
+}
+
+func formatError(source string, op string, kind error, err error) string {
+	msg := fmt.Sprintf("%s: %s", source, op)
+	if kind != nil {
+		msg += ": " + kind.Error()
+	}
+	if err != nil && err != kind {
+		msg += ": " + err.Error()
+	}
+	return msg
+}
+
+func isKind(kind error, target error) bool {
+	if kind == nil {
+		return false
+	}
+	if kind == target {
+		return true
+	}
+	// Every retries failed means the service is unavailable
+	return kind == ErrRetriesExhausted && target == ErrUnavailable
+}
+
+// newCacherError classify err from redis into CacherError, return nil if err is nil
+func newCacherError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var cacherErr *CacherError
+	if errors.As(err, &cacherErr) {
+		return err
+	}
+
+	var kind error
+	switch {
+	case err == redis.Nil:
+		kind = ErrNotFound
+	case err == redis.TxFailedErr:
+		kind = ErrConflict
+	case strings.HasPrefix(err.Error(), "BUSYKEY"):
+		kind = ErrConflict
+	default:
+		kind = classifyNetworkError(err)
+	}
+	return &CacherError{Op: op, Kind: kind, Err: err}
+}
+
+// newPersisterError classify err from gorm into PersisterError, return nil if err is nil
+func newPersisterError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var persisterErr *PersisterError
+	if errors.As(err, &persisterErr) {
+		return err
+	}
+
+	var kind error
+	var mysqlErr *mysql.MySQLError
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		kind = ErrNotFound
+	case errors.As(err, &mysqlErr) && mysqlErr.Number == 1062:
+		// 1062 is duplicate entry for key
+		kind = ErrConflict
+	case errors.As(err, &mysqlErr) && mysqlErr.Number == 1213:
+		// 1213 is deadlock found when trying to get lock
+		kind = ErrConflict
+	case errors.Is(err, mysql.ErrInvalidConn):
+		kind = ErrUnavailable
+	default:
+		kind = classifyNetworkError(err)
+	}
+	return &PersisterError{Op: op, Kind: kind, Err: err}
+}
+
+// classifyNetworkError return ErrTimeout, ErrUnavailable or nil if err is not the network error
+func classifyNetworkError(err error) error {
+	if errors.Is(err, ErrCircuitOpen) {
+		return ErrUnavailable
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrTimeout
+	}
+	// The client is closed by other call that failed to PING, the command is not sent
+	if errors.Is(err, redis.ErrClosed) {
+		return ErrUnavailable
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrUnavailable
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// HTTPStatusOf return the HTTP status code of error, so every handlers map errors the same way
+func HTTPStatusOf(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, ErrTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, ErrUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// ResponseError response error with the status code of error
+func ResponseError(ctx IContext, err error) {
+	ctx.Response(HTTPStatusOf(err), map[string]interface{}{
+		"status": "error",
+		"error":  err.Error(),
+	})
+}
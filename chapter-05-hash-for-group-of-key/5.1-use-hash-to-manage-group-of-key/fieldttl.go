@@ -0,0 +1,401 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+const (
+	fieldTTLUnknown int32 = iota
+	fieldTTLNative
+	fieldTTLEmulated
+)
+
+// reapBatchSize is the number of expired fields that are deleted by one reap script
+const reapBatchSize = 1000
+
+// setFieldScript set field and its deadline in sorted set, the hash live until its last field expire,
+// so the expire of hash (and deadlines) is extended when the new deadline is longer.
+// The hash that exists without expire is kept without expire, and the field without expire (deadline 0)
+// PERSIST the hash and deadlines, so the field is not deleted with the hash by the expire of other fields
+// KEYS[1] hash, KEYS[2] deadlines, ARGV[1] field, ARGV[2] value, ARGV[3] deadline in ms (0 is no expire), ARGV[4] now in ms
+var setFieldScript = redis.NewScript(`
+local existed = redis.call('EXISTS', KEYS[1])
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+local deadline = tonumber(ARGV[3])
+if deadline == 0 then
+	redis.call('ZREM', KEYS[2], ARGV[1])
+	redis.call('PERSIST', KEYS[1])
+	redis.call('PERSIST', KEYS[2])
+	return 1
+end
+redis.call('ZADD', KEYS[2], deadline, ARGV[1])
+
+local pttl = redis.call('PTTL', KEYS[1])
+if existed == 1 and pttl < 0 then
+	redis.call('PERSIST', KEYS[2])
+	return 1
+end
+local expireAt = deadline
+if pttl >= 0 and tonumber(ARGV[4]) + pttl > expireAt then
+	expireAt = tonumber(ARGV[4]) + pttl
+end
+redis.call('PEXPIREAT', KEYS[1], expireAt)
+redis.call('PEXPIREAT', KEYS[2], expireAt)
+return 1
+`)
+
+// reapFieldsScript delete the fields that deadline is passed, at most ARGV[2] fields
+// KEYS[1] hash, KEYS[2] deadlines, ARGV[1] now in ms, ARGV[2] limit
+var reapFieldsScript = redis.NewScript(`
+local fields = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+if #fields == 0 then
+	return 0
+end
+redis.call('HDEL', KEYS[1], unpack(fields))
+redis.call('ZREM', KEYS[2], unpack(fields))
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	redis.call('DEL', KEYS[2])
+end
+return #fields
+`)
+
+// fieldTTL keep the field expire mode of server and reap the expired fields in background,
+// the hash keys are queued when the expired fields are found on read
+type fieldTTL struct {
+	mode      int32
+	queue     chan [2]string // hash key, deadlines key (with KeyPrefix)
+	mutex     sync.Mutex
+	pending   map[string]bool
+	startOnce sync.Once
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func newFieldTTL() *fieldTTL {
+	return &fieldTTL{
+		queue:   make(chan [2]string, 1000),
+		pending: map[string]bool{},
+		done:    make(chan struct{}),
+	}
+}
+
+// enqueue add hash to reap in background, the hash that is already in queue is not added again,
+// and the hash is dropped if queue is full because the next read will find the expired fields again
+func (ttl *fieldTTL) enqueue(cache *Cacher, key string, deadlineKey string) {
+	ttl.startOnce.Do(func() {
+		go ttl.reap(cache)
+	})
+
+	ttl.mutex.Lock()
+	defer ttl.mutex.Unlock()
+	if ttl.pending[key] {
+		return
+	}
+	select {
+	case ttl.queue <- [2]string{key, deadlineKey}:
+		ttl.pending[key] = true
+	default:
+	}
+}
+
+func (ttl *fieldTTL) reap(cache *Cacher) {
+	for {
+		select {
+		case keys := <-ttl.queue:
+			ttl.mutex.Lock()
+			delete(ttl.pending, keys[0])
+			ttl.mutex.Unlock()
+
+			_, err := cache.reapFields(keys[0], keys[1])
+			if err != nil {
+				fmt.Println("cacher: reap expired fields of", keys[0], err.Error())
+			}
+		case <-ttl.done:
+			return
+		}
+	}
+}
+
+func (ttl *fieldTTL) close() {
+	ttl.closeOnce.Do(func() {
+		close(ttl.done)
+	})
+}
+
+// fieldTTLMode return fieldTTLNative if redis support HPEXPIRE, the result is detected once
+func (cache *Cacher) fieldTTLMode() (int32, error) {
+	ttl := cache.root().fieldTTL
+	if mode := atomic.LoadInt32(&ttl.mode); mode != fieldTTLUnknown {
+		return mode, nil
+	}
+	if !cache.config.ConnectionSettings().NativeFieldExpire() {
+		atomic.StoreInt32(&ttl.mode, fieldTTLEmulated)
+		return fieldTTLEmulated, nil
+	}
+
+	var info []interface{}
+	err := cache.do("CommandInfo", func(c *redis.Client) error {
+		var err error
+		info, err = c.Do(cache.context(), "command", "info", "hpexpire").Slice()
+		return err
+	})
+	if err != nil {
+		return fieldTTLUnknown, newCacherError("CommandInfo", err)
+	}
+	// The unknown command is returned as nil
+	mode := fieldTTLEmulated
+	if len(info) > 0 && info[0] != nil {
+		mode = fieldTTLNative
+	}
+	atomic.StoreInt32(&ttl.mode, mode)
+	return mode, nil
+}
+
+// deadlineKey return the key of sorted set that keep the deadlines of fields in hash key
+func (cache *Cacher) deadlineKey(key string) (string, error) {
+	return KeyFieldDeadline.Key(key)
+}
+
+func nowMs() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+// HSetFieldS set field with its own expire (0 means field has no expire),
+// unlike HSetS the expire of the other fields in hash are not extended.
+// If redis does not support field expire, the deadline of field is kept in sorted set fttl::<key>
+// that expire with the hash, so every fields of the hash should be set by HSetFieldS,
+// HSetS extend the expire of hash but not the deadlines
+func (cache *Cacher) HSetFieldS(key string, field string, value string, expire time.Duration) error {
+	mode, err := cache.fieldTTLMode()
+	if err != nil {
+		return err
+	}
+	deadlineKey, err := cache.deadlineKey(key)
+	if err != nil {
+		return err
+	}
+
+	if mode == fieldTTLNative {
+		err = cache.do("HSetFieldS", func(c *redis.Client) error {
+			_, err := c.TxPipelined(cache.context(), func(pipe redis.Pipeliner) error {
+				pipe.HSet(cache.context(), key, field, value)
+				if expire > 0 {
+					pipe.Do(cache.context(), "hpexpire", key, expire.Milliseconds(), "fields", 1, field)
+					// Extend the expire of hash only when it is longer, the hash without expire is not changed
+					pipe.Do(cache.context(), "pexpire", key, expire.Milliseconds(), "gt")
+				} else {
+					// The field without expire must live longer than the hash, so the hash has no expire,
+					// the other fields still expire by their own HPEXPIRE
+					pipe.Do(cache.context(), "hpersist", key, "fields", 1, field)
+					pipe.Persist(cache.context(), key)
+				}
+				return nil
+			})
+			return err
+		})
+		if err != nil {
+			return newCacherError("HSetFieldS", err)
+		}
+		return nil
+	}
+
+	now := nowMs()
+	deadline := int64(0)
+	if expire > 0 {
+		deadline = now + expire.Milliseconds()
+	}
+	err = cache.do("HSetFieldS", func(c *redis.Client) error {
+		return setFieldScript.Run(cache.context(), c, []string{key, deadlineKey}, field, value, deadline, now).Err()
+	})
+	if err != nil {
+		return newCacherError("HSetFieldS", err)
+	}
+	return nil
+}
+
+// HGetField get field that is set by HSetFieldS, return ErrNotFound if key or field does not exists or field is expired
+func (cache *Cacher) HGetField(key string, field string) (string, error) {
+	mode, err := cache.fieldTTLMode()
+	if err != nil {
+		return "", err
+	}
+	if mode == fieldTTLNative {
+		// Redis hide the expired fields
+		return cache.HGet(key, field)
+	}
+	deadlineKey, err := cache.deadlineKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	var valCmd *redis.StringCmd
+	var deadlineCmd *redis.FloatCmd
+	err = cache.read("HGetField", func(c *redis.Client) error {
+		_, err := c.Pipelined(cache.context(), func(pipe redis.Pipeliner) error {
+			valCmd = pipe.HGet(cache.context(), key, field)
+			deadlineCmd = pipe.ZScore(cache.context(), deadlineKey, field)
+			return nil
+		})
+		// redis.Nil of HGET or ZSCORE is checked below
+		return err
+	})
+	if err != nil && err != redis.Nil {
+		return "", newCacherError("HGetField", err)
+	}
+
+	val, err := valCmd.Result()
+	if err != nil {
+		// Key or field does not exists is ErrNotFound
+		return "", newCacherError("HGetField", err)
+	}
+	deadline, err := deadlineCmd.Result()
+	if err == nil && int64(deadline) <= nowMs() {
+		cache.root().fieldTTL.enqueue(cache.root(), key, deadlineKey)
+		return "", newCacherError("HGetField", redis.Nil)
+	}
+	return val, nil
+}
+
+// HGetAllFields get every fields of hash that are not expired, return empty map if key does not exists
+func (cache *Cacher) HGetAllFields(key string) (map[string]string, error) {
+	mode, err := cache.fieldTTLMode()
+	if err != nil {
+		return nil, err
+	}
+	if mode == fieldTTLNative {
+		return cache.HGetAll(key)
+	}
+	deadlineKey, err := cache.deadlineKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var valsCmd *redis.StringStringMapCmd
+	var expiredCmd *redis.StringSliceCmd
+	err = cache.read("HGetAllFields", func(c *redis.Client) error {
+		_, err := c.Pipelined(cache.context(), func(pipe redis.Pipeliner) error {
+			valsCmd = pipe.HGetAll(cache.context(), key)
+			expiredCmd = pipe.ZRangeByScore(cache.context(), deadlineKey, &redis.ZRangeBy{
+				Min: "-inf",
+				Max: fmt.Sprintf("%d", nowMs()),
+			})
+			return nil
+		})
+		return err
+	})
+	if err == redis.Nil {
+		return map[string]string{}, nil
+	} else if err != nil {
+		return nil, newCacherError("HGetAllFields", err)
+	}
+
+	vals := valsCmd.Val()
+	expired := expiredCmd.Val()
+	for _, field := range expired {
+		delete(vals, field)
+	}
+	if len(expired) > 0 {
+		cache.root().fieldTTL.enqueue(cache.root(), key, deadlineKey)
+	}
+	return vals, nil
+}
+
+// HFieldTTL return the remaining time of field, -1 if field has no expire, ErrNotFound if field does not exists or expired
+func (cache *Cacher) HFieldTTL(key string, field string) (time.Duration, error) {
+	mode, err := cache.fieldTTLMode()
+	if err != nil {
+		return 0, err
+	}
+	deadlineKey, err := cache.deadlineKey(key)
+	if err != nil {
+		return 0, err
+	}
+
+	if mode == fieldTTLNative {
+		var ttls []int64
+		err = cache.read("HFieldTTL", func(c *redis.Client) error {
+			var err error
+			ttls, err = c.Do(cache.context(), "hpttl", key, "fields", 1, field).Int64Slice()
+			return err
+		})
+		if err != nil {
+			return 0, newCacherError("HFieldTTL", err)
+		}
+		if len(ttls) == 0 || ttls[0] == -2 {
+			// -2 is field does not exists
+			return 0, newCacherError("HFieldTTL", redis.Nil)
+		}
+		if ttls[0] == -1 {
+			return -1, nil
+		}
+		return time.Duration(ttls[0]) * time.Millisecond, nil
+	}
+
+	var existsCmd *redis.BoolCmd
+	var deadlineCmd *redis.FloatCmd
+	err = cache.read("HFieldTTL", func(c *redis.Client) error {
+		_, err := c.Pipelined(cache.context(), func(pipe redis.Pipeliner) error {
+			existsCmd = pipe.HExists(cache.context(), key, field)
+			deadlineCmd = pipe.ZScore(cache.context(), deadlineKey, field)
+			return nil
+		})
+		return err
+	})
+	if err != nil && err != redis.Nil {
+		return 0, newCacherError("HFieldTTL", err)
+	}
+	if !existsCmd.Val() {
+		return 0, newCacherError("HFieldTTL", redis.Nil)
+	}
+	deadline, err := deadlineCmd.Result()
+	if err == redis.Nil {
+		return -1, nil
+	}
+	remaining := int64(deadline) - nowMs()
+	if remaining <= 0 {
+		return 0, newCacherError("HFieldTTL", redis.Nil)
+	}
+	return time.Duration(remaining) * time.Millisecond, nil
+}
+
+// ReapExpiredFields delete the expired fields of hash now, instead of wait for the background reaper.
+// Redis that support field expire delete them by itself, so it return 0
+func (cache *Cacher) ReapExpiredFields(key string) (int, error) {
+	mode, err := cache.fieldTTLMode()
+	if err != nil {
+		return 0, err
+	}
+	if mode == fieldTTLNative {
+		return 0, nil
+	}
+	deadlineKey, err := cache.deadlineKey(key)
+	if err != nil {
+		return 0, err
+	}
+	return cache.reapFields(key, deadlineKey)
+}
+
+// reapFields delete the expired fields of hash
+func (cache *Cacher) reapFields(key string, deadlineKey string) (int, error) {
+	total := 0
+	for {
+		var deleted int64
+		err := cache.do("ReapExpiredFields", func(c *redis.Client) error {
+			var err error
+			deleted, err = reapFieldsScript.Run(cache.context(), c, []string{key, deadlineKey}, nowMs(), reapBatchSize).Int64()
+			return err
+		})
+		if err != nil {
+			return total, newCacherError("ReapExpiredFields", err)
+		}
+		total += int(deleted)
+		if deleted < reapBatchSize {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// generationSeparator separate the key of family and its generation, eg. user::alice@g1700000000000
+const generationSeparator = "@g"
+
+type localGeneration struct {
+	value    int64
+	expireAt time.Time
+}
+
+// Generations keep the generation counter of key families, the keys of family embed the current generation,
+// so INCR the generation invalidate every keys of family at once, the keys of old generation
+// are never read again and they are removed by their TTL or by Sweep
+type Generations struct {
+	cacher   ICacher
+	localTTL time.Duration
+	mutex    sync.Mutex
+	local    map[string]*localGeneration
+}
+
+// NewGenerations return new Generations, the generation is cached in memory for localTTL (0 means no cache),
+// so the other instances see the new generation after localTTL
+func NewGenerations(cacher ICacher, localTTL time.Duration) *Generations {
+	return &Generations{
+		cacher:   cacher,
+		localTTL: localTTL,
+		local:    map[string]*localGeneration{},
+	}
+}
+
+// Current return the current generation of family
+func (gens *Generations) Current(family *KeyFamily) (int64, error) {
+	if gen, ok := gens.getLocal(family); ok {
+		return gen, nil
+	}
+
+	genKey, err := KeyGeneration.Key(family.Name)
+	if err != nil {
+		return 0, err
+	}
+	val, err := gens.cacher.Get(genKey)
+	if errors.Is(err, ErrNotFound) {
+		// Start from current time instead of 0, so if the counter is evicted
+		// the new generation is still greater than the generations before
+		_, err = gens.cacher.SetNX(genKey, strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10), 0)
+		if err != nil {
+			return 0, err
+		}
+		val, err = gens.cacher.Get(genKey)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	gen, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("generation of %s: %w", family.Name, err)
+	}
+	gens.setLocal(family, gen)
+	return gen, nil
+}
+
+// Key return the key of family in the current generation, the param must not contain generationSeparator,
+// so the generation is always the suffix after the last separator
+func (gens *Generations) Key(family *KeyFamily, params ...string) (string, error) {
+	for _, param := range params {
+		if strings.Contains(param, generationSeparator) {
+			return "", fmt.Errorf("generations: param %s of %s must not contain %s", param, family.Name, generationSeparator)
+		}
+	}
+	gen, err := gens.Current(family)
+	if err != nil {
+		return "", err
+	}
+	key, err := family.Key(params...)
+	if err != nil {
+		return "", err
+	}
+	return key + generationSeparator + strconv.FormatInt(gen, 10), nil
+}
+
+// Bump increase the generation of family, every keys of the old generation are invalidated
+func (gens *Generations) Bump(family *KeyFamily) (int64, error) {
+	// Make sure the counter exists, so INCR does not start from 0
+	_, err := gens.Current(family)
+	if err != nil {
+		return 0, err
+	}
+	genKey, err := KeyGeneration.Key(family.Name)
+	if err != nil {
+		return 0, err
+	}
+	gen, err := gens.cacher.Incr(genKey)
+	if err != nil {
+		return 0, err
+	}
+	gens.setLocal(family, int64(gen))
+	return int64(gen), nil
+}
+
+// Sweep delete the keys of old generations of family, it scan at most maxPages pages (100 keys per page)
+// from the cursor of the last sweep, the cursor is kept in KeySweepCursor so the next sweep continue from there
+// and every keys are visited after enough sweeps. The cursor start from 0 again when the scan is complete
+func (gens *Generations) Sweep(family *KeyFamily, maxPages int) (int, error) {
+	current, err := gens.Current(family)
+	if err != nil {
+		return 0, err
+	}
+
+	cursorKey, err := KeySweepCursor.Key(family.Name)
+	if err != nil {
+		return 0, err
+	}
+	cursor, err := gens.sweepCursor(cursorKey)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for page := 0; page < maxPages; page++ {
+		keys, nextCursor, err := gens.cacher.Scan(cursor, family.ScanPattern()+generationSeparator+"*", 100)
+		if err != nil {
+			return deleted, err
+		}
+
+		oldKeys := []string{}
+		for _, key := range keys {
+			_, gen, ok := parseGeneration(family, key)
+			if ok && gen < current {
+				oldKeys = append(oldKeys, key)
+			}
+		}
+		if len(oldKeys) > 0 {
+			err = gens.cacher.Del(oldKeys...)
+			if err != nil {
+				return deleted, err
+			}
+			deleted += len(oldKeys)
+		}
+
+		cursor = nextCursor
+		if cursor == 0 {
+			break
+		}
+	}
+
+	// The instances that sweep at the same time might overwrite the cursor of each others,
+	// it only make some pages scanned twice (or skipped until the next round)
+	err = gens.cacher.SetS(cursorKey, strconv.FormatUint(cursor, 10), KeySweepCursor.DefaultTTL)
+	if err != nil {
+		return deleted, err
+	}
+	return deleted, nil
+}
+
+// sweepCursor return the cursor of the last sweep, 0 if there is no cursor
+func (gens *Generations) sweepCursor(cursorKey string) (uint64, error) {
+	val, err := gens.cacher.Get(cursorKey)
+	if errors.Is(err, ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	cursor, err := strconv.ParseUint(val, 10, 64)
+	if err != nil {
+		// The invalid cursor is ignored, so the sweep start from the first page
+		return 0, nil
+	}
+	return cursor, nil
+}
+
+// StartSweeper sweep families every interval in background, call stop to stop the sweeper
+func (gens *Generations) StartSweeper(interval time.Duration, maxPages int, families ...*KeyFamily) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				for _, family := range families {
+					deleted, err := gens.Sweep(family, maxPages)
+					if err != nil {
+						fmt.Println("generations: sweep", family.Name, err.Error())
+						continue
+					}
+					if deleted > 0 {
+						fmt.Printf("generations: sweep %s deleted %d keys\n", family.Name, deleted)
+					}
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+func (gens *Generations) getLocal(family *KeyFamily) (int64, bool) {
+	if gens.localTTL <= 0 {
+		return 0, false
+	}
+	gens.mutex.Lock()
+	defer gens.mutex.Unlock()
+	local, ok := gens.local[family.Name]
+	if !ok || time.Now().After(local.expireAt) {
+		return 0, false
+	}
+	return local.value, true
+}
+
+func (gens *Generations) setLocal(family *KeyFamily, gen int64) {
+	if gens.localTTL <= 0 {
+		return
+	}
+	gens.mutex.Lock()
+	defer gens.mutex.Unlock()
+	gens.local[family.Name] = &localGeneration{
+		value:    gen,
+		expireAt: time.Now().Add(gens.localTTL),
+	}
+}
+
+// generationRegexes cache the regex of each family that parse the key of family in a generation,
+// it is the regex of family with the generation anchored at the end
+var generationRegexes sync.Map
+
+func generationRegex(family *KeyFamily) *regexp.Regexp {
+	if regex, ok := generationRegexes.Load(family); ok {
+		return regex.(*regexp.Regexp)
+	}
+	expr := strings.TrimSuffix(family.regex.String(), "$") + regexp.QuoteMeta(generationSeparator) + `(\d+)$`
+	regex, _ := generationRegexes.LoadOrStore(family, regexp.MustCompile(expr))
+	return regex.(*regexp.Regexp)
+}
+
+// parseGeneration return the params of family and the generation that is embedded in key,
+// ok is false if key is not the key of family in a generation (eg. user::alice@g123x or user::a@gb@g123)
+func parseGeneration(family *KeyFamily, key string) (params map[string]string, gen int64, ok bool) {
+	matches := generationRegex(family).FindStringSubmatch(key)
+	if matches == nil {
+		return nil, 0, false
+	}
+	params = map[string]string{}
+	for i, name := range family.params {
+		// Generations.Key does not allow the separator in param, so the key is not in a generation
+		if strings.Contains(matches[i+1], generationSeparator) {
+			return nil, 0, false
+		}
+		params[name] = matches[i+1]
+	}
+	gen, err := strconv.ParseInt(matches[len(matches)-1], 10, 64)
+	if err != nil {
+		return nil, 0, false
+	}
+	return params, gen, true
+}
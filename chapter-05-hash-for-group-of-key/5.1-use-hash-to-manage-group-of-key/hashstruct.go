@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+// hashField is the struct field that is mapped to hash field by tag redis:"name"
+type hashField struct {
+	name      string
+	index     int
+	omitempty bool
+}
+
+// hashFieldsCache keep the hash fields by struct type, so the tags are parsed once
+var hashFieldsCache sync.Map // reflect.Type -> []*hashField
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// hashFields return the fields of struct type t that have tag redis:"name" or redis:"name,omitempty",
+// the fields without tag or with redis:"-" are not mapped
+func hashFields(t reflect.Type) []*hashField {
+	if fields, ok := hashFieldsCache.Load(t); ok {
+		return fields.([]*hashField)
+	}
+
+	fields := []*hashField{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("redis")
+		if !ok || tag == "-" || len(sf.PkgPath) > 0 {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		field := &hashField{
+			name:  parts[0],
+			index: i,
+		}
+		if len(field.name) == 0 {
+			field.name = sf.Name
+		}
+		for _, opt := range parts[1:] {
+			if opt == "omitempty" {
+				field.omitempty = true
+			}
+		}
+		fields = append(fields, field)
+	}
+	hashFieldsCache.Store(t, fields)
+	return fields
+}
+
+// structValue return the struct that v point to (or v itself), ptr must be true for decode
+func structValue(v interface{}, ptr bool) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	} else if ptr {
+		return reflect.Value{}, fmt.Errorf("hash struct: %T is not a pointer to struct", v)
+	}
+	if rv.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("hash struct: %T is not a struct", v)
+	}
+	return rv, nil
+}
+
+// encodeHashValue convert field value to hash value, number and bool are kept as string so HINCRBY still work,
+// time is RFC3339 and the other types (struct, map, slice) are JSON
+func encodeHashValue(fv reflect.Value) (string, error) {
+	if fv.Type() == timeType {
+		return fv.Interface().(time.Time).Format(time.RFC3339Nano), nil
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		return fv.String(), nil
+	case reflect.Bool:
+		if fv.Bool() {
+			return "1", nil
+		}
+		return "0", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(fv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(fv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(fv.Float(), 'f', -1, fv.Type().Bits()), nil
+	}
+	js, err := json.Marshal(fv.Interface())
+	if err != nil {
+		return "", err
+	}
+	return string(js), nil
+}
+
+// decodeHashValue set hash value into field, it is the reverse of encodeHashValue
+func decodeHashValue(val string, fv reflect.Value) error {
+	if fv.Type() == timeType {
+		t, err := time.Parse(time.RFC3339Nano, val)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(val, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(val, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(val, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	default:
+		return json.Unmarshal([]byte(val), fv.Addr().Interface())
+	}
+	return nil
+}
+
+// structToHash return the hash values of struct v, return only fields if any
+func structToHash(v interface{}, fields []string) (map[string]interface{}, error) {
+	rv, err := structValue(v, false)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := map[string]bool{}
+	for _, name := range fields {
+		selected[name] = true
+	}
+
+	values := map[string]interface{}{}
+	for _, field := range hashFields(rv.Type()) {
+		fv := rv.Field(field.index)
+		if len(fields) > 0 {
+			if !selected[field.name] {
+				continue
+			}
+			delete(selected, field.name)
+		} else if field.omitempty && fv.IsZero() {
+			continue
+		}
+		val, err := encodeHashValue(fv)
+		if err != nil {
+			return nil, fmt.Errorf("hash field %s: %w", field.name, err)
+		}
+		values[field.name] = val
+	}
+	for name := range selected {
+		return nil, fmt.Errorf("hash struct: %T has no field %s", v, name)
+	}
+	return values, nil
+}
+
+// hashToStruct set the hash values into struct pointer v, the fields that are not in hash are not changed
+func hashToStruct(vals map[string]string, v interface{}) error {
+	rv, err := structValue(v, true)
+	if err != nil {
+		return err
+	}
+	for _, field := range hashFields(rv.Type()) {
+		val, ok := vals[field.name]
+		if !ok {
+			continue
+		}
+		err := decodeHashValue(val, rv.Field(field.index))
+		if err != nil {
+			return fmt.Errorf("hash field %s: %w", field.name, err)
+		}
+	}
+	return nil
+}
+
+// HSetStruct set the fields of struct v into hash, the struct fields are mapped by tag redis:"name",
+// if fields are given only these fields are set, so the other fields in hash are not overwritten
+func (cache *Cacher) HSetStruct(key string, v interface{}, expire time.Duration, fields ...string) error {
+
+	values, err := structToHash(v, fields)
+	if err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	// HSET and EXPIRE in one transaction, so the hash is never left without expire
+	err = cache.do("HSetStruct", func(c *redis.Client) error {
+		_, err := c.TxPipelined(cache.context(), func(pipe redis.Pipeliner) error {
+			pipe.HSet(cache.context(), key, values)
+			if expire > 0 {
+				pipe.Expire(cache.context(), key, expire)
+			}
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		return newCacherError("HSetStruct", err)
+	}
+
+	return nil
+}
+
+// HGetAllInto get every fields of hash into struct pointer v, return ErrNotFound if key does not exists
+func (cache *Cacher) HGetAllInto(key string, v interface{}) error {
+	vals, err := cache.HGetAll(key)
+	if err != nil {
+		return err
+	}
+	if len(vals) == 0 {
+		return newCacherError("HGetAllInto", redis.Nil)
+	}
+	return hashToStruct(vals, v)
+}
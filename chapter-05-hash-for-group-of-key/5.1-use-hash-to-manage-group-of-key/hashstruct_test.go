@@ -0,0 +1,196 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testHashAddress struct {
+	City string `json:"city"`
+}
+
+type testHashStruct struct {
+	Name     string            `redis:"name"`
+	Points   int               `redis:"points"`
+	Level    int8              `redis:"level,omitempty"`
+	Count    uint32            `redis:"count"`
+	Ratio    float64           `redis:"ratio"`
+	Active   bool              `redis:"active"`
+	At       time.Time         `redis:"at"`
+	Address  testHashAddress   `redis:"address"`
+	Tags     []string          `redis:"tags,omitempty"`
+	Extra    map[string]string `redis:"extra,omitempty"`
+	Default  string            `redis:",omitempty"`
+	Skipped  string            `redis:"-"`
+	Untagged string
+	private  string `redis:"private"`
+}
+
+func TestStructToHash(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	full := &testHashStruct{
+		Name:     "alice",
+		Points:   -10,
+		Level:    3,
+		Count:    7,
+		Ratio:    0.25,
+		Active:   true,
+		At:       at,
+		Address:  testHashAddress{City: "Bangkok"},
+		Tags:     []string{"a", "b"},
+		Extra:    map[string]string{"k": "v"},
+		Default:  "d",
+		Skipped:  "skipped",
+		Untagged: "untagged",
+		private:  "private",
+	}
+
+	tests := []struct {
+		name    string
+		v       interface{}
+		fields  []string
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name: "every types",
+			v:    full,
+			want: map[string]interface{}{
+				"name":    "alice",
+				"points":  "-10",
+				"level":   "3",
+				"count":   "7",
+				"ratio":   "0.25",
+				"active":  "1",
+				"at":      "2024-01-02T03:04:05.000000006Z",
+				"address": `{"city":"Bangkok"}`,
+				"tags":    `["a","b"]`,
+				"extra":   `{"k":"v"}`,
+				"Default": "d",
+			},
+		},
+		{
+			name: "omitempty skip zero values",
+			v:    testHashStruct{Name: "bob"},
+			want: map[string]interface{}{
+				"name":    "bob",
+				"points":  "0",
+				"count":   "0",
+				"ratio":   "0",
+				"active":  "0",
+				"at":      "0001-01-01T00:00:00Z",
+				"address": `{"city":""}`,
+			},
+		},
+		{
+			name:   "selected fields",
+			v:      full,
+			fields: []string{"level", "points"},
+			want:   map[string]interface{}{"level": "3", "points": "-10"},
+		},
+		{
+			name:   "selected field is set even it is zero",
+			v:      &testHashStruct{},
+			fields: []string{"level"},
+			want:   map[string]interface{}{"level": "0"},
+		},
+		{
+			name:    "selected field does not exist",
+			v:       full,
+			fields:  []string{"level", "unknown"},
+			wantErr: true,
+		},
+		{
+			name:    "skipped field cannot be selected",
+			v:       full,
+			fields:  []string{"Skipped"},
+			wantErr: true,
+		},
+		{
+			name:    "not struct",
+			v:       "alice",
+			wantErr: true,
+		},
+		{
+			name:    "nil pointer",
+			v:       (*testHashStruct)(nil),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := structToHash(tt.v, tt.fields)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("structToHash error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("structToHash = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashToStructRoundTrip(t *testing.T) {
+	want := testHashStruct{
+		Name:    "alice",
+		Points:  -10,
+		Level:   3,
+		Count:   7,
+		Ratio:   0.25,
+		Active:  true,
+		At:      time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC),
+		Address: testHashAddress{City: "Bangkok"},
+		Tags:    []string{"a", "b"},
+		Extra:   map[string]string{"k": "v"},
+		Default: "d",
+	}
+	values, err := structToHash(&want, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vals := map[string]string{}
+	for name, value := range values {
+		vals[name] = value.(string)
+	}
+
+	got := testHashStruct{Skipped: "kept"}
+	err = hashToStruct(vals, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The fields that are not in hash are not changed
+	want.Skipped = "kept"
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("hashToStruct = %+v, want %+v", got, want)
+	}
+}
+
+func TestHashToStruct(t *testing.T) {
+	tests := []struct {
+		name    string
+		vals    map[string]string
+		v       interface{}
+		wantErr bool
+	}{
+		{"valid values", map[string]string{"points": "5", "active": "0"}, &testHashStruct{}, false},
+		{"unknown hash field is ignored", map[string]string{"unknown": "x"}, &testHashStruct{}, false},
+		{"invalid int", map[string]string{"points": "five"}, &testHashStruct{}, true},
+		{"int8 overflow", map[string]string{"level": "300"}, &testHashStruct{}, true},
+		{"negative uint", map[string]string{"count": "-1"}, &testHashStruct{}, true},
+		{"invalid time", map[string]string{"at": "yesterday"}, &testHashStruct{}, true},
+		{"invalid json", map[string]string{"tags": "[a"}, &testHashStruct{}, true},
+		{"not pointer", map[string]string{}, testHashStruct{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := hashToStruct(tt.vals, tt.v)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("hashToStruct error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+// CommandInfo is the redis command that is passed to cacher hooks
+type CommandInfo struct {
+	// Name is the redis command in lower case, eg. hget
+	Name string
+	// Key is the first key of command, empty if the command has no key (eg. ping, scan)
+	Key   string
+	Start time.Time
+	// Duration and Err are set before AfterCommand (or AfterPipeline), redis.Nil is not the error
+	Duration time.Duration
+	Err      error
+}
+
+// ICacherHook is called before and after every redis commands of cacher,
+// ctx is the context of request (see Cacher.WithContext), Before can return new ctx that is passed to After
+type ICacherHook interface {
+	BeforeCommand(ctx context.Context, cmd *CommandInfo) context.Context
+	AfterCommand(ctx context.Context, cmd *CommandInfo)
+	BeforePipeline(ctx context.Context, cmds []*CommandInfo) context.Context
+	AfterPipeline(ctx context.Context, cmds []*CommandInfo)
+}
+
+// DefaultCacherHook does nothing, this intend to use as embed struct so the hook implement only what it need
+type DefaultCacherHook struct{}
+
+func (hook *DefaultCacherHook) BeforeCommand(ctx context.Context, cmd *CommandInfo) context.Context {
+	return ctx
+}
+
+func (hook *DefaultCacherHook) AfterCommand(ctx context.Context, cmd *CommandInfo) {}
+
+func (hook *DefaultCacherHook) BeforePipeline(ctx context.Context, cmds []*CommandInfo) context.Context {
+	return ctx
+}
+
+func (hook *DefaultCacherHook) AfterPipeline(ctx context.Context, cmds []*CommandInfo) {}
+
+type traceIDKey struct{}
+
+// WithTraceID return ctx that carry traceID, the commands run with this ctx are traced with the same id
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceIDKey{}, traceID)
+}
+
+// TraceIDFromContext return the trace id in ctx, or empty string
+func TraceIDFromContext(ctx context.Context) string {
+	traceID, _ := ctx.Value(traceIDKey{}).(string)
+	return traceID
+}
+
+// keylessCommands are the commands that the first argument is not the key
+var keylessCommands = map[string]bool{
+	"ping":    true,
+	"scan":    true,
+	"info":    true,
+	"config":  true,
+	"select":  true,
+	"auth":    true,
+	"hello":   true,
+	"client":  true,
+	"command": true,
+}
+
+func newCommandInfo(cmd redis.Cmder) *CommandInfo {
+	info := &CommandInfo{
+		Name:  cmd.Name(),
+		Start: time.Now(),
+	}
+	args := cmd.Args()
+	switch {
+	case info.Name == "eval" || info.Name == "evalsha":
+		// eval script numkeys key ...
+		if len(args) > 3 {
+			info.Key, _ = args[3].(string)
+		}
+	case len(args) > 1 && !keylessCommands[info.Name]:
+		info.Key, _ = args[1].(string)
+	}
+	return info
+}
+
+func (info *CommandInfo) done(cmd redis.Cmder) {
+	info.Duration = time.Since(info.Start)
+	if err := cmd.Err(); err != nil && err != redis.Nil {
+		info.Err = err
+	}
+}
+
+type commandInfoKey struct{}
+
+type pipelineInfoKey struct{}
+
+// cacherHooks implement redis.Hook, it call every hooks that are added to cacher,
+// hooks can be added after the clients are created because clients keep this object
+type cacherHooks struct {
+	mutex sync.RWMutex
+	hooks []ICacherHook
+}
+
+func (hooks *cacherHooks) add(hook ICacherHook) {
+	hooks.mutex.Lock()
+	defer hooks.mutex.Unlock()
+	hooks.hooks = append(hooks.hooks, hook)
+}
+
+func (hooks *cacherHooks) list() []ICacherHook {
+	hooks.mutex.RLock()
+	defer hooks.mutex.RUnlock()
+	return hooks.hooks
+}
+
+func (hooks *cacherHooks) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	info := newCommandInfo(cmd)
+	for _, hook := range hooks.list() {
+		ctx = hook.BeforeCommand(ctx, info)
+	}
+	return context.WithValue(ctx, commandInfoKey{}, info), nil
+}
+
+func (hooks *cacherHooks) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	info, ok := ctx.Value(commandInfoKey{}).(*CommandInfo)
+	if !ok {
+		return nil
+	}
+	info.done(cmd)
+	// After hooks are called in reverse order, like defer
+	list := hooks.list()
+	for i := len(list) - 1; i >= 0; i-- {
+		list[i].AfterCommand(ctx, info)
+	}
+	return nil
+}
+
+func (hooks *cacherHooks) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	infos := make([]*CommandInfo, 0, len(cmds))
+	for _, cmd := range cmds {
+		infos = append(infos, newCommandInfo(cmd))
+	}
+	for _, hook := range hooks.list() {
+		ctx = hook.BeforePipeline(ctx, infos)
+	}
+	return context.WithValue(ctx, pipelineInfoKey{}, infos), nil
+}
+
+func (hooks *cacherHooks) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	infos, ok := ctx.Value(pipelineInfoKey{}).([]*CommandInfo)
+	if !ok || len(infos) != len(cmds) {
+		return nil
+	}
+	for i, cmd := range cmds {
+		infos[i].done(cmd)
+	}
+	list := hooks.list()
+	for i := len(list) - 1; i >= 0; i-- {
+		list[i].AfterPipeline(ctx, infos)
+	}
+	return nil
+}
+
+// SlowCommand is the command that is slower than threshold
+type SlowCommand struct {
+	Name       string `json:"name"`
+	Key        string `json:"key"`
+	TraceID    string `json:"trace_id,omitempty"`
+	Start      string `json:"start"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// SlowLogHook log the commands (and pipelines) that are slower than threshold,
+// and keep the latest slow commands in memory
+type SlowLogHook struct {
+	DefaultCacherHook
+	threshold time.Duration
+	maxLen    int
+	mutex     sync.Mutex
+	latest    []*SlowCommand
+}
+
+// NewSlowLogHook return hook that log commands slower than threshold, keep maxLen latest slow commands
+func NewSlowLogHook(threshold time.Duration, maxLen int) *SlowLogHook {
+	return &SlowLogHook{
+		threshold: threshold,
+		maxLen:    maxLen,
+	}
+}
+
+func (hook *SlowLogHook) AfterCommand(ctx context.Context, cmd *CommandInfo) {
+	if cmd.Duration < hook.threshold {
+		return
+	}
+	hook.record(ctx, cmd.Name, cmd.Key, cmd)
+}
+
+func (hook *SlowLogHook) AfterPipeline(ctx context.Context, cmds []*CommandInfo) {
+	if len(cmds) == 0 || cmds[0].Duration < hook.threshold {
+		return
+	}
+	names := make([]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		names = append(names, cmd.Name)
+	}
+	hook.record(ctx, "pipeline("+strings.Join(names, ",")+")", cmds[0].Key, cmds[0])
+}
+
+func (hook *SlowLogHook) record(ctx context.Context, name string, key string, cmd *CommandInfo) {
+	slow := &SlowCommand{
+		Name:       name,
+		Key:        key,
+		TraceID:    TraceIDFromContext(ctx),
+		Start:      cmd.Start.Format(time.RFC3339Nano),
+		DurationMs: cmd.Duration.Milliseconds(),
+	}
+	if cmd.Err != nil {
+		slow.Error = cmd.Err.Error()
+	}
+	fmt.Printf("cacher: slow command %s %s took %dms\n", slow.Name, slow.Key, slow.DurationMs)
+
+	hook.mutex.Lock()
+	defer hook.mutex.Unlock()
+	hook.latest = append(hook.latest, slow)
+	if len(hook.latest) > hook.maxLen {
+		hook.latest = hook.latest[len(hook.latest)-hook.maxLen:]
+	}
+}
+
+// Latest return the latest slow commands, the newest is the last
+func (hook *SlowLogHook) Latest() []*SlowCommand {
+	hook.mutex.Lock()
+	defer hook.mutex.Unlock()
+	latest := make([]*SlowCommand, len(hook.latest))
+	copy(latest, hook.latest)
+	return latest
+}
+
+// CommandStats is the command counts and latency of one key prefix
+type CommandStats struct {
+	Calls   int64 `json:"calls"`
+	Errors  int64 `json:"errors"`
+	TotalUs int64 `json:"total_us"`
+	MaxUs   int64 `json:"max_us"`
+	AvgUs   int64 `json:"avg_us"`
+}
+
+// CommandStatsHook collect command stats by key prefix, eg. user:: and register::
+type CommandStatsHook struct {
+	DefaultCacherHook
+	// namespace is the KeyPrefix of cacher, it is removed before find the prefix
+	namespace string
+	stats     sync.Map // prefix -> *CommandStats
+}
+
+// NewCommandStatsHook return new CommandStatsHook
+func NewCommandStatsHook() *CommandStatsHook {
+	return &CommandStatsHook{}
+}
+
+// keyPrefix return the part of key before :: (or :), eg. user:: of user::alice
+func keyPrefix(key string) string {
+	if len(key) == 0 {
+		return "(no key)"
+	}
+	if i := strings.Index(key, "::"); i >= 0 {
+		return key[:i+2]
+	}
+	if i := strings.Index(key, ":"); i >= 0 {
+		return key[:i+1]
+	}
+	return "(no prefix)"
+}
+
+func (hook *CommandStatsHook) AfterCommand(ctx context.Context, cmd *CommandInfo) {
+	hook.record(cmd)
+}
+
+func (hook *CommandStatsHook) AfterPipeline(ctx context.Context, cmds []*CommandInfo) {
+	for _, cmd := range cmds {
+		hook.record(cmd)
+	}
+}
+
+func (hook *CommandStatsHook) record(cmd *CommandInfo) {
+	key := strings.TrimPrefix(cmd.Key, hook.namespace)
+	value, _ := hook.stats.LoadOrStore(keyPrefix(key), &CommandStats{})
+	stats := value.(*CommandStats)
+
+	us := cmd.Duration.Microseconds()
+	atomic.AddInt64(&stats.Calls, 1)
+	atomic.AddInt64(&stats.TotalUs, us)
+	if cmd.Err != nil {
+		atomic.AddInt64(&stats.Errors, 1)
+	}
+	for {
+		max := atomic.LoadInt64(&stats.MaxUs)
+		if us <= max || atomic.CompareAndSwapInt64(&stats.MaxUs, max, us) {
+			break
+		}
+	}
+}
+
+// Snapshot return the copy of command stats by key prefix
+func (hook *CommandStatsHook) Snapshot() map[string]CommandStats {
+	snapshot := map[string]CommandStats{}
+	hook.stats.Range(func(key, value interface{}) bool {
+		stats := value.(*CommandStats)
+		s := CommandStats{
+			Calls:   atomic.LoadInt64(&stats.Calls),
+			Errors:  atomic.LoadInt64(&stats.Errors),
+			TotalUs: atomic.LoadInt64(&stats.TotalUs),
+			MaxUs:   atomic.LoadInt64(&stats.MaxUs),
+		}
+		if s.Calls > 0 {
+			s.AvgUs = s.TotalUs / s.Calls
+		}
+		snapshot[key.(string)] = s
+		return true
+	})
+	return snapshot
+}
@@ -0,0 +1,53 @@
+package main
+
+import "time"
+
+// keySchemas is the registry of every key families of this lesson
+var keySchemas = NewKeyRegistry()
+
+var (
+	// KeyMember is the hash of member data, the fields are points and level
+	KeyMember = keySchemas.Register(&KeyFamily{
+		Name:       "member",
+		Pattern:    "user::{username}",
+		ValueType:  KeyValueHash,
+		DefaultTTL: 300 * time.Second,
+		Version:    1,
+	})
+	// KeyFieldDeadline is the deadlines of hash fields that are set by HSetFieldS, the member is field and the score is deadline in ms,
+	// it expire with the hash
+	KeyFieldDeadline = keySchemas.Register(&KeyFamily{
+		Name:       "field_deadline",
+		Pattern:    "fttl::{key}",
+		ValueType:  KeyValueSortedSet,
+		DefaultTTL: 0,
+		Version:    1,
+	})
+	// KeyGeneration is the generation counter of key family, see Generations
+	KeyGeneration = keySchemas.Register(&KeyFamily{
+		Name:             "generation",
+		Pattern:          "gen::{family}",
+		ValueType:        KeyValueCounter,
+		DefaultTTL:       0,
+		EvictionCritical: true,
+		Version:          1,
+	})
+	// KeySweepCursor is the SCAN cursor of Generations.Sweep of family, the sweep continue from it next time,
+	// if it is expired the sweep start from the first page again
+	KeySweepCursor = keySchemas.Register(&KeyFamily{
+		Name:       "sweep_cursor",
+		Pattern:    "sweep::{family}",
+		ValueType:  KeyValueString,
+		DefaultTTL: 24 * time.Hour,
+		Version:    1,
+	})
+	// KeyAutonumber is the running number of cacher.Autonumber
+	KeyAutonumber = keySchemas.Register(&KeyFamily{
+		Name:             "autonumber",
+		Pattern:          "autonumber_{name}",
+		ValueType:        KeyValueCounter,
+		DefaultTTL:       0,
+		EvictionCritical: true,
+		Version:          1,
+	})
+)
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeyPrefixHookPrefixArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []interface{}
+		want    []interface{}
+		wantErr bool
+	}{
+		{"first key", []interface{}{"get", "a"}, []interface{}{"get", "p:a"}, false},
+		{"upper case command", []interface{}{"HSET", "a", "f", "v"}, []interface{}{"HSET", "p:a", "f", "v"}, false},
+		{"no key", []interface{}{"ping"}, []interface{}{"ping"}, false},
+		{"config has no key", []interface{}{"config", "get", "maxmemory"}, []interface{}{"config", "get", "maxmemory"}, false},
+		{"every keys", []interface{}{"del", "a", "b"}, []interface{}{"del", "p:a", "p:b"}, false},
+		{"key value pairs", []interface{}{"mset", "a", "1", "b", "2"}, []interface{}{"mset", "p:a", "1", "p:b", "2"}, false},
+		{"two keys", []interface{}{"rename", "a", "b"}, []interface{}{"rename", "p:a", "p:b"}, false},
+		{"smove member is not key", []interface{}{"smove", "a", "b", "m"}, []interface{}{"smove", "p:a", "p:b", "m"}, false},
+		{"blpop timeout is not key", []interface{}{"blpop", "a", "b", 0}, []interface{}{"blpop", "p:a", "p:b", 0}, false},
+		{"bitop operation is not key", []interface{}{"bitop", "and", "d", "a"}, []interface{}{"bitop", "and", "p:d", "p:a"}, false},
+		{"eval", []interface{}{"eval", "return 1", 2, "a", "b", "arg"}, []interface{}{"eval", "return 1", 2, "p:a", "p:b", "arg"}, false},
+		{"evalsha no key", []interface{}{"evalsha", "sha", 0, "arg"}, []interface{}{"evalsha", "sha", 0, "arg"}, false},
+		{"eval numkeys too many", []interface{}{"eval", "return 1", 3, "a"}, nil, true},
+		{"eval numkeys invalid", []interface{}{"eval", "return 1", "x", "a"}, nil, true},
+		{"keys pattern", []interface{}{"keys", "user::*"}, []interface{}{"keys", "p:user::*"}, false},
+		{"scan match", []interface{}{"scan", 0, "match", "*", "count", 100}, []interface{}{"scan", 0, "match", "p:*", "count", 100}, false},
+		{"scan without match", []interface{}{"scan", 0, "count", 100}, nil, true},
+		{"publish channel", []interface{}{"publish", "ch", "msg"}, []interface{}{"publish", "p:ch", "msg"}, false},
+		{"first key is missing", []interface{}{"get"}, nil, true},
+		{"key is not string", []interface{}{"get", 1}, nil, true},
+		// The commands that are not in the table fail, they are not sent with unprefixed keys
+		{"unknown command", []interface{}{"object", "encoding", "a"}, nil, true},
+		{"unknown store command", []interface{}{"sunionstore", "d", "a", "b"}, nil, true},
+		{"unknown xread", []interface{}{"xread", "streams", "a", "0"}, nil, true},
+	}
+	hook := newKeyPrefixHook("p:")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]interface{}{}, tt.args...)
+			err := hook.prefixArgs(args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("prefixArgs(%v) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(args, tt.want) {
+				t.Errorf("prefixArgs(%v) = %v, want %v", tt.args, args, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyPrefixHookEscapePattern(t *testing.T) {
+	hook := newKeyPrefixHook("svc[1]*:")
+	args := []interface{}{"keys", "user::*"}
+	if err := hook.prefixArgs(args); err != nil {
+		t.Fatal(err)
+	}
+	if want := `svc\[1\]\*:user::*`; args[1] != want {
+		t.Errorf("pattern = %v, want %s", args[1], want)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import "time"
+
+// KeyFamilyStats is the family with number of keys from sampled SCAN
+type KeyFamilyStats struct {
+	Name             string       `json:"name"`
+	Pattern          string       `json:"pattern"`
+	ValueType        KeyValueType `json:"value_type"`
+	DefaultTTLSecond int64        `json:"default_ttl_second"`
+	EvictionCritical bool         `json:"eviction_critical"`
+	Version          int          `json:"version"`
+	// SampleCount is the number of keys of family in the sampled keys
+	SampleCount int `json:"sample_count"`
+	// SampledKeys is the number of keys that are scanned, the same for every families
+	SampledKeys int `json:"sampled_keys"`
+	// EstimatedCount is SampleCount scaled by DBSIZE / SampledKeys, DBSIZE include the keys of other services
+	// that share the DB, so it is the upper bound. If Complete, it is the exact number of keys
+	EstimatedCount int64 `json:"estimated_count"`
+	// Complete is true if SCAN visit every keys before maxPages
+	Complete bool `json:"complete"`
+}
+
+// Stats SCAN at most maxPages pages (100 keys per page) of keys in the namespace, and count the keys of each family
+// in the sample, the count is scaled by DBSIZE to estimate the number of keys of family in the whole DB
+func (registry *KeyRegistry) Stats(cacher ICacher, maxPages int) ([]*KeyFamilyStats, error) {
+	counts := map[*KeyFamily]int{}
+	sampled := 0
+	complete := false
+
+	var cursor uint64
+	for page := 0; page < maxPages; page++ {
+		keys, nextCursor, err := cacher.Scan(cursor, "*", 100)
+		if err != nil {
+			return nil, err
+		}
+		sampled += len(keys)
+		// Scan all families in one pass, and parse every keys because the pattern with * of one family
+		// can match the keys of other families (eg. autonumber_*)
+		for _, key := range keys {
+			if family, _ := registry.Match(key); family != nil {
+				counts[family]++
+			}
+		}
+		if nextCursor == 0 {
+			complete = true
+			break
+		}
+		cursor = nextCursor
+	}
+
+	var dbSize int64
+	if !complete && sampled > 0 {
+		var err error
+		dbSize, err = cacher.DBSize()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	allStats := []*KeyFamilyStats{}
+	for _, family := range registry.Families() {
+		stats := &KeyFamilyStats{
+			Name:             family.Name,
+			Pattern:          family.Pattern,
+			ValueType:        family.ValueType,
+			DefaultTTLSecond: int64(family.DefaultTTL / time.Second),
+			EvictionCritical: family.EvictionCritical,
+			Version:          family.Version,
+			SampleCount:      counts[family],
+			SampledKeys:      sampled,
+			Complete:         complete,
+		}
+		if complete || sampled == 0 {
+			stats.EstimatedCount = int64(stats.SampleCount)
+		} else {
+			stats.EstimatedCount = int64(stats.SampleCount) * dbSize / int64(sampled)
+		}
+		allStats = append(allStats, stats)
+	}
+	return allStats, nil
+}
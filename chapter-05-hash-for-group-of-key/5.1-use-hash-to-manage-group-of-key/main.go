@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -29,7 +30,7 @@ func main() {
 		// Get member points
 		points, err := queryMemberPoints(ctx, cfg, username)
 		if err != nil {
-			ctx.Response(http.StatusInternalServerError, map[string]interface{}{"status": "error"})
+			ResponseError(ctx, err)
 			return nil
 		}
 
@@ -48,7 +49,7 @@ func main() {
 		// Get member points
 		level, err := queryMemberLevel(ctx, cfg, username)
 		if err != nil {
-			ctx.Response(http.StatusInternalServerError, map[string]interface{}{"status": "error"})
+			ResponseError(ctx, err)
 			return nil
 		}
 
@@ -64,14 +65,18 @@ func main() {
 	// ms.GET("/points", func(ctx IContext) error {
 
 	// 	username := ctx.QueryParam("u")
-	// 	cacheKey := getCacheKeyForMember(username)
+	// 	cacheKey, err := KeyMember.Key(username)
+	// 	if err != nil {
+	// 		ResponseError(ctx, err)
+	// 		return nil
+	// 	}
 	// 	cacheField := "points"
-	// 	cacheTimeout := 300 * time.Second
+	// 	cacheTimeout := KeyMember.DefaultTTL
 	// 	points := -1
 
 	// 	cacher := ctx.Cacher(cfg.CacherConfig())
 	// 	pointsJS, err := cacher.HGet(cacheKey, cacheField)
-	// 	if err != nil {
+	// 	if err != nil && !errors.Is(err, ErrNotFound) {
 	// 		ctx.Log(err.Error())
 	// 	}
 
@@ -89,7 +94,7 @@ func main() {
 	// 		// ctx.Log("cache miss")
 	// 		points, err = queryMemberPoints(ctx, cfg, username)
 	// 		if err != nil {
-	// 			ctx.Response(http.StatusInternalServerError, map[string]interface{}{"status": "error"})
+	// 			ResponseError(ctx, err)
 	// 			return nil
 	// 		}
 	// 		err = cacher.HSetS(cacheKey, cacheField, fmt.Sprintf("%d", points), cacheTimeout)
@@ -111,14 +116,18 @@ func main() {
 	// ms.GET("/level", func(ctx IContext) error {
 
 	// 	username := ctx.QueryParam("u")
-	// 	cacheKey := getCacheKeyForMember(username)
+	// 	cacheKey, err := KeyMember.Key(username)
+	// 	if err != nil {
+	// 		ResponseError(ctx, err)
+	// 		return nil
+	// 	}
 	// 	cacheField := "level"
-	// 	cacheTimeout := 300 * time.Second
+	// 	cacheTimeout := KeyMember.DefaultTTL
 	// 	level := -1
 
 	// 	cacher := ctx.Cacher(cfg.CacherConfig())
 	// 	levelJS, err := cacher.HGet(cacheKey, cacheField)
-	// 	if err != nil {
+	// 	if err != nil && !errors.Is(err, ErrNotFound) {
 	// 		ctx.Log(err.Error())
 	// 	}
 
@@ -136,7 +145,101 @@ func main() {
 	// 		// ctx.Log("cache miss")
 	// 		level, err = queryMemberLevel(ctx, cfg, username)
 	// 		if err != nil {
-	// 			ctx.Response(http.StatusInternalServerError, map[string]interface{}{"status": "error"})
+	// 			ResponseError(ctx, err)
+	// 			return nil
+	// 		}
+	// 		err = cacher.HSetS(cacheKey, cacheField, fmt.Sprintf("%d", level), cacheTimeout)
+	// 		if err != nil {
+	// 			ctx.Log(err.Error())
+	// 		}
+	// 	}
+
+	// 	resp := map[string]interface{}{
+	// 		"status": "ok",
+	// 		"level":  level,
+	// 	}
+	// 	ctx.Response(http.StatusOK, resp)
+
+	// 	return nil
+	// })
+
+	// 7. GET level api using cache aside with circuit breaker,
+	//    when redis is down the circuit is open and level is loaded from database with concurrency limit
+	// levelCache := NewCacheAside(ms.Cacher(cfg.CacherConfig()), 20)
+	// ms.GET("/level", func(ctx IContext) error {
+
+	// 	username := ctx.QueryParam("u")
+	// 	cacheKey, err := KeyMember.Key(username)
+	// 	if err != nil {
+	// 		ResponseError(ctx, err)
+	// 		return nil
+	// 	}
+	// 	cacheTimeout := KeyMember.DefaultTTL
+
+	// 	levelJS, err := levelCache.HGet(cacheKey, "level", cacheTimeout, func() (string, error) {
+	// 		level, err := queryMemberLevel(ctx, cfg, username)
+	// 		if err != nil {
+	// 			return "", err
+	// 		}
+	// 		return fmt.Sprintf("%d", level), nil
+	// 	})
+	// 	if err != nil {
+	// 		ResponseError(ctx, err)
+	// 		return nil
+	// 	}
+
+	// 	level, err := strconv.Atoi(levelJS)
+	// 	if err != nil {
+	// 		ctx.Response(http.StatusInternalServerError, map[string]interface{}{"status": "error"})
+	// 		return nil
+	// 	}
+
+	// 	resp := map[string]interface{}{
+	// 		"status": "ok",
+	// 		"level":  level,
+	// 	}
+	// 	ctx.Response(http.StatusOK, resp)
+
+	// 	return nil
+	// })
+
+	// 8. GET level api using cache with the key of current generation,
+	// DELETE /member/caches invalidate every member caches by bump the generation with one INCR,
+	// the keys of old generations are expired by TTL, the sweeper delete them before they expire
+	// generations := NewGenerations(ms.Cacher(cfg.CacherConfig()), time.Second)
+	// stopSweeper := generations.StartSweeper(time.Minute, 100, KeyMember)
+	// defer stopSweeper()
+
+	// ms.GET("/level", func(ctx IContext) error {
+
+	// 	username := ctx.QueryParam("u")
+	// 	cacheKey, err := generations.Key(KeyMember, username)
+	// 	if err != nil {
+	// 		ResponseError(ctx, err)
+	// 		return nil
+	// 	}
+	// 	cacheField := "level"
+	// 	cacheTimeout := KeyMember.DefaultTTL
+	// 	level := -1
+
+	// 	cacher := ctx.Cacher(cfg.CacherConfig())
+	// 	levelJS, err := cacher.HGet(cacheKey, cacheField)
+	// 	if err != nil && !errors.Is(err, ErrNotFound) {
+	// 		ctx.Log(err.Error())
+	// 	}
+
+	// 	if len(levelJS) > 0 {
+	// 		level, err = strconv.Atoi(levelJS)
+	// 		if err != nil {
+	// 			level = -1
+	// 			ctx.Log(err.Error())
+	// 		}
+	// 	}
+
+	// 	if level < 0 {
+	// 		level, err = queryMemberLevel(ctx, cfg, username)
+	// 		if err != nil {
+	// 			ResponseError(ctx, err)
 	// 			return nil
 	// 		}
 	// 		err = cacher.HSetS(cacheKey, cacheField, fmt.Sprintf("%d", level), cacheTimeout)
@@ -154,10 +257,161 @@ func main() {
 	// 	return nil
 	// })
 
+	// ms.DELETE("/member/caches", func(ctx IContext) error {
+	// 	gen, err := generations.Bump(KeyMember)
+	// 	if err != nil {
+	// 		ResponseError(ctx, err)
+	// 		return nil
+	// 	}
+
+	// 	resp := map[string]interface{}{
+	// 		"status":     "ok",
+	// 		"generation": gen,
+	// 	}
+	// 	ctx.Response(http.StatusOK, resp)
+	// 	return nil
+	// })
+
+	// 9. GET member api using HSetStruct, HGetAllInto, the hash fields are mapped to MemberCache by tag redis
+	// ms.GET("/member", func(ctx IContext) error {
+
+	// 	username := ctx.QueryParam("u")
+	// 	cacheKey, err := KeyMember.Key(username)
+	// 	if err != nil {
+	// 		ResponseError(ctx, err)
+	// 		return nil
+	// 	}
+	// 	cacheTimeout := KeyMember.DefaultTTL
+
+	// 	cacher := ctx.Cacher(cfg.CacherConfig())
+	// 	member := &MemberCache{}
+	// 	err = cacher.HGetAllInto(cacheKey, member)
+	// 	if err != nil && !errors.Is(err, ErrNotFound) {
+	// 		ctx.Log(err.Error())
+	// 	}
+
+	// 	if err != nil {
+	// 		// ctx.Log("cache miss")
+	// 		member.Points, err = queryMemberPoints(ctx, cfg, username)
+	// 		if err != nil {
+	// 			ResponseError(ctx, err)
+	// 			return nil
+	// 		}
+	// 		member.Level, err = queryMemberLevel(ctx, cfg, username)
+	// 		if err != nil {
+	// 			ResponseError(ctx, err)
+	// 			return nil
+	// 		}
+	// 		member.CachedAt = time.Now()
+	// 		err = cacher.HSetStruct(cacheKey, member, cacheTimeout)
+	// 		if err != nil {
+	// 			ctx.Log(err.Error())
+	// 		}
+	// 	} else if member.Level == 0 {
+	// 		// The hash is created by /points (step 5) without level, set only level so points is not overwritten
+	// 		member.Level, err = queryMemberLevel(ctx, cfg, username)
+	// 		if err != nil {
+	// 			ResponseError(ctx, err)
+	// 			return nil
+	// 		}
+	// 		err = cacher.HSetStruct(cacheKey, member, cacheTimeout, "level")
+	// 		if err != nil {
+	// 			ctx.Log(err.Error())
+	// 		}
+	// 	}
+
+	// 	resp := map[string]interface{}{
+	// 		"status":    "ok",
+	// 		"points":    member.Points,
+	// 		"level":     member.Level,
+	// 		"cached_at": member.CachedAt,
+	// 	}
+	// 	ctx.Response(http.StatusOK, resp)
+
+	// 	return nil
+	// })
+
+	// Export span of every cacher commands to cacher_spans.log, the span has trace id of request (X-Request-ID)
+	// spanExporter, err := NewFileSpanExporterHook("cacher_spans.log")
+	// if err != nil {
+	// 	ms.Log("Main", err.Error())
+	// 	return
+	// }
+	// defer spanExporter.Close()
+	// ms.Cacher(cfg.CacherConfig()).AddHook(spanExporter)
+
+	// API to get the remaining time of points and level in member hash, -1 is no expire
+	ms.GET("/member/ttl", func(ctx IContext) error {
+		username := ctx.QueryParam("u")
+		cacheKey, err := KeyMember.Key(username)
+		if err != nil {
+			ResponseError(ctx, err)
+			return nil
+		}
+
+		cacher := ctx.Cacher(cfg.CacherConfig())
+		ttls := map[string]interface{}{}
+		for _, field := range []string{"points", "level"} {
+			ttl, err := cacher.HFieldTTL(cacheKey, field)
+			if errors.Is(err, ErrNotFound) {
+				ttls[field] = nil
+				continue
+			} else if err != nil {
+				ResponseError(ctx, err)
+				return nil
+			}
+			if ttl < 0 {
+				ttls[field] = -1
+			} else {
+				ttls[field] = ttl.Milliseconds()
+			}
+		}
+
+		resp := map[string]interface{}{
+			"status": "ok",
+			"ttl_ms": ttls,
+		}
+		ctx.Response(http.StatusOK, resp)
+		return nil
+	})
+
+	// API to get retry counts, command stats by key prefix and slow commands of cacher
+	ms.GET("/metrics/cacher", func(ctx IContext) error {
+		cacher := ctx.Cacher(cfg.CacherConfig())
+		resp := map[string]interface{}{
+			"status":   "ok",
+			"retries":  cacher.RetryStats(),
+			"commands": cacher.CommandStats(),
+			"slow":     cacher.SlowCommands(),
+		}
+		ctx.Response(http.StatusOK, resp)
+		return nil
+	})
+
+	// API to list key families of the key schema registry with number of keys from sampled SCAN
+	ms.GET("/metrics/cacher/keys", func(ctx IContext) error {
+		cacher := ctx.Cacher(cfg.CacherConfig())
+		families, err := keySchemas.Stats(cacher, 10)
+		if err != nil {
+			ResponseError(ctx, err)
+			return nil
+		}
+		resp := map[string]interface{}{
+			"status":   "ok",
+			"families": families,
+		}
+		ctx.Response(http.StatusOK, resp)
+		return nil
+	})
+
 	// API to delete member
 	ms.DELETE("/member", func(ctx IContext) error {
 		username := ctx.QueryParam("u")
-		deleteMember(ctx, cfg, username)
+		err := deleteMember(ctx, cfg, username)
+		if err != nil {
+			ResponseError(ctx, err)
+			return nil
+		}
 
 		resp := map[string]interface{}{
 			"status": "ok",
@@ -186,7 +440,7 @@ func queryMemberLevel(ctx IContext, cfg IConfig, username string) (int /*level*/
 	}
 
 	if len(members) == 0 {
-		return -1, fmt.Errorf("member not found")
+		return -1, fmt.Errorf("member %s: %w", username, ErrNotFound)
 	}
 	return members[0].MemberLevel, nil
 }
@@ -205,7 +459,7 @@ func queryMemberPoints(ctx IContext, cfg IConfig, username string) (int /*point*
 	}
 
 	if len(points) == 0 {
-		return -1, fmt.Errorf("member not found")
+		return -1, fmt.Errorf("member %s: %w", username, ErrNotFound)
 	}
 	return points[0].Point, nil
 }
@@ -224,7 +478,7 @@ func deleteMember(ctx IContext, cfg IConfig, username string) error {
 	}
 
 	if len(members) == 0 {
-		return fmt.Errorf("member not found")
+		return fmt.Errorf("member %s: %w", username, ErrNotFound)
 	}
 
 	member := members[0]
@@ -236,7 +490,10 @@ func deleteMember(ctx IContext, cfg IConfig, username string) error {
 	}
 
 	cacher := ctx.Cacher(cfg.CacherConfig())
-	cacheKey := getCacheKeyForMember(username)
+	cacheKey, err := KeyMember.Key(username)
+	if err != nil {
+		return err
+	}
 	ctx.Log("delete member username=" + username)
 	err = cacher.Del(cacheKey)
 	if err != nil {
@@ -245,7 +502,3 @@ func deleteMember(ctx IContext, cfg IConfig, username string) error {
 
 	return nil
 }
-
-func getCacheKeyForMember(username string) string {
-	return fmt.Sprintf("user::%s", username)
-}
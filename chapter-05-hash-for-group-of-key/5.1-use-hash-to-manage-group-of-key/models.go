@@ -1,5 +1,7 @@
 package main
 
+import "time"
+
 // Member is the struct to test in persister
 type Member struct {
 	ID            string `json:"id" gorm:"column:id; primary_key"`
@@ -24,3 +26,10 @@ type MemberPoint struct {
 func (*MemberPoint) TableName() string {
 	return "member_points"
 }
+
+// MemberCache is the hash user::{username} of member, the fields are mapped by tag redis
+type MemberCache struct {
+	Points   int       `redis:"points"`
+	Level    int       `redis:"level"`
+	CachedAt time.Time `redis:"cached_at"`
+}
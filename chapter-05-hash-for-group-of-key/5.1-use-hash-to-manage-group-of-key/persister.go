@@ -86,7 +86,7 @@ func (pst *Persister) getClient() (*gorm.DB, error) {
 func (pst *Persister) TableExists(model interface{}) (bool, error) {
 	db, err := pst.getClient()
 	if err != nil {
-		return false, err
+		return false, newPersisterError("TableExists", err)
 	}
 
 	has := db.Migrator().HasTable(model)
@@ -98,11 +98,11 @@ func (pst *Persister) TableExists(model interface{}) (bool, error) {
 func (pst *Persister) Exec(sql string, args ...interface{}) error {
 	db, err := pst.getClient()
 	if err != nil {
-		return err
+		return newPersisterError("Exec", err)
 	}
 
 	if err := db.Exec(sql, args).Error; err != nil {
-		return err
+		return newPersisterError("Exec", err)
 	}
 	return nil
 }
@@ -122,7 +122,7 @@ func (pst *Persister) calcOffset(page int, pageLimit int) int {
 func (pst *Persister) WhereSP(model interface{}, sortexpr string, pageLimit int, page int, expr string, args ...interface{}) ( /*result*/ interface{}, error) {
 	db, err := pst.getClient()
 	if err != nil {
-		return nil, err
+		return nil, newPersisterError("WhereSP", err)
 	}
 
 	offset := pst.calcOffset(page, pageLimit)
@@ -130,22 +130,22 @@ func (pst *Persister) WhereSP(model interface{}, sortexpr string, pageLimit int,
 	if len(sortexpr) > 0 && pageLimit > 0 {
 		// Sorting and paging
 		if err := db.Offset(offset).Limit(pageLimit).Order(sortexpr).Where(expr, args...).Find(model).Error; err != nil {
-			return nil, err
+			return nil, newPersisterError("WhereSP", err)
 		}
 	} else if len(sortexpr) > 0 {
 		// Sorting
 		if err := db.Order(sortexpr).Where(expr, args...).Find(model).Error; err != nil {
-			return nil, err
+			return nil, newPersisterError("WhereSP", err)
 		}
 	} else if pageLimit > 0 {
 		// Paging
 		if err := db.Offset(offset).Limit(pageLimit).Where(expr, args...).Find(model).Error; err != nil {
-			return nil, err
+			return nil, newPersisterError("WhereSP", err)
 		}
 	} else {
 		// No Sorting, No Paging
 		if err := db.Where(expr, args...).Find(model).Error; err != nil {
-			return nil, err
+			return nil, newPersisterError("WhereSP", err)
 		}
 	}
 	return model, nil
@@ -170,27 +170,27 @@ func (pst *Persister) Where(model interface{}, expr string, args ...interface{})
 func (pst *Persister) Count(model interface{}, expr string, args ...interface{}) (int64, error) {
 	db, err := pst.getClient()
 	if err != nil {
-		return 0, err
+		return 0, newPersisterError("Count", err)
 	}
 
 	count := new(int64)
 	if err := db.Model(model).Where(expr, args...).Count(count).Error; err != nil {
-		return 0, err
+		return 0, newPersisterError("Count", err)
 	}
 
 	return *count, nil
 }
 
-// FindOne find object by id
+// FindOne find object by id, return ErrNotFound if there is no object
 func (pst *Persister) FindOne(model interface{}, idColumn string, id string) ( /*result*/ interface{}, error) {
 	db, err := pst.getClient()
 	if err != nil {
-		return nil, err
+		return nil, newPersisterError("FindOne", err)
 	}
 
 	where := fmt.Sprintf("%s = ?", idColumn)
 	if err := db.Where(where, id).First(model).Error; err != nil {
-		return nil, err
+		return nil, newPersisterError("FindOne", err)
 	}
 	return model, nil
 }
@@ -199,12 +199,12 @@ func (pst *Persister) FindOne(model interface{}, idColumn string, id string) ( /
 func (pst *Persister) Create(model interface{}) error {
 	db, err := pst.getClient()
 	if err != nil {
-		return err
+		return newPersisterError("Create", err)
 	}
 
 	err = db.Create(model).Error
 	if err != nil {
-		return err
+		return newPersisterError("Create", err)
 	}
 
 	return nil
@@ -214,12 +214,12 @@ func (pst *Persister) Create(model interface{}) error {
 func (pst *Persister) Update(model interface{}) error {
 	db, err := pst.getClient()
 	if err != nil {
-		return err
+		return newPersisterError("Update", err)
 	}
 
 	err = db.Save(model).Error
 	if err != nil {
-		return err
+		return newPersisterError("Update", err)
 	}
 
 	return nil
@@ -229,7 +229,7 @@ func (pst *Persister) Update(model interface{}) error {
 func (pst *Persister) CreateInBatch(models interface{}, bulkSize int) error {
 	db, err := pst.getClient()
 	if err != nil {
-		return err
+		return newPersisterError("CreateInBatch", err)
 	}
 
 	db.CreateInBatches(models, bulkSize)
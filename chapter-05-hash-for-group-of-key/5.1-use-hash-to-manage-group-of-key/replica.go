@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+// ReplicaRouting is how read commands choose the replica
+type ReplicaRouting string
+
+const (
+	// ReplicaRoutingRoundRobin send read commands to replicas in turn
+	ReplicaRoutingRoundRobin ReplicaRouting = "round_robin"
+	// ReplicaRoutingLatency send read commands to the replica that has the lowest latency
+	ReplicaRoutingLatency ReplicaRouting = "latency"
+)
+
+// errReplicaClosed is returned when read after the replicas are closed
+var errReplicaClosed = errors.New("cacher: replicas are closed")
+
+// errNoBitFieldRO is returned when replica does not support BITFIELD_RO (before redis 6.2)
+var errNoBitFieldRO = errors.New("cacher: replica does not support BITFIELD_RO")
+
+const (
+	bitFieldROUnknown int32 = iota
+	bitFieldROSupported
+	bitFieldRONotSupported
+)
+
+// replicaDownTime is the time that failed replica is out of rotation before try again
+const replicaDownTime = 5 * time.Second
+
+// replicaClient is the client of one read replica
+type replicaClient struct {
+	client    *redis.Client
+	latency   int64 // moving average of command latency in nanoseconds
+	downUntil int64 // unix nano, the replica is out of rotation until this time
+}
+
+func (replica *replicaClient) isUp() bool {
+	return time.Now().UnixNano() >= atomic.LoadInt64(&replica.downUntil)
+}
+
+func (replica *replicaClient) markDown() {
+	atomic.StoreInt64(&replica.downUntil, time.Now().Add(replicaDownTime).UnixNano())
+}
+
+// recordLatency keep moving average of latency, the new latency weight 1/5
+func (replica *replicaClient) recordLatency(d time.Duration) {
+	old := atomic.LoadInt64(&replica.latency)
+	if old == 0 {
+		atomic.StoreInt64(&replica.latency, int64(d))
+		return
+	}
+	atomic.StoreInt64(&replica.latency, old+(int64(d)-old)/5)
+}
+
+// replicaRouter choose replica for read commands
+type replicaRouter struct {
+	config      ICacherConfig
+	routing     ReplicaRouting
+	clientMutex sync.Mutex
+	replicas    []*replicaClient
+	closed      bool
+	next        uint64
+	// bitFieldRO is bitFieldROSupported if replicas support BITFIELD_RO, it is detected once
+	bitFieldRO int32
+	// hook is added to every replica clients
+	hook redis.Hook
+}
+
+func newReplicaRouter(config ICacherConfig) *replicaRouter {
+	return &replicaRouter{
+		config:  config,
+		routing: config.ConnectionSettings().ReplicaRouting(),
+	}
+}
+
+// getReplicas create clients of replicas on first use
+func (router *replicaRouter) getReplicas() ([]*replicaClient, error) {
+	router.clientMutex.Lock()
+	defer router.clientMutex.Unlock()
+
+	if router.closed {
+		return nil, errReplicaClosed
+	}
+	if router.replicas != nil {
+		return router.replicas, nil
+	}
+
+	cfg := router.config
+	settings := cfg.ConnectionSettings()
+	replicas := []*replicaClient{}
+	for _, endpoint := range cfg.ReplicaEndpoints() {
+		client := redis.NewClient(&redis.Options{
+			Addr:               endpoint,
+			Password:           cfg.Password(),
+			DB:                 cfg.DB(),
+			PoolSize:           settings.PoolSize(),
+			MinIdleConns:       settings.MinIdleConns(),
+			MaxRetries:         settings.MaxRetries(),
+			MinRetryBackoff:    settings.MinRetryBackoff(),
+			MaxRetryBackoff:    settings.MaxRetryBackoff(),
+			IdleTimeout:        settings.IdleTimeout(),
+			IdleCheckFrequency: settings.IdleCheckFrequency(),
+			PoolTimeout:        settings.PoolTimeout(),
+			ReadTimeout:        settings.ReadTimeout(),
+			WriteTimeout:       settings.WriteTimeout(),
+		})
+		if len(cfg.KeyPrefix()) > 0 {
+			client.AddHook(newKeyPrefixHook(cfg.KeyPrefix()))
+		}
+		if router.hook != nil {
+			client.AddHook(router.hook)
+		}
+		replicas = append(replicas, &replicaClient{client: client})
+	}
+	router.replicas = replicas
+	return replicas, nil
+}
+
+// pick return the replica to read, or nil if every replicas are down
+func (router *replicaRouter) pick() (*replicaClient, error) {
+	replicas, err := router.getReplicas()
+	if err != nil || len(replicas) == 0 {
+		return nil, err
+	}
+
+	if router.routing == ReplicaRoutingLatency {
+		var picked *replicaClient
+		for _, replica := range replicas {
+			if !replica.isUp() {
+				continue
+			}
+			if picked == nil || atomic.LoadInt64(&replica.latency) < atomic.LoadInt64(&picked.latency) {
+				picked = replica
+			}
+		}
+		return picked, nil
+	}
+
+	// Round robin, skip the replicas that are down
+	start := atomic.AddUint64(&router.next, 1)
+	for i := 0; i < len(replicas); i++ {
+		replica := replicas[(start+uint64(i))%uint64(len(replicas))]
+		if replica.isUp() {
+			return replica, nil
+		}
+	}
+	return nil, nil
+}
+
+// supportBitFieldRO return true if replica support BITFIELD_RO, the result is detected once
+// by COMMAND INFO, so the replica before redis 6.2 is not sent BITFIELD_RO on every reads
+func (router *replicaRouter) supportBitFieldRO(ctx context.Context, client *redis.Client) (bool, error) {
+	switch atomic.LoadInt32(&router.bitFieldRO) {
+	case bitFieldROSupported:
+		return true, nil
+	case bitFieldRONotSupported:
+		return false, nil
+	}
+
+	info, err := client.Do(ctx, "command", "info", "bitfield_ro").Slice()
+	if err != nil {
+		return false, err
+	}
+	// The unknown command is returned as nil
+	supported := len(info) > 0 && info[0] != nil
+	if supported {
+		atomic.StoreInt32(&router.bitFieldRO, bitFieldROSupported)
+	} else {
+		atomic.StoreInt32(&router.bitFieldRO, bitFieldRONotSupported)
+	}
+	return supported, nil
+}
+
+// Close close every replica clients, read after Close return errReplicaClosed
+func (router *replicaRouter) Close() error {
+	router.clientMutex.Lock()
+	defer router.clientMutex.Unlock()
+
+	router.closed = true
+	var lastErr error
+	for _, replica := range router.replicas {
+		err := replica.client.Close()
+		if err != nil {
+			lastErr = err
+		}
+	}
+	router.replicas = nil
+	return lastErr
+}
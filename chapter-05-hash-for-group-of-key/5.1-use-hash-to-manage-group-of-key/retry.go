@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+// RetryPolicy is how cacher retry the failed commands
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts include the first one, 1 means no retry
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, the delay is doubled every retry
+	BaseDelay time.Duration
+	// MaxDelay is the max delay between retries
+	MaxDelay time.Duration
+	// Jitter is the ratio (0-1) of delay that is randomized, so the clients do not retry at the same time
+	Jitter float64
+}
+
+// NewDefaultRetryPolicy return policy that retry 4 times, 50ms, 100ms, 200ms, 400ms with 20% jitter
+func NewDefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   50 * time.Millisecond,
+		MaxDelay:    time.Second,
+		Jitter:      0.2,
+	}
+}
+
+// Backoff return the delay before the retry, retry starts from 1
+func (policy *RetryPolicy) Backoff(retry int) time.Duration {
+	delay := policy.BaseDelay
+	for i := 1; i < retry && delay < policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+	if policy.Jitter > 0 {
+		// Random in [delay - jitter, delay + jitter]
+		jitter := float64(delay) * policy.Jitter
+		delay = time.Duration(float64(delay) - jitter + rand.Float64()*2*jitter)
+	}
+	return delay
+}
+
+// nonIdempotentCommands are the commands that change the value by the current value,
+// they are retried only when the command is not sent to redis (cannot connect)
+var nonIdempotentCommands = map[string]bool{
+	"Incr":           true,
+	"Decr":           true,
+	"IncrBy":         true,
+	"DecrBy":         true,
+	"HIncr":          true,
+	"HDecr":          true,
+	"HIncrBy":        true,
+	"HDecrBy":        true,
+	"BitFieldIncrBy": true,
+	"SetNX":          true, // the retry return false if the first try is success
+	"Pub":            true, // publish twice will deliver the message twice
+}
+
+// isIdempotentCommand return true if the command can be retried after it is sent to redis
+func isIdempotentCommand(op string) bool {
+	return !nonIdempotentCommands[op]
+}
+
+// RetryStats is the retry counts of one command
+type RetryStats struct {
+	Retries   int64 `json:"retries"`
+	Exhausted int64 `json:"exhausted"`
+}
+
+// retryMetrics count retries by command
+type retryMetrics struct {
+	stats sync.Map // op -> *RetryStats
+}
+
+func (metrics *retryMetrics) get(op string) *RetryStats {
+	stats, _ := metrics.stats.LoadOrStore(op, &RetryStats{})
+	return stats.(*RetryStats)
+}
+
+func (metrics *retryMetrics) retry(op string) {
+	atomic.AddInt64(&metrics.get(op).Retries, 1)
+}
+
+func (metrics *retryMetrics) exhausted(op string) {
+	atomic.AddInt64(&metrics.get(op).Exhausted, 1)
+}
+
+// Snapshot return the copy of retry counts by command
+func (metrics *retryMetrics) Snapshot() map[string]RetryStats {
+	snapshot := map[string]RetryStats{}
+	metrics.stats.Range(func(key, value interface{}) bool {
+		stats := value.(*RetryStats)
+		snapshot[key.(string)] = RetryStats{
+			Retries:   atomic.LoadInt64(&stats.Retries),
+			Exhausted: atomic.LoadInt64(&stats.Exhausted),
+		}
+		return true
+	})
+	return snapshot
+}
+
+// do run cmd on primary with retry policy,
+// the connection error is always retried because the command is not sent yet,
+// the timeout or broken connection is retried only for idempotent commands.
+// The circuit breaker count one failure per call, not per attempt
+func (cache *Cacher) do(op string, cmd func(c *redis.Client) error) error {
+	if cache.parent != nil {
+		return cache.parent.do(op, cmd)
+	}
+
+	// Fail immediately while circuit is open, instead of wait for retries
+	err := cache.breaker.allow()
+	if err != nil {
+		return newCacherError("connect", err)
+	}
+
+	policy := cache.config.ConnectionSettings().RetryPolicy()
+	for attempt := 1; ; attempt++ {
+		var c *redis.Client
+		c, err = cache.getClient()
+		if err == nil {
+			err = cmd(c)
+			if err == nil || err == redis.Nil {
+				cache.breaker.success()
+				return err
+			}
+			// The reply error from redis (eg. WRONGTYPE) means redis is up
+			if classifyNetworkError(err) == nil {
+				cache.breaker.success()
+				return err
+			}
+			// The command is sent, only retry if run it again has the same result,
+			// the closed client does not send the command, so it is always retried
+			if !isIdempotentCommand(op) && !errors.Is(err, redis.ErrClosed) {
+				cache.breaker.failure()
+				return err
+			}
+		} else if errors.Is(err, ErrCircuitOpen) {
+			// No need to retry, circuit will fail immediately until open timeout
+			return err
+		}
+
+		if attempt >= policy.MaxAttempts {
+			break
+		}
+		cache.retries.retry(op)
+		time.Sleep(policy.Backoff(attempt))
+	}
+
+	cache.breaker.failure()
+	cache.retries.exhausted(op)
+	return &CacherError{Op: op, Kind: ErrRetriesExhausted, Err: err}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsIdempotentCommand(t *testing.T) {
+	tests := []struct {
+		op   string
+		want bool
+	}{
+		{"Set", true},
+		{"SetS", true},
+		{"MSet", true},
+		{"HSetS", true},
+		{"HMSet", true},
+		{"Del", true},
+		{"HDel", true},
+		{"Expire", true},
+		{"Get", true},
+		// The counters change the value by the current value
+		{"Incr", false},
+		{"IncrBy", false},
+		{"Decr", false},
+		{"DecrBy", false},
+		{"HIncr", false},
+		{"HIncrBy", false},
+		{"HDecr", false},
+		{"HDecrBy", false},
+		{"BitFieldIncrBy", false},
+		{"SetNX", false},
+		{"Pub", false},
+		// The op is case sensitive, it is the name of Cacher method
+		{"incr", true},
+	}
+	for _, tt := range tests {
+		if got := isIdempotentCommand(tt.op); got != tt.want {
+			t.Errorf("isIdempotentCommand(%q) = %v, want %v", tt.op, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	tests := []struct {
+		name  string
+		base  time.Duration
+		max   time.Duration
+		retry int
+		want  time.Duration
+	}{
+		{"first retry", 50 * time.Millisecond, time.Second, 1, 50 * time.Millisecond},
+		{"second retry", 50 * time.Millisecond, time.Second, 2, 100 * time.Millisecond},
+		{"fourth retry", 50 * time.Millisecond, time.Second, 4, 400 * time.Millisecond},
+		{"fifth retry", 50 * time.Millisecond, time.Second, 5, 800 * time.Millisecond},
+		{"limit by max delay", 50 * time.Millisecond, time.Second, 6, time.Second},
+		{"many retries do not overflow", 50 * time.Millisecond, time.Second, 100, time.Second},
+		{"base is more than max", 2 * time.Second, time.Second, 1, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &RetryPolicy{MaxAttempts: 5, BaseDelay: tt.base, MaxDelay: tt.max}
+			if got := policy.Backoff(tt.retry); got != tt.want {
+				t.Errorf("Backoff(%d) = %s, want %s", tt.retry, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoffJitter(t *testing.T) {
+	policy := NewDefaultRetryPolicy()
+	tests := []struct {
+		retry int
+		delay time.Duration
+	}{
+		{1, 50 * time.Millisecond},
+		{3, 200 * time.Millisecond},
+		{10, time.Second},
+	}
+	for _, tt := range tests {
+		min := time.Duration(float64(tt.delay) * (1 - policy.Jitter))
+		max := time.Duration(float64(tt.delay) * (1 + policy.Jitter))
+		randomized := false
+		for i := 0; i < 100; i++ {
+			got := policy.Backoff(tt.retry)
+			if got < min || got > max {
+				t.Fatalf("Backoff(%d) = %s, want in [%s, %s]", tt.retry, got, min, max)
+			}
+			if got != tt.delay {
+				randomized = true
+			}
+		}
+		if !randomized {
+			t.Errorf("Backoff(%d) is always %s, want randomized by jitter", tt.retry, tt.delay)
+		}
+	}
+}
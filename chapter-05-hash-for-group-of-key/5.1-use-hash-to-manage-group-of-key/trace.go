@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Span is the trace span of one redis command (or pipeline)
+type Span struct {
+	TraceID    string   `json:"trace_id"`
+	SpanID     string   `json:"span_id"`
+	Name       string   `json:"name"`
+	Key        string   `json:"key,omitempty"`
+	Commands   []string `json:"commands,omitempty"`
+	Start      string   `json:"start"`
+	DurationUs int64    `json:"duration_us"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// SpanExporterHook write span of every commands as JSON line to writer,
+// the writer can be a local file or the stand-in of trace collector (eg. stdout)
+type SpanExporterHook struct {
+	DefaultCacherHook
+	mutex  sync.Mutex
+	writer io.Writer
+	closer io.Closer
+}
+
+// NewSpanExporterHook return hook that write spans to writer
+func NewSpanExporterHook(writer io.Writer) *SpanExporterHook {
+	return &SpanExporterHook{
+		writer: writer,
+	}
+}
+
+// NewFileSpanExporterHook return hook that append spans to file, close it with Close()
+func NewFileSpanExporterHook(path string) (*SpanExporterHook, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &SpanExporterHook{
+		writer: file,
+		closer: file,
+	}, nil
+}
+
+func (hook *SpanExporterHook) AfterCommand(ctx context.Context, cmd *CommandInfo) {
+	span := hook.newSpan(ctx, "redis."+cmd.Name, cmd)
+	span.Key = cmd.Key
+	hook.export(span)
+}
+
+func (hook *SpanExporterHook) AfterPipeline(ctx context.Context, cmds []*CommandInfo) {
+	if len(cmds) == 0 {
+		return
+	}
+	span := hook.newSpan(ctx, "redis.pipeline", cmds[0])
+	for _, cmd := range cmds {
+		span.Commands = append(span.Commands, cmd.Name)
+		if cmd.Err != nil && len(span.Error) == 0 {
+			span.Error = cmd.Err.Error()
+		}
+	}
+	hook.export(span)
+}
+
+func (hook *SpanExporterHook) newSpan(ctx context.Context, name string, cmd *CommandInfo) *Span {
+	span := &Span{
+		TraceID:    TraceIDFromContext(ctx),
+		SpanID:     NewUUID(),
+		Name:       name,
+		Start:      cmd.Start.Format(time.RFC3339Nano),
+		DurationUs: cmd.Duration.Microseconds(),
+	}
+	if cmd.Err != nil {
+		span.Error = cmd.Err.Error()
+	}
+	return span
+}
+
+func (hook *SpanExporterHook) export(span *Span) {
+	line, err := json.Marshal(span)
+	if err != nil {
+		return
+	}
+	hook.mutex.Lock()
+	defer hook.mutex.Unlock()
+	hook.writer.Write(append(line, '\n'))
+}
+
+// Close close the file of exporter
+func (hook *SpanExporterHook) Close() error {
+	if hook.closer == nil {
+		return nil
+	}
+	hook.mutex.Lock()
+	defer hook.mutex.Unlock()
+	return hook.closer.Close()
+}
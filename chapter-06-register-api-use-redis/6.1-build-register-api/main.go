@@ -2,7 +2,6 @@ package main
 
 import (
 	"encoding/json"
-	"fmt"
 	"net/http"
 
 	_ "github.com/3dsinteractive/wrkgo"
@@ -241,7 +240,10 @@ func createMember(ctx IContext, cfg IConfig, username string) error {
 
 func isDuplidatedUsernameInCache(ctx IContext, cfg IConfig, username string) (bool, error) {
 	cacher := ctx.Cacher(cfg.CacherConfig())
-	cacheKey := getRegisterCacheKey(username)
+	cacheKey, err := getRegisterCacheKey(username)
+	if err != nil {
+		return false, err
+	}
 	exists, err := cacher.Exists(cacheKey)
 	if err != nil {
 		return false, err
@@ -264,7 +266,10 @@ func createMemberInCache(ctx IContext, cfg IConfig, username string) error {
 		IsActive:      1,
 	}
 
-	cacheKey := getRegisterCacheKey(username)
+	cacheKey, err := getRegisterCacheKey(username)
+	if err != nil {
+		return err
+	}
 	err = cacher.SetNoExpire(cacheKey, member)
 	if err != nil {
 		return err
@@ -280,7 +285,10 @@ func isDuplidatedUsernamesInBatch(cacher ICacher, usernames []string) ([]bool, e
 
 	cacheKeys := make([]string, len(usernames))
 	for i, username := range usernames {
-		cacheKey := getRegisterCacheKey(username)
+		cacheKey, err := getRegisterCacheKey(username)
+		if err != nil {
+			return nil, err
+		}
 		cacheKeys[i] = cacheKey
 	}
 
@@ -307,7 +315,10 @@ func createMemberInBatch(cacher ICacher, usernames []string) error {
 
 	members := map[string]interface{}{}
 	for i, username := range usernames {
-		cacheKey := getRegisterCacheKey(username)
+		cacheKey, err := getRegisterCacheKey(username)
+		if err != nil {
+			return err
+		}
 		members[cacheKey] = &Member{
 			ID:            NewUUID(),
 			Username:      username,
@@ -324,8 +335,8 @@ func createMemberInBatch(cacher ICacher, usernames []string) error {
 	return nil
 }
 
-func getRegisterCacheKey(username string) string {
-	return fmt.Sprintf("register::%s", username)
+func getRegisterCacheKey(username string) (string, error) {
+	return KeyRegister.Key(username)
 }
 
 func nextRegisterOrder(ctx IContext, cfg IConfig) (int, error) {
@@ -0,0 +1,25 @@
+package main
+
+// keySchemas is the registry of every key families of this lesson
+var keySchemas = NewKeyRegistry()
+
+var (
+	// KeyCountryCounter is the popcat counter of country, eg. counter::thailand, counter::japan
+	KeyCountryCounter = keySchemas.Register(&KeyFamily{
+		Name:             "country_counter",
+		Pattern:          "counter::{country}",
+		ValueType:        KeyValueCounter,
+		DefaultTTL:       0,
+		EvictionCritical: true,
+		Version:          1,
+	})
+	// KeyAutonumber is the running number of cacher.Autonumber
+	KeyAutonumber = keySchemas.Register(&KeyFamily{
+		Name:             "autonumber",
+		Pattern:          "autonumber_{name}",
+		ValueType:        KeyValueCounter,
+		DefaultTTL:       0,
+		EvictionCritical: true,
+		Version:          1,
+	})
+)
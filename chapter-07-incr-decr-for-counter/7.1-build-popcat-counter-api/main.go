@@ -2,7 +2,6 @@ package main
 
 import (
 	"encoding/json"
-	"fmt"
 	"net/http"
 
 	_ "github.com/3dsinteractive/wrkgo"
@@ -139,7 +138,10 @@ func main() {
 
 func increaseCounter(ctx IContext, cfg IConfig, country string) (int /*counter*/, error) {
 	cacher := ctx.Cacher(cfg.CacherConfig())
-	cacheKey := countryCounterCacheKey(country)
+	cacheKey, err := countryCounterCacheKey(country)
+	if err != nil {
+		return 0, err
+	}
 
 	// return counter is the number after increment
 	counter, err := cacher.Incr(cacheKey)
@@ -150,15 +152,18 @@ func increaseCounter(ctx IContext, cfg IConfig, country string) (int /*counter*/
 }
 
 func increaseCounterBy(cacher ICacher, country string, counter int) (int /*counter*/, error) {
-	cacheKey := countryCounterCacheKey(country)
-	counter, err := cacher.IncrBy(cacheKey, counter)
+	cacheKey, err := countryCounterCacheKey(country)
+	if err != nil {
+		return 0, err
+	}
+	counter, err = cacher.IncrBy(cacheKey, counter)
 	if err != nil {
 		return 0, err
 	}
 	return counter, nil
 }
 
-func countryCounterCacheKey(country string) string {
+func countryCounterCacheKey(country string) (string, error) {
 	// key format "counter::thailand", "counter::japan"
-	return fmt.Sprintf("counter::%s", country)
+	return KeyCountryCounter.Key(country)
 }
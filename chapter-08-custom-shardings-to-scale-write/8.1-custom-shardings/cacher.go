@@ -40,6 +40,8 @@ type ICacher interface {
 	SetS(key string, value string, expire time.Duration) error
 	SetNoExpire(key string, value interface{}) error
 	SetSNoExpire(key string, value string) error
+	// SetSKeepTTL set value and keep the current expire of key, it is used to copy the result of counter to backup shard
+	SetSKeepTTL(key string, value string) error
 	IncrBy(key string, val int) (int, error)
 	DecrBy(key string, val int) (int, error)
 	Incr(key string) (int, error)
@@ -65,8 +67,13 @@ type ICacher interface {
 // ICacherConfig is cacher configuration interface
 type ICacherConfig interface {
 	Endpoint() string
+	// ClusterEndpoints is the seed nodes of redis cluster, if not empty, cacher use cluster client
+	ClusterEndpoints() []string
 	Password() string
 	DB() int
+	// KeyPrefix is the namespace of service, it is added to every keys and channels, eg. lesson8.1:
+	// so the services that share redis DB do not see (or delete) the keys of each others
+	KeyPrefix() string
 	ConnectionSettings() ICacherConnectionSettings
 }
 
@@ -134,14 +141,16 @@ func (setting *DefaultCacherConnectionSettings) WriteTimeout() time.Duration {
 type pubsubChannels struct {
 	ps       *redis.PubSub
 	channels []string
+	// done is closed by Unsub to stop the forwarder of messages
+	done chan struct{}
 }
 
 // Cacher is the struct for cache service
 type Cacher struct {
 	config      ICacherConfig
 	clientMutex sync.Mutex
-	client      *redis.Client
-	oldClients  []*redis.Client
+	client      redis.UniversalClient
+	oldClients  []redis.UniversalClient
 	subsribers  *sync.Map
 	serviceID   int
 }
@@ -155,10 +164,30 @@ func NewCacher(config ICacherConfig) *Cacher {
 	}
 }
 
-func (cache *Cacher) newClient() *redis.Client {
+func (cache *Cacher) newClient() redis.UniversalClient {
 	cfg := cache.config
 	settings := cfg.ConnectionSettings()
-	return redis.NewClient(&redis.Options{
+	if cache.isCluster() {
+		// Cluster has no DB, every node use DB 0,
+		// the hook is added to cluster client, so the hash slot is calculated from the prefixed key
+		client := redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:              cfg.ClusterEndpoints(),
+			Password:           cfg.Password(),
+			PoolSize:           settings.PoolSize(),
+			MinIdleConns:       settings.MinIdleConns(),
+			MaxRetries:         settings.MaxRetries(),
+			MinRetryBackoff:    settings.MinRetryBackoff(),
+			MaxRetryBackoff:    settings.MaxRetryBackoff(),
+			IdleTimeout:        settings.IdleTimeout(),
+			IdleCheckFrequency: settings.IdleCheckFrequency(),
+			PoolTimeout:        settings.PoolTimeout(),
+			ReadTimeout:        settings.ReadTimeout(),
+			WriteTimeout:       settings.WriteTimeout(),
+		})
+		cache.addKeyPrefixHook(client)
+		return client
+	}
+	client := redis.NewClient(&redis.Options{
 		Addr:               cfg.Endpoint(),
 		Password:           cfg.Password(),
 		DB:                 cfg.DB(),
@@ -173,9 +202,15 @@ func (cache *Cacher) newClient() *redis.Client {
 		ReadTimeout:        settings.ReadTimeout(),
 		WriteTimeout:       settings.WriteTimeout(),
 	})
+	cache.addKeyPrefixHook(client)
+	return client
 }
 
-func (cache *Cacher) getClient() (*redis.Client, error) {
+func (cache *Cacher) isCluster() bool {
+	return len(cache.config.ClusterEndpoints()) > 0
+}
+
+func (cache *Cacher) getClient() (redis.UniversalClient, error) {
 	cache.clientMutex.Lock()
 	defer cache.clientMutex.Unlock()
 
@@ -236,7 +271,7 @@ func (cache *Cacher) Close() error {
 	return nil
 }
 
-// Keys returns keys by given pattern
+// Keys returns keys by given pattern, in cluster mode keys are scanned from every master nodes
 func (cache *Cacher) Keys(pattern string) ([]string, error) {
 
 	c, err := cache.getClient()
@@ -244,10 +279,54 @@ func (cache *Cacher) Keys(pattern string) ([]string, error) {
 		return nil, err
 	}
 
+	// Scan can return duplidate item, so we use map to collect result set
 	allKeys := map[string]interface{}{}
 
+	cluster, ok := c.(*redis.ClusterClient)
+	if ok {
+		allKeysMutex := sync.Mutex{}
+		err = cluster.ForEachMaster(context.Background(), func(ctx context.Context, client *redis.Client) error {
+			// The node client has no keyPrefixHook, so the prefix is added to pattern here
+			keys, err := cache.scanKeys(client, cache.pattern(pattern))
+			if err != nil {
+				return err
+			}
+
+			allKeysMutex.Lock()
+			for _, key := range keys {
+				allKeys[key] = struct{}{}
+			}
+			allKeysMutex.Unlock()
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		keys, err := cache.scanKeys(c, pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			allKeys[key] = struct{}{}
+		}
+	}
+
+	// The key prefix is removed, so the keys can be passed to other commands
+	retKeys := []string{}
+	for key := range allKeys {
+		retKeys = append(retKeys, cache.unprefixKey(key))
+	}
+	return retKeys, nil
+}
+
+// scanKeys scan all keys by given pattern from one node, the result can contains duplicated key
+func (cache *Cacher) scanKeys(c redis.Cmdable, pattern string) ([]string, error) {
+
+	var err error
 	var nextCursor uint64
 	var keys []string
+	allKeys := []string{}
 
 	retryLimit := 3
 	for {
@@ -260,10 +339,7 @@ func (cache *Cacher) Keys(pattern string) ([]string, error) {
 		if err != nil {
 			continue
 		}
-		// Scan can return duplidate item, so we use map to collect result set
-		for _, key := range keys {
-			allKeys[key] = struct{}{}
-		}
+		allKeys = append(allKeys, keys...)
 
 		break // break retryLimit
 	}
@@ -285,22 +361,14 @@ func (cache *Cacher) Keys(pattern string) ([]string, error) {
 			if err != nil {
 				continue
 			}
-
-			// Scan can return duplidate item, so we use map to collect result set
-			for _, key := range keys {
-				allKeys[key] = struct{}{}
-			}
+			allKeys = append(allKeys, keys...)
 
 			break // retryLimit
 		}
 
 	}
 
-	retKeys := []string{}
-	for key := range allKeys {
-		retKeys = append(retKeys, key)
-	}
-	return retKeys, nil
+	return allKeys, nil
 }
 
 // getRetriesDelayInMs sum only 1 second
@@ -338,6 +406,113 @@ func (cache *Cacher) Exists(key string) (bool, error) {
 	return val == 1, nil
 }
 
+// Scan return one page of keys that match pattern and the next cursor, 0 next cursor means scan is done
+func (cache *Cacher) Scan(cursor uint64, pattern string, count int64) ([]string, uint64 /*next cursor*/, error) {
+
+	c, err := cache.getClient()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	keys, nextCursor, err := c.Scan(context.Background(), cursor, pattern, count).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	// The key prefix is removed, so the keys can be passed to other commands
+	for i, key := range keys {
+		keys[i] = cache.unprefixKey(key)
+	}
+	return keys, nextCursor, nil
+}
+
+// Dump return value of key in redis serialized format, return "" if key is not exists
+func (cache *Cacher) Dump(key string) (string, error) {
+
+	c, err := cache.getClient()
+	if err != nil {
+		return "", err
+	}
+
+	val, err := c.Dump(context.Background(), key).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return "", nil
+		}
+		return "", err
+	}
+	return val, nil
+}
+
+// Restore create key from value of Dump, 0 ttl means no expire,
+// return false if key is already exists (the existing key is not replaced)
+func (cache *Cacher) Restore(key string, ttl time.Duration, value string) (bool, error) {
+
+	c, err := cache.getClient()
+	if err != nil {
+		return false, err
+	}
+
+	err = c.Restore(context.Background(), key, ttl, value).Err()
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "BUSYKEY") {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// RestoreReplace create or replace key from value of Dump, 0 ttl means no expire
+func (cache *Cacher) RestoreReplace(key string, ttl time.Duration, value string) error {
+
+	c, err := cache.getClient()
+	if err != nil {
+		return err
+	}
+
+	return c.RestoreReplace(context.Background(), key, ttl, value).Err()
+}
+
+// delIfDumpScript delete KEYS[1] only if its DUMP is ARGV[1]
+var delIfDumpScript = redis.NewScript(`
+if redis.call('DUMP', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// DelIfDump delete key only if its value is the same as value of Dump,
+// so the key that is written after the Dump is not deleted
+func (cache *Cacher) DelIfDump(key string, value string) (bool, error) {
+
+	c, err := cache.getClient()
+	if err != nil {
+		return false, err
+	}
+
+	deleted, err := delIfDumpScript.Run(context.Background(), c, []string{key}, value).Int64()
+	if err != nil {
+		return false, err
+	}
+	return deleted == 1, nil
+}
+
+// PTTL return the remaining time to live of key,
+// -1 means key has no expire and -2 means key is not exists
+func (cache *Cacher) PTTL(key string) (time.Duration, error) {
+
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	ttl, err := c.PTTL(context.Background(), key).Result()
+	if err != nil {
+		return 0, err
+	}
+	return ttl, nil
+}
+
 // Del the cache by keys
 func (cache *Cacher) Del(keys ...string) error {
 	if len(keys) == 0 {
@@ -369,7 +544,7 @@ func (cache *Cacher) Del(keys ...string) error {
 			break
 		}
 
-		_, err = c.Del(context.Background(), delKeys...).Result()
+		err = cache.del(c, delKeys)
 		if err != nil {
 			if err == redis.Nil {
 				continue
@@ -384,6 +559,26 @@ func (cache *Cacher) Del(keys ...string) error {
 	return nil
 }
 
+// del delete keys, in cluster mode keys are deleted by hash slot in single pipeline
+func (cache *Cacher) del(c redis.UniversalClient, keys []string) error {
+	if !cache.isCluster() {
+		return c.Del(context.Background(), keys...).Err()
+	}
+
+	_, err := c.Pipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		// The slot is calculated from the prefixed key, it is the key that keyPrefixHook send to redis
+		for _, idxs := range groupKeysBySlot(cache.prefixKeys(keys)) {
+			slotKeys := make([]string, len(idxs))
+			for i, idx := range idxs {
+				slotKeys[i] = keys[idx]
+			}
+			pipe.Del(context.Background(), slotKeys...)
+		}
+		return nil
+	})
+	return err
+}
+
 // Expires set expiration for objects in cache
 // if there is error happen, just return last error
 func (cache *Cacher) Expires(keys []string, expire time.Duration) error {
@@ -426,6 +621,10 @@ func (cache *Cacher) MGet(keys []string) ([]interface{}, error) {
 		return nil, err
 	}
 
+	if cache.isCluster() {
+		return cache.mgetBySlots(c, keys)
+	}
+
 	vals, err := c.MGet(context.Background(), keys...).Result()
 	if err == redis.Nil {
 		// Key does not exists
@@ -437,6 +636,46 @@ func (cache *Cacher) MGet(keys []string) ([]interface{}, error) {
 	return vals, nil
 }
 
+// mgetBySlots split keys by hash slot and MGET each slot in single pipeline,
+// then merge the values back in the order of keys
+func (cache *Cacher) mgetBySlots(c redis.UniversalClient, keys []string) ([]interface{}, error) {
+
+	// The slot is calculated from the prefixed key, it is the key that keyPrefixHook send to redis
+	groups := groupKeysBySlot(cache.prefixKeys(keys))
+	slotIdxs := make([][]int, 0, len(groups))
+	slotCmds := make([]*redis.SliceCmd, 0, len(groups))
+
+	_, err := c.Pipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		for _, idxs := range groups {
+			slotKeys := make([]string, len(idxs))
+			for i, idx := range idxs {
+				slotKeys[i] = keys[idx]
+			}
+			slotIdxs = append(slotIdxs, idxs)
+			slotCmds = append(slotCmds, pipe.MGet(context.Background(), slotKeys...))
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	vals := make([]interface{}, len(keys))
+	for i, cmd := range slotCmds {
+		slotVals, err := cmd.Result()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		for j, idx := range slotIdxs[i] {
+			if j < len(slotVals) {
+				vals[idx] = slotVals[j]
+			}
+		}
+	}
+
+	return vals, nil
+}
+
 // Get object from cache
 func (cache *Cacher) Get(key string) (string, error) {
 
@@ -486,6 +725,22 @@ func (cache *Cacher) MSet(kv map[string]interface{}) error {
 		pairs = append(pairs, k, strb)
 	}
 
+	if cache.isCluster() {
+		// Keys in different hash slot cannot MSET together, so MSET by slot in single pipeline
+		_, err = c.Pipelined(context.Background(), func(pipe redis.Pipeliner) error {
+			slotPairs := map[int][]interface{}{}
+			for i := 0; i < len(pairs); i += 2 {
+				slot := HashSlot(cache.config.KeyPrefix() + pairs[i].(string))
+				slotPairs[slot] = append(slotPairs[slot], pairs[i], pairs[i+1])
+			}
+			for _, pairs := range slotPairs {
+				pipe.MSet(context.Background(), pairs...)
+			}
+			return nil
+		})
+		return err
+	}
+
 	err = c.MSet(context.Background(), pairs...).Err()
 	if err != nil {
 		return err
@@ -592,6 +847,27 @@ func (cache *Cacher) SetSNoExpire(key string, value string) error {
 	return nil
 }
 
+// setKeepTTLScript is SET KEEPTTL that also work before redis 6.0
+var setKeepTTLScript = redis.NewScript(`
+local ttl = redis.call('PTTL', KEYS[1])
+redis.call('SET', KEYS[1], ARGV[1])
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return 1
+`)
+
+// SetSKeepTTL set string into cache and keep the current expire of key, the new key has no expire
+func (cache *Cacher) SetSKeepTTL(key string, value string) error {
+
+	c, err := cache.getClient()
+	if err != nil {
+		return err
+	}
+
+	return setKeepTTLScript.Run(context.Background(), c, []string{key}, value).Err()
+}
+
 // SetNoExpire set object into cache no expired
 func (cache *Cacher) SetNoExpire(key string, value interface{}) error {
 
@@ -1389,7 +1665,10 @@ func NewBitFieldCmdU32(cmdType BitFieldCmdType, itemPosition int, value int) *Bi
 }
 
 func (cache *Cacher) Autonumber(name string) (int, error) {
-	key := fmt.Sprintf("autonumber_%s", name)
+	key, err := KeyAutonumber.Key(name)
+	if err != nil {
+		return -1, err
+	}
 	nextNumber, err := cache.Incr(key)
 	if err != nil {
 		return -1, err
@@ -1434,15 +1713,19 @@ func (cache *Cacher) Sub(channels ...string) (<-chan *redis.Message /*subID (use
 		return nil, "", err
 	}
 
+	// SUBSCRIBE is not sent through hooks, so add the key prefix here
+	channels = cache.prefixKeys(channels)
 	ps := c.Subscribe(context.Background(), channels...)
 	subID := NewUUID()
+	done := make(chan struct{})
 
 	cache.subsribers.Store(subID, &pubsubChannels{
 		ps:       ps,
 		channels: channels,
+		done:     done,
 	})
 
-	return ps.Channel(), subID, nil
+	return cache.unprefixMessages(ps.Channel(), done), subID, nil
 }
 
 // Unsub will unsub subscriber
@@ -1451,7 +1734,7 @@ func (cache *Cacher) Unsub(subID string) error {
 		return nil
 	}
 
-	psChannels, ok := cache.subsribers.Load(subID)
+	psChannels, ok := cache.subsribers.LoadAndDelete(subID)
 	if !ok {
 		return nil
 	}
@@ -1459,6 +1742,7 @@ func (cache *Cacher) Unsub(subID string) error {
 	if !ok {
 		return nil
 	}
+	close(pubsubChannels.done)
 
 	if pubsubChannels.ps != nil {
 		err := pubsubChannels.ps.Unsubscribe(context.Background(), pubsubChannels.channels...)
@@ -1473,7 +1757,5 @@ func (cache *Cacher) Unsub(subID string) error {
 		}
 	}
 
-	cache.subsribers.Delete(subID)
-
 	return nil
 }
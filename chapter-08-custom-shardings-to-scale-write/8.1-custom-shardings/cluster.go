@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// clusterSlots is the number of hash slots in redis cluster
+const clusterSlots = 16384
+
+// HashTag return {tag}, only the tag is hashed in redis cluster,
+// so keys that has the same hash tag will be in the same hash slot (same node)
+func HashTag(tag string) string {
+	return fmt.Sprintf("{%s}", tag)
+}
+
+// KeyHashTag return the part of key that redis cluster use to calculate hash slot,
+// if key has non empty {tag}, return the tag, otherwise return the key
+func KeyHashTag(key string) string {
+	start := strings.IndexByte(key, '{')
+	if start < 0 {
+		return key
+	}
+	end := strings.IndexByte(key[start+1:], '}')
+	// No closing } or empty {}, the whole key is hashed
+	if end <= 0 {
+		return key
+	}
+	return key[start+1 : start+1+end]
+}
+
+// HashSlot return the redis cluster hash slot of key
+func HashSlot(key string) int {
+	return int(crc16(KeyHashTag(key)) % clusterSlots)
+}
+
+// groupKeysBySlot group keys by hash slot, the value is the indexes of keys in the group
+// so the result can be merged back in the original order
+func groupKeysBySlot(keys []string) map[int][]int {
+	groups := map[int][]int{}
+	for i, key := range keys {
+		slot := HashSlot(key)
+		groups[slot] = append(groups[slot], i)
+	}
+	return groups
+}
+
+// crc16 is CRC16-CCITT (XMODEM) that redis cluster use to calculate hash slot
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = (crc << 1) ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
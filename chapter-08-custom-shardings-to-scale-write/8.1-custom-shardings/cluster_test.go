@@ -0,0 +1,93 @@
+package main
+
+import "testing"
+
+func TestCRC16(t *testing.T) {
+	tests := []struct {
+		input string
+		want  uint16
+	}{
+		// The check value of CRC16-CCITT (XMODEM) in the redis cluster spec
+		{"123456789", 0x31C3},
+		{"", 0},
+		{"a", 0x7C87},
+	}
+	for _, tt := range tests {
+		if got := crc16(tt.input); got != tt.want {
+			t.Errorf("crc16(%q) = %#04x, want %#04x", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestKeyHashTag(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"user1000", "user1000"},
+		{"{user1000}.following", "user1000"},
+		{"{user1000}.followers", "user1000"},
+		// Only the first {} is the hash tag
+		{"foo{bar}{zap}", "bar"},
+		// Empty {} hash the whole key
+		{"foo{}{bar}", "foo{}{bar}"},
+		{"foo{{bar}}zap", "{bar"},
+		// No closing }
+		{"foo{bar", "foo{bar"},
+		{"register::{user_1}", "user_1"},
+	}
+	for _, tt := range tests {
+		if got := KeyHashTag(tt.key); got != tt.want {
+			t.Errorf("KeyHashTag(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestHashSlot(t *testing.T) {
+	tests := []struct {
+		key  string
+		want int
+	}{
+		// The slots from CLUSTER KEYSLOT of redis
+		{"foo", 12182},
+		{"bar", 5061},
+		{"hello", 866},
+		{"{user1000}.following", HashSlot("user1000")},
+		{"register::" + HashTag("user_1"), HashSlot("user_1")},
+	}
+	for _, tt := range tests {
+		if got := HashSlot(tt.key); got != tt.want {
+			t.Errorf("HashSlot(%q) = %d, want %d", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestGroupKeysBySlot(t *testing.T) {
+	keys := []string{"{a}1", "{b}1", "{a}2", "{b}2", "c"}
+	groups := groupKeysBySlot(keys)
+
+	tests := []struct {
+		key  string
+		want []int
+	}{
+		{"{a}1", []int{0, 2}},
+		{"{b}1", []int{1, 3}},
+		{"c", []int{4}},
+	}
+	for _, tt := range tests {
+		got := groups[HashSlot(tt.key)]
+		if len(got) != len(tt.want) {
+			t.Errorf("group of %q = %v, want %v", tt.key, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("group of %q = %v, want %v", tt.key, got, tt.want)
+				break
+			}
+		}
+	}
+	if len(groups) != 3 {
+		t.Errorf("len(groups) = %d, want 3", len(groups))
+	}
+}
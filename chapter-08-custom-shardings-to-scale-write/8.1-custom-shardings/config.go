@@ -1,46 +1,99 @@
 package main
 
+import "strings"
+
 type IConfig interface {
 	PersisterConfig() IPersisterConfig
-	CacherConfig1() ICacherConfig
-	CacherConfig2() ICacherConfig
-	CacherConfig3() ICacherConfig
-	CacherConfig4() ICacherConfig
-	CacherConfig5() ICacherConfig
+	// CacherConfig is the config of single redis (no shardings)
+	CacherConfig() ICacherConfig
+	// CacherShards is the config of every shards
+	CacherShards() []*ShardConfig
+	// CacherRing is the consistent hash ring of CacherShards
+	CacherRing() *HashRing
+	// CacherReplicationFactor is the number of shards that keep each key, 1 means no backup shard
+	CacherReplicationFactor() int
+	// CacherNextShards is the shards after resharding, the reshard command move keys from CacherShards
+	CacherNextShards() []*ShardConfig
+	// CacherNextRing is the consistent hash ring of CacherNextShards
+	CacherNextRing() *HashRing
+	// CacherDualRead is true while keys are moving to CacherNextRing,
+	// read from the next ring first and fall back to the current ring on a miss
+	CacherDualRead() bool
+	CacherClusterConfig() ICacherConfig
+}
+
+type Config struct {
+	ring     *HashRing
+	nextRing *HashRing
 }
 
-type Config struct{}
-
 func NewConfig() IConfig {
-	return &Config{}
+	cfg := &Config{}
+	cfg.ring = NewHashRing(cfg.CacherShards(), defaultVirtualNodes).
+		SetReplicationFactor(cfg.CacherReplicationFactor())
+	cfg.nextRing = NewHashRing(cfg.CacherNextShards(), defaultVirtualNodes).
+		SetReplicationFactor(cfg.CacherReplicationFactor())
+	return cfg
 }
 
 func (cfg *Config) PersisterConfig() IPersisterConfig {
 	return NewPersisterConfig()
 }
 
-func (cfg *Config) CacherConfig1() ICacherConfig {
+func (cfg *Config) CacherConfig() ICacherConfig {
 	return NewCacherConfig("127.0.0.1:6379")
 }
 
-func (cfg *Config) CacherConfig2() ICacherConfig {
-	return NewCacherConfig("127.0.0.1:6380")
+// CacherShards return the shards, add new shard to the list to scale,
+// only about 1/N of keys are moved to the new shard
+func (cfg *Config) CacherShards() []*ShardConfig {
+	return []*ShardConfig{
+		NewShardConfig("shard1", 1, NewCacherConfig("127.0.0.1:6379")),
+		NewShardConfig("shard2", 1, NewCacherConfig("127.0.0.1:6380")),
+		NewShardConfig("shard3", 1, NewCacherConfig("127.0.0.1:6381")),
+		NewShardConfig("shard4", 1, NewCacherConfig("127.0.0.1:6382")),
+		NewShardConfig("shard5", 1, NewCacherConfig("127.0.0.1:6383")),
+	}
+}
+
+func (cfg *Config) CacherRing() *HashRing {
+	return cfg.ring
+}
+
+// CacherReplicationFactor return 1 to keep each key only in its primary shard,
+// return 2 to write each key to the primary and one backup shard
+func (cfg *Config) CacherReplicationFactor() int {
+	return 1
+}
+
+// CacherNextShards return the shards after grow from 5 to 8 shards
+func (cfg *Config) CacherNextShards() []*ShardConfig {
+	return append(cfg.CacherShards(),
+		NewShardConfig("shard6", 1, NewCacherConfig("127.0.0.1:6384")),
+		NewShardConfig("shard7", 1, NewCacherConfig("127.0.0.1:6385")),
+		NewShardConfig("shard8", 1, NewCacherConfig("127.0.0.1:6386")),
+	)
 }
 
-func (cfg *Config) CacherConfig3() ICacherConfig {
-	return NewCacherConfig("127.0.0.1:6381")
+func (cfg *Config) CacherNextRing() *HashRing {
+	return cfg.nextRing
 }
 
-func (cfg *Config) CacherConfig4() ICacherConfig {
-	return NewCacherConfig("127.0.0.1:6382")
+func (cfg *Config) CacherDualRead() bool {
+	return false
 }
 
-func (cfg *Config) CacherConfig5() ICacherConfig {
-	return NewCacherConfig("127.0.0.1:6383")
+func (cfg *Config) CacherClusterConfig() ICacherConfig {
+	return NewClusterCacherConfig(
+		"127.0.0.1:7000",
+		"127.0.0.1:7001",
+		"127.0.0.1:7002",
+	)
 }
 
 type CacherConfig struct {
-	endpoint string
+	endpoint         string
+	clusterEndpoints []string
 }
 
 func NewCacherConfig(endpoint string) *CacherConfig {
@@ -49,10 +102,22 @@ func NewCacherConfig(endpoint string) *CacherConfig {
 	}
 }
 
+// NewClusterCacherConfig return config of redis cluster from seed nodes
+func NewClusterCacherConfig(endpoints ...string) *CacherConfig {
+	return &CacherConfig{
+		endpoint:         strings.Join(endpoints, ","),
+		clusterEndpoints: endpoints,
+	}
+}
+
 func (cfg *CacherConfig) Endpoint() string {
 	return cfg.endpoint
 }
 
+func (cfg *CacherConfig) ClusterEndpoints() []string {
+	return cfg.clusterEndpoints
+}
+
 func (cfg *CacherConfig) Password() string {
 	return ""
 }
@@ -61,6 +126,11 @@ func (cfg *CacherConfig) DB() int {
 	return 0
 }
 
+// KeyPrefix is the namespace of this lesson, setup() delete only the keys in this namespace
+func (cfg *CacherConfig) KeyPrefix() string {
+	return "lesson8.1:"
+}
+
 func (cfg *CacherConfig) ConnectionSettings() ICacherConnectionSettings {
 	return NewDefaultCacherConnectionSettings()
 }
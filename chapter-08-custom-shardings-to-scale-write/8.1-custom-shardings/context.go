@@ -10,5 +10,6 @@ type IContext interface {
 	ResponseS(responseCode int, responseData string)
 
 	Cacher(cfg ICacherConfig) ICacher
+	ShardedCacher(ring *HashRing) ICacher
 	Persister(cfg IPersisterConfig) IPersister
 }
@@ -59,6 +59,10 @@ func (ctx *HTTPContext) Cacher(cfg ICacherConfig) ICacher {
 	return ctx.ms.Cacher(cfg)
 }
 
+func (ctx *HTTPContext) ShardedCacher(ring *HashRing) ICacher {
+	return ctx.ms.ShardedCacher(ring)
+}
+
 func (ctx *HTTPContext) Persister(cfg IPersisterConfig) IPersister {
 	return ctx.ms.Persister(cfg)
 }
@@ -0,0 +1,25 @@
+package main
+
+// keySchemas is the registry of every key families of this lesson
+var keySchemas = NewKeyRegistry()
+
+var (
+	// KeyRegister is the member that is registered by username, it is used to check the duplicated username
+	KeyRegister = keySchemas.Register(&KeyFamily{
+		Name:             "register",
+		Pattern:          "register::{username}",
+		ValueType:        KeyValueJSON,
+		DefaultTTL:       0,
+		EvictionCritical: true,
+		Version:          1,
+	})
+	// KeyAutonumber is the running number of cacher.Autonumber
+	KeyAutonumber = keySchemas.Register(&KeyFamily{
+		Name:             "autonumber",
+		Pattern:          "autonumber_{name}",
+		ValueType:        KeyValueCounter,
+		DefaultTTL:       0,
+		EvictionCritical: true,
+		Version:          1,
+	})
+)
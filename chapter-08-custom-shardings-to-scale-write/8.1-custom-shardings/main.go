@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
 
 	_ "github.com/3dsinteractive/wrkgo"
 )
@@ -15,6 +16,16 @@ func main() {
 	// 1. Create microservices
 	ms := NewMicroservice()
 
+	// Run "./main reshard" to move keys from CacherRing to CacherNextRing then exit,
+	// it can be stopped and run again, the migration resume from the last checkpoint
+	if len(os.Args) > 1 && os.Args[1] == "reshard" {
+		err := reshard(cfg)
+		if err != nil {
+			ms.Log("Main", err.Error())
+		}
+		return
+	}
+
 	// 2. Migrate and seed 100,000 members
 	ms.Log("Main", "Clearing cache...")
 	err := setup(cfg)
@@ -122,41 +133,105 @@ func main() {
 	// 	return nil
 	// })
 
-	// 5. Cleanup when exit
+	// 5. Register api use redis cluster
+	//    redis cluster split keys by hash slot to the master nodes
+	// ms.POST("/register", func(ctx IContext) error {
+	// 	// input format = {"username": "user_1@domain.com"}
+	// 	input := ctx.ReadInput()
+	// 	payload := map[string]interface{}{}
+	// 	err := json.Unmarshal([]byte(input), &payload)
+	// 	if err != nil {
+	// 		ctx.Response(http.StatusOK, map[string]interface{}{
+	// 			"status": "invalid input",
+	// 			"error":  err.Error(),
+	// 		})
+	// 		return nil
+	// 	}
+
+	// 	username, ok := payload["username"].(string)
+	// 	if !ok {
+	// 		ctx.Response(http.StatusOK, map[string]interface{}{"status": "invalid input"})
+	// 		return nil
+	// 	}
+
+	// 	cacher := ctx.Cacher(cfg.CacherClusterConfig())
+	// 	cacheKey := getRegisterCacheKeyInCluster(username)
+	// 	duplicated, err := cacher.Exists(cacheKey)
+	// 	if err != nil {
+	// 		ctx.Response(http.StatusInternalServerError, map[string]interface{}{
+	// 			"status": "error",
+	// 			"error":  err.Error(),
+	// 		})
+	// 		return nil
+	// 	}
+	// 	if duplicated {
+	// 		ctx.Response(http.StatusOK, map[string]interface{}{"status": "duplicated"})
+	// 		return nil
+	// 	}
+
+	// 	member := &Member{
+	// 		ID:       NewUUID(),
+	// 		Username: username,
+	// 		IsActive: 1,
+	// 	}
+	// 	err = cacher.SetNoExpire(cacheKey, member)
+	// 	if err != nil {
+	// 		ctx.Response(http.StatusInternalServerError, map[string]interface{}{
+	// 			"status": "error",
+	// 			"error":  err.Error(),
+	// 		})
+	// 		return nil
+	// 	}
+
+	// 	resp := map[string]interface{}{
+	// 		"status": "ok",
+	// 	}
+	// 	ctx.Response(http.StatusOK, resp)
+	// 	return nil
+	// })
+
+	// 6. Cleanup when exit
 	defer ms.Cleanup()
 	ms.Start()
 }
 
-// getConfigOfShards will hash username and return config according to the has of username
-func getConfigOfShards(cfg IConfig, username string) ICacherConfig {
-	cfgs := []ICacherConfig{
-		cfg.CacherConfig1(),
-		cfg.CacherConfig2(),
-		cfg.CacherConfig3(),
-		cfg.CacherConfig4(),
-		cfg.CacherConfig5(),
+// getShardedCacher return cacher of the hash ring, while resharding it read from the next ring first
+// and fall back to the current ring on a miss, the writes go to the next ring
+func getShardedCacher(ctx IContext, cfg IConfig) ICacher {
+	if cfg.CacherDualRead() {
+		return NewDualReadCacher(ctx.ShardedCacher(cfg.CacherNextRing()), ctx.ShardedCacher(cfg.CacherRing()))
 	}
-	hash := FastHash(username)
-	shards := hash % uint64(len(cfgs))
-	return cfgs[shards]
+	return ctx.ShardedCacher(cfg.CacherRing())
+}
+
+// reshard move register keys that change owner from CacherRing to CacherNextRing
+func reshard(cfg IConfig) error {
+	migrator := NewMigrator(cfg.CacherRing(), cfg.CacherNextRing(), NewDefaultMigrationOptions())
+	defer migrator.Close()
+
+	report, err := migrator.Run()
+	if report != nil {
+		js, _ := json.Marshal(report)
+		fmt.Println(string(js))
+	}
+	return err
 }
 
 func isDuplidatedUsernameInShard(ctx IContext, cfg IConfig, username string) (bool, error) {
-	// get cache config accoding to the hash of username
-	cacheCfg := getConfigOfShards(cfg, username)
-	cacher := ctx.Cacher(cacheCfg)
+	// sharded cacher route the key to the shard that own it in the hash ring
+	cacher := getShardedCacher(ctx, cfg)
 	cacheKey := getRegisterCacheKey(username)
 	exists, err := cacher.Exists(cacheKey)
 	if err != nil {
-		return false, nil
+		// Do not treat error as not duplicated, the username may be registered on the failed shard
+		return false, err
 	}
 	return exists, nil
 }
 
 func createMemberInShard(ctx IContext, cfg IConfig, username string) error {
-	// get cache config accoding to the hash of username
-	cacheCfg := getConfigOfShards(cfg, username)
-	cacher := ctx.Cacher(cacheCfg)
+	// sharded cacher route the key to the shard that own it in the hash ring
+	cacher := getShardedCacher(ctx, cfg)
 	member := &Member{
 		ID:       NewUUID(),
 		Username: username,
@@ -172,7 +247,7 @@ func createMemberInShard(ctx IContext, cfg IConfig, username string) error {
 }
 
 func isDuplidatedUsername(ctx IContext, cfg IConfig, username string) (bool, error) {
-	cacher := ctx.Cacher(cfg.CacherConfig1())
+	cacher := ctx.Cacher(cfg.CacherConfig())
 	cacheKey := getRegisterCacheKey(username)
 	exists, err := cacher.Exists(cacheKey)
 	if err != nil {
@@ -183,7 +258,7 @@ func isDuplidatedUsername(ctx IContext, cfg IConfig, username string) (bool, err
 
 func createMember(ctx IContext, cfg IConfig, username string) error {
 
-	cacher := ctx.Cacher(cfg.CacherConfig1())
+	cacher := ctx.Cacher(cfg.CacherConfig())
 	member := &Member{
 		ID:       NewUUID(),
 		Username: username,
@@ -200,11 +275,17 @@ func createMember(ctx IContext, cfg IConfig, username string) error {
 }
 
 func getRegisterCacheKey(username string) string {
-	return fmt.Sprintf("register::%s", username)
+	return KeyRegister.MustKey(username)
+}
+
+// getRegisterCacheKeyInCluster use username as hash tag,
+// so every keys of the same username will be in the same hash slot
+func getRegisterCacheKeyInCluster(username string) string {
+	return KeyRegister.MustKey(HashTag(username))
 }
 
 func nextRegisterOrder(ctx IContext, cfg IConfig) (int, error) {
-	cacher := ctx.Cacher(cfg.CacherConfig1())
+	cacher := ctx.Cacher(cfg.CacherConfig())
 	next, err := cacher.Autonumber("members::autonumber")
 	if err != nil {
 		return 0, err
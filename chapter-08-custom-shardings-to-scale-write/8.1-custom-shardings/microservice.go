@@ -28,6 +28,7 @@ type Microservice struct {
 	echo            *echo.Echo
 	cachers         map[string]ICacher
 	cachersMutex    sync.Mutex
+	shardedCachers  map[*HashRing]ICacher
 	persisters      map[string]IPersister
 	persistersMutex sync.Mutex
 }
@@ -38,9 +39,10 @@ type ServiceHandleFunc func(ctx IContext) error
 // NewMicroservice is the constructor function of Microservice
 func NewMicroservice() *Microservice {
 	return &Microservice{
-		echo:       echo.New(),
-		cachers:    map[string]ICacher{},
-		persisters: map[string]IPersister{},
+		echo:           echo.New(),
+		cachers:        map[string]ICacher{},
+		shardedCachers: map[*HashRing]ICacher{},
+		persisters:     map[string]IPersister{},
 	}
 }
 
@@ -99,6 +101,11 @@ func (ms *Microservice) Start() error {
 
 // Cleanup clean resources up from every registered services before exit
 func (ms *Microservice) Cleanup() error {
+	// Close sharded cachers before the cachers of their shards, so they unsubscribe first
+	for _, cacher := range ms.shardedCachers {
+		cacher.Close()
+	}
+
 	// Close every cachers
 	for _, cacher := range ms.cachers {
 		cacher.Close()
@@ -117,6 +124,28 @@ func (ms *Microservice) Cacher(cfg ICacherConfig) ICacher {
 	return cacher
 }
 
+// ShardedCacher return cacher that route keys to the shards in ring, the cacher of each shard is shared with Cacher(),
+// the sharded cacher is kept by ring, so the health of shards is tracked across requests
+func (ms *Microservice) ShardedCacher(ring *HashRing) ICacher {
+	ms.cachersMutex.Lock()
+	cacher, ok := ms.shardedCachers[ring]
+	ms.cachersMutex.Unlock()
+	if ok {
+		return cacher
+	}
+
+	cachers := []ICacher{}
+	for _, shard := range ring.Shards() {
+		cachers = append(cachers, ms.Cacher(shard.Cacher))
+	}
+	cacher = NewShardedCacher(ring, cachers)
+
+	ms.cachersMutex.Lock()
+	ms.shardedCachers[ring] = cacher
+	ms.cachersMutex.Unlock()
+	return cacher
+}
+
 func (ms *Microservice) Persister(cfg IPersisterConfig) IPersister {
 	pst, ok := ms.persisters[cfg.Endpoint()]
 	if !ok {
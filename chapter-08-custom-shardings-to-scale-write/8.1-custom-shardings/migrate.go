@@ -0,0 +1,422 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// reshardDone is the checkpoint value of shard that already migrated every keys
+const reshardDone = "done"
+
+// MigrationOptions is the options of Migrator
+type MigrationOptions struct {
+	// Pattern is the pattern of keys to migrate, eg. register::*
+	Pattern string
+	// BatchSize is the COUNT of each SCAN
+	BatchSize int64
+	// KeysPerSecond limit the migration rate, so the shards can still serve the traffic, 0 means no limit
+	KeysPerSecond int
+	// CheckpointKey is the key on the source shard that keep the SCAN cursor,
+	// so the migration can resume from the last batch when it is stopped.
+	// The ids of old and new ring are appended, so the checkpoint of the other migration is not used
+	CheckpointKey string
+	// DeleteSource delete key from old owner after it is restored and verified on new owner
+	DeleteSource bool
+}
+
+// NewDefaultMigrationOptions return MigrationOptions to migrate register keys
+func NewDefaultMigrationOptions() *MigrationOptions {
+	return &MigrationOptions{
+		Pattern:       KeyRegister.ScanPattern(),
+		BatchSize:     100,
+		KeysPerSecond: 1000,
+		CheckpointKey: "reshard::checkpoint",
+		DeleteSource:  true,
+	}
+}
+
+// MigrationReport is the result of migration
+type MigrationReport struct {
+	Scanned int `json:"scanned"`
+	Moved   int `json:"moved"`
+	Skipped int `json:"skipped"` // key is already on the right shard or expired during migration
+	Failed  int `json:"failed"`
+	// Verified is the moved keys that have the same value on target as source, the source of unverified key is not deleted
+	Verified int `json:"verified"`
+	// Errors is the errors of failed keys by key
+	Errors map[string]string `json:"errors"`
+}
+
+// migrationCacher is implemented by Cacher, it is the commands that Migrator run on shards
+type migrationCacher interface {
+	keyCopier
+	Get(key string) (string, error)
+	SetSNoExpire(key string, value string) error
+	Scan(cursor uint64, pattern string, count int64) ([]string, uint64, error)
+	Restore(key string, ttl time.Duration, value string) (bool, error)
+	DelIfDump(key string, value string) (bool, error)
+	Close() error
+}
+
+// Migrator move keys that change owner from oldRing to newRing using DUMP / RESTORE
+type Migrator struct {
+	oldRing *HashRing
+	newRing *HashRing
+	options *MigrationOptions
+	cachers map[string]migrationCacher // shard name -> cacher
+	lastKey time.Time
+}
+
+// NewMigrator return new Migrator, shard that has the same name in both rings must be the same redis
+func NewMigrator(oldRing *HashRing, newRing *HashRing, options *MigrationOptions) *Migrator {
+	cachers := map[string]migrationCacher{}
+	for _, shard := range oldRing.Shards() {
+		cachers[shard.Name] = NewCacher(shard.Cacher)
+	}
+	for _, shard := range newRing.Shards() {
+		if _, ok := cachers[shard.Name]; !ok {
+			cachers[shard.Name] = NewCacher(shard.Cacher)
+		}
+	}
+
+	return &Migrator{
+		oldRing: oldRing,
+		newRing: newRing,
+		options: options,
+		cachers: cachers,
+	}
+}
+
+// Run migrate keys of every shards in oldRing, the shard that is done will be skipped when run again after error,
+// the checkpoints are removed when every shards are done
+func (m *Migrator) Run() (*MigrationReport, error) {
+	report := &MigrationReport{
+		Errors: map[string]string{},
+	}
+
+	for _, shard := range m.oldRing.Shards() {
+		err := m.migrateShard(shard, report)
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, m.Reset()
+}
+
+// checkpointKey return the checkpoint key of migration from oldRing to newRing
+func (m *Migrator) checkpointKey() string {
+	return fmt.Sprintf("%s::%s::%s", m.options.CheckpointKey, m.oldRing.ID(), m.newRing.ID())
+}
+
+// Reset remove the checkpoints, so the next Run start from the first key
+func (m *Migrator) Reset() error {
+	for _, shard := range m.oldRing.Shards() {
+		err := m.cachers[shard.Name].Del(m.checkpointKey())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close close every cachers of migrator
+func (m *Migrator) Close() error {
+	var lastErr error
+	for _, cacher := range m.cachers {
+		err := cacher.Close()
+		if err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func (m *Migrator) migrateShard(shard *ShardConfig, report *MigrationReport) error {
+	source := m.cachers[shard.Name]
+	checkpointKey := m.checkpointKey()
+
+	// Resume from the cursor of the last completed batch
+	checkpoint, err := source.Get(checkpointKey)
+	if err != nil {
+		return err
+	}
+	if checkpoint == reshardDone {
+		return nil
+	}
+	var cursor uint64
+	if len(checkpoint) > 0 {
+		cursor, err = strconv.ParseUint(checkpoint, 10, 64)
+		if err != nil {
+			return fmt.Errorf("migrator: invalid checkpoint of %s: %s", shard.Name, checkpoint)
+		}
+	}
+
+	for {
+		keys, nextCursor, err := source.Scan(cursor, m.options.Pattern, m.options.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			if key == checkpointKey {
+				continue
+			}
+			report.Scanned++
+
+			// With replication, the key is kept if the shard is still one of the owners in new ring
+			owners := m.newRing.GetN(key, m.newRing.ReplicationFactor())
+			targets := []migrationCacher{}
+			isOwner := false
+			for _, owner := range owners {
+				if owner.Name == shard.Name {
+					isOwner = true
+					break
+				}
+				targets = append(targets, m.cachers[owner.Name])
+			}
+			if isOwner || len(targets) == 0 {
+				report.Skipped++
+				continue
+			}
+
+			m.waitRateLimit()
+			moved, err := m.migrateKey(key, source, targets)
+			if !moved {
+				if err != nil {
+					report.Failed++
+					report.Errors[key] = err.Error()
+				} else {
+					report.Skipped++
+				}
+				continue
+			}
+			report.Moved++
+			if err != nil {
+				report.Errors[key] = err.Error()
+				continue
+			}
+			report.Verified++
+		}
+
+		// Save checkpoint after every batch, SCAN guarantee to return every keys that exists for the whole scan
+		if nextCursor == 0 {
+			return source.SetSNoExpire(checkpointKey, reshardDone)
+		}
+		err = source.SetSNoExpire(checkpointKey, strconv.FormatUint(nextCursor, 10))
+		if err != nil {
+			return err
+		}
+		cursor = nextCursor
+	}
+}
+
+// migrateKey copy key to every targets with the remaining TTL, verify and delete from source,
+// return false if key is expired before it is moved or already exists on every targets.
+// The key that is moved but failed to verify return true with error, and the source is kept.
+// DualReadCacher delete the key from old owner before new owner, so the key that is deleted during migration
+// is gone from source after it is restored, then the restored key is deleted from targets
+func (m *Migrator) migrateKey(key string, source migrationCacher, targets []migrationCacher) (bool, error) {
+	ttl, err := source.PTTL(key)
+	if err != nil {
+		return false, err
+	}
+	// -2 means key is not exists
+	if ttl == -2 {
+		return false, nil
+	}
+	// -1 means key has no expire, RESTORE use 0 for no expire
+	if ttl < 0 {
+		ttl = 0
+	}
+
+	value, err := source.Dump(key)
+	if err != nil {
+		return false, err
+	}
+	if len(value) == 0 {
+		return false, nil
+	}
+
+	restoredTargets := []migrationCacher{}
+	for _, target := range targets {
+		// Do not replace the key on target, it is newer than source because every writes go to new owner
+		restored, err := target.Restore(key, ttl, value)
+		if err != nil {
+			return false, err
+		}
+		if restored {
+			restoredTargets = append(restoredTargets, target)
+		}
+	}
+	if len(restoredTargets) == 0 {
+		return false, m.deleteSource(source, key)
+	}
+
+	// The key is deleted or changed on source after DUMP, so the restored value must not be kept on targets,
+	// DelIfDump keep the key that is written to target after RESTORE
+	sourceValue, err := source.Dump(key)
+	if err != nil {
+		return false, err
+	}
+	if sourceValue != value {
+		for _, target := range restoredTargets {
+			_, err = target.DelIfDump(key, value)
+			if err != nil {
+				return false, err
+			}
+		}
+		// The deleted key is not moved, it is skipped
+		if len(sourceValue) == 0 {
+			return false, nil
+		}
+		return false, fmt.Errorf("migrator: %s is changed on source during migration", key)
+	}
+
+	// Verify the value on target is the same as source before delete source
+	for _, target := range restoredTargets {
+		targetValue, err := target.Dump(key)
+		if err != nil {
+			return false, err
+		}
+		if targetValue != value {
+			return true, fmt.Errorf("migrator: verify failed, value of %s on target is not the same as source", key)
+		}
+	}
+
+	err = m.deleteSource(source, key)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (m *Migrator) deleteSource(source migrationCacher, key string) error {
+	if !m.options.DeleteSource {
+		return nil
+	}
+	return source.Del(key)
+}
+
+// waitRateLimit sleep until the next key is allowed by KeysPerSecond
+func (m *Migrator) waitRateLimit() {
+	if m.options.KeysPerSecond <= 0 {
+		return
+	}
+	interval := time.Second / time.Duration(m.options.KeysPerSecond)
+	wait := time.Until(m.lastKey.Add(interval))
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+	m.lastKey = time.Now()
+}
+
+// DualReadCacher read from the new owner first and fall back to the old owner on a miss,
+// it is used while the keys are migrating, every writes go to the new owner
+// except Del, HDel, Expire and Expires that are applied to both owners, so the deleted key is not read from old owner.
+// They are applied to the old owner first, so Migrator see the change on source after it restore the key to new owner
+type DualReadCacher struct {
+	ICacher
+	old ICacher
+}
+
+// NewDualReadCacher return new DualReadCacher, current is the cacher of new ring and old is the cacher of old ring
+func NewDualReadCacher(current ICacher, old ICacher) *DualReadCacher {
+	return &DualReadCacher{
+		ICacher: current,
+		old:     old,
+	}
+}
+
+func (cache *DualReadCacher) Get(key string) (string, error) {
+	val, err := cache.ICacher.Get(key)
+	if err != nil || len(val) > 0 {
+		return val, err
+	}
+	return cache.old.Get(key)
+}
+
+func (cache *DualReadCacher) Exists(key string) (bool, error) {
+	exists, err := cache.ICacher.Exists(key)
+	if err != nil || exists {
+		return exists, err
+	}
+	return cache.old.Exists(key)
+}
+
+func (cache *DualReadCacher) MGet(keys []string) ([]interface{}, error) {
+	vals, err := cache.ICacher.MGet(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the missing keys from old owner
+	missIdxs := []int{}
+	for i, val := range vals {
+		if val == nil {
+			missIdxs = append(missIdxs, i)
+		}
+	}
+	if len(missIdxs) == 0 {
+		return vals, nil
+	}
+
+	oldVals, err := cache.old.MGet(pickKeys(keys, missIdxs))
+	if err != nil {
+		return nil, err
+	}
+	for i, idx := range missIdxs {
+		if i < len(oldVals) {
+			vals[idx] = oldVals[i]
+		}
+	}
+	return vals, nil
+}
+
+func (cache *DualReadCacher) HGet(key string, field string) (string, error) {
+	val, err := cache.ICacher.HGet(key, field)
+	if err != nil || len(val) > 0 {
+		return val, err
+	}
+	return cache.old.HGet(key, field)
+}
+
+func (cache *DualReadCacher) HExists(key string, field string) (bool, error) {
+	exists, err := cache.ICacher.HExists(key, field)
+	if err != nil || exists {
+		return exists, err
+	}
+	return cache.old.HExists(key, field)
+}
+
+func (cache *DualReadCacher) Del(keys ...string) error {
+	err := cache.old.Del(keys...)
+	if err != nil {
+		return err
+	}
+	return cache.ICacher.Del(keys...)
+}
+
+func (cache *DualReadCacher) HDel(key string, fields ...string) error {
+	err := cache.old.HDel(key, fields...)
+	if err != nil {
+		return err
+	}
+	return cache.ICacher.HDel(key, fields...)
+}
+
+func (cache *DualReadCacher) Expire(key string, expire time.Duration) error {
+	err := cache.old.Expire(key, expire)
+	if err != nil {
+		return err
+	}
+	return cache.ICacher.Expire(key, expire)
+}
+
+func (cache *DualReadCacher) Expires(keys []string, expire time.Duration) error {
+	err := cache.old.Expires(keys, expire)
+	if err != nil {
+		return err
+	}
+	return cache.ICacher.Expires(keys, expire)
+}
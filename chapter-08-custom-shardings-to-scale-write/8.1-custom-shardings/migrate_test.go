@@ -0,0 +1,378 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memCacher keep keys in memory, it implement the commands that are used by Migrator and DualReadCacher,
+// DUMP of key is the value itself
+type memCacher struct {
+	ICacher
+	name   string
+	values map[string]string
+	ttls   map[string]time.Duration
+	// scanKeys is the keys of current SCAN
+	scanKeys []string
+	// calls is shared by cachers of one test, so the order of commands on different cachers can be checked
+	calls *[]string
+	// beforeRestore and afterRestore run inside Restore, they simulate the writes of clients during migration
+	beforeRestore func()
+	afterRestore  func()
+}
+
+func newMemCacher(name string, calls *[]string) *memCacher {
+	return &memCacher{
+		name:   name,
+		values: map[string]string{},
+		ttls:   map[string]time.Duration{},
+		calls:  calls,
+	}
+}
+
+func (cache *memCacher) log(op string) {
+	if cache.calls != nil {
+		*cache.calls = append(*cache.calls, cache.name+":"+op)
+	}
+}
+
+func (cache *memCacher) Get(key string) (string, error) {
+	return cache.values[key], nil
+}
+
+func (cache *memCacher) MGet(keys []string) ([]interface{}, error) {
+	vals := make([]interface{}, len(keys))
+	for i, key := range keys {
+		if val, ok := cache.values[key]; ok {
+			vals[i] = val
+		}
+	}
+	return vals, nil
+}
+
+func (cache *memCacher) SetSNoExpire(key string, value string) error {
+	cache.values[key] = value
+	delete(cache.ttls, key)
+	return nil
+}
+
+// Scan keep the order of keys when SCAN start (cursor 0), so the keys that are deleted during SCAN do not move the cursor
+func (cache *memCacher) Scan(cursor uint64, pattern string, count int64) ([]string, uint64, error) {
+	if cursor == 0 {
+		cache.scanKeys = []string{}
+		for key := range cache.values {
+			if strings.HasPrefix(key, strings.TrimSuffix(pattern, "*")) {
+				cache.scanKeys = append(cache.scanKeys, key)
+			}
+		}
+		sort.Strings(cache.scanKeys)
+	}
+	next := cursor + uint64(count)
+	if next >= uint64(len(cache.scanKeys)) {
+		next = 0
+	}
+	end := next
+	if end == 0 {
+		end = uint64(len(cache.scanKeys))
+	}
+	keys := []string{}
+	for _, key := range cache.scanKeys[cursor:end] {
+		if _, ok := cache.values[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, next, nil
+}
+
+func (cache *memCacher) Del(keys ...string) error {
+	cache.log("del")
+	for _, key := range keys {
+		delete(cache.values, key)
+		delete(cache.ttls, key)
+	}
+	return nil
+}
+
+func (cache *memCacher) PTTL(key string) (time.Duration, error) {
+	if _, ok := cache.values[key]; !ok {
+		return -2, nil
+	}
+	if ttl, ok := cache.ttls[key]; ok {
+		return ttl, nil
+	}
+	return -1, nil
+}
+
+func (cache *memCacher) Dump(key string) (string, error) {
+	return cache.values[key], nil
+}
+
+func (cache *memCacher) Restore(key string, ttl time.Duration, value string) (bool, error) {
+	if cache.beforeRestore != nil {
+		cache.beforeRestore()
+	}
+	if _, ok := cache.values[key]; ok {
+		return false, nil
+	}
+	cache.RestoreReplace(key, ttl, value)
+	if cache.afterRestore != nil {
+		cache.afterRestore()
+	}
+	return true, nil
+}
+
+func (cache *memCacher) RestoreReplace(key string, ttl time.Duration, value string) error {
+	cache.values[key] = value
+	if ttl > 0 {
+		cache.ttls[key] = ttl
+	}
+	return nil
+}
+
+func (cache *memCacher) DelIfDump(key string, value string) (bool, error) {
+	if cache.values[key] != value {
+		return false, nil
+	}
+	return true, cache.Del(key)
+}
+
+func (cache *memCacher) Close() error {
+	return nil
+}
+
+func newTestMigrator(oldRing *HashRing, newRing *HashRing) (*Migrator, map[string]*memCacher) {
+	mems := map[string]*memCacher{}
+	cachers := map[string]migrationCacher{}
+	for _, ring := range []*HashRing{oldRing, newRing} {
+		for _, shard := range ring.Shards() {
+			if _, ok := mems[shard.Name]; !ok {
+				mems[shard.Name] = newMemCacher(shard.Name, nil)
+				cachers[shard.Name] = mems[shard.Name]
+			}
+		}
+	}
+	options := NewDefaultMigrationOptions()
+	options.BatchSize = 7
+	options.KeysPerSecond = 0
+	return &Migrator{
+		oldRing: oldRing,
+		newRing: newRing,
+		options: options,
+		cachers: cachers,
+	}, mems
+}
+
+func TestMigratorRun(t *testing.T) {
+	oldRing := newTestRing(1, 1, 1)
+	newRing := newTestRing(1, 1, 1, 1)
+	m, mems := newTestMigrator(oldRing, newRing)
+	keys := testKeys(300)
+	wantMoved := 0
+	for _, key := range keys {
+		mems[oldRing.Get(key).Name].values[key] = "value of " + key
+		if oldRing.Get(key).Name != newRing.Get(key).Name {
+			wantMoved++
+		}
+	}
+
+	report, err := m.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Scanned != len(keys) || report.Moved != wantMoved || report.Verified != wantMoved || report.Failed != 0 {
+		t.Errorf("report = %+v, want %d scanned and %d moved", report, len(keys), wantMoved)
+	}
+	for _, key := range keys {
+		owner := newRing.Get(key).Name
+		for name, mem := range mems {
+			_, ok := mem.values[key]
+			if ok != (name == owner) {
+				t.Fatalf("%s on %s = %v, want only on %s", key, name, ok, owner)
+			}
+		}
+	}
+	// The checkpoints are removed after every shards are done
+	for name, mem := range mems {
+		if _, ok := mem.values[m.checkpointKey()]; ok {
+			t.Errorf("checkpoint of %s is not removed", name)
+		}
+	}
+}
+
+func TestMigratorCheckpoint(t *testing.T) {
+	oldRing := newTestRing(1, 1)
+	newRing := newTestRing(1, 1, 1)
+	keys := testKeys(100)
+	tests := []struct {
+		name      string
+		done      bool   // shard1 is done in this migration
+		otherDone string // checkpoint key of other migration that is done on shard1
+		wantMoved bool   // the keys of shard1 are moved
+	}{
+		{"no checkpoint", false, "", true},
+		{"done checkpoint of this migration", true, "", false},
+		{"done checkpoint of other migration", false, "reshard::checkpoint", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, mems := newTestMigrator(oldRing, newRing)
+			for _, key := range keys {
+				mems[oldRing.Get(key).Name].values[key] = "v"
+			}
+			if tt.done {
+				mems["shard1"].values[m.checkpointKey()] = reshardDone
+			}
+			if len(tt.otherDone) > 0 {
+				mems["shard1"].values[tt.otherDone] = reshardDone
+			}
+
+			_, err := m.Run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			moved := 0
+			for _, key := range keys {
+				if oldRing.Get(key).Name != "shard1" || newRing.Get(key).Name != "shard3" {
+					continue
+				}
+				if _, ok := mems["shard3"].values[key]; ok {
+					moved++
+				}
+			}
+			if (moved > 0) != tt.wantMoved {
+				t.Errorf("moved %d keys from shard1, want moved %v", moved, tt.wantMoved)
+			}
+			if _, ok := mems["shard1"].values[m.checkpointKey()]; ok {
+				t.Error("checkpoint is not removed after Run")
+			}
+		})
+	}
+}
+
+func TestMigrateKeyDuringWrites(t *testing.T) {
+	key := "register::user_1"
+	tests := []struct {
+		name       string
+		write      func(dual *DualReadCacher, target *memCacher)
+		after      bool // write after RESTORE instead of before
+		wantMoved  bool
+		wantErr    bool
+		wantTarget string
+		wantSource string
+	}{
+		{"no write", nil, false, true, false, "v1", ""},
+		{"deleted before restore", func(dual *DualReadCacher, target *memCacher) {
+			dual.Del(key)
+		}, false, false, false, "", ""},
+		{"deleted after restore", func(dual *DualReadCacher, target *memCacher) {
+			dual.Del(key)
+		}, true, false, false, "", ""},
+		{"deleted and written again after restore", func(dual *DualReadCacher, target *memCacher) {
+			dual.Del(key)
+			target.values[key] = "v2"
+		}, true, false, false, "v2", ""},
+		{"changed on source", func(dual *DualReadCacher, target *memCacher) {
+			dual.old.(*memCacher).values[key] = "v1 changed"
+		}, false, false, true, "", "v1 changed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newMemCacher("old", nil)
+			target := newMemCacher("new", nil)
+			source.values[key] = "v1"
+			dual := NewDualReadCacher(target, source)
+			if tt.write != nil {
+				write := func() { tt.write(dual, target) }
+				if tt.after {
+					target.afterRestore = write
+				} else {
+					target.beforeRestore = write
+				}
+			}
+
+			m, _ := newTestMigrator(newTestRing(1), newTestRing(1))
+			moved, err := m.migrateKey(key, source, []migrationCacher{target})
+			if moved != tt.wantMoved || (err != nil) != tt.wantErr {
+				t.Fatalf("migrateKey = %v, %v, want %v, error %v", moved, err, tt.wantMoved, tt.wantErr)
+			}
+			// The deleted key must not be resurrected on target
+			if got := target.values[key]; got != tt.wantTarget {
+				t.Errorf("target = %q, want %q", got, tt.wantTarget)
+			}
+			if got := source.values[key]; got != tt.wantSource {
+				t.Errorf("source = %q, want %q", got, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestDualReadCacherMGet(t *testing.T) {
+	current := newMemCacher("new", nil)
+	old := newMemCacher("old", nil)
+	current.values["a"] = "new a"
+	current.values["c"] = "new c"
+	old.values["b"] = "old b"
+	old.values["c"] = "old c"
+	dual := NewDualReadCacher(current, old)
+
+	vals, err := dual.MGet([]string{"a", "b", "c", "d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The miss on new owner is read from old owner, the key on new owner is newer than old owner
+	want := []interface{}{"new a", "old b", "new c", nil}
+	if len(vals) != len(want) {
+		t.Fatalf("MGet = %v, want %v", vals, want)
+	}
+	for i := range want {
+		if vals[i] != want[i] {
+			t.Errorf("MGet[%d] = %v, want %v", i, vals[i], want[i])
+		}
+	}
+}
+
+func TestDualReadCacherGet(t *testing.T) {
+	current := newMemCacher("new", nil)
+	old := newMemCacher("old", nil)
+	current.values["a"] = "new a"
+	old.values["a"] = "old a"
+	old.values["b"] = "old b"
+	dual := NewDualReadCacher(current, old)
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"a", "new a"},
+		{"b", "old b"},
+		{"c", ""},
+	}
+	for _, tt := range tests {
+		got, err := dual.Get(tt.key)
+		if err != nil || got != tt.want {
+			t.Errorf("Get(%q) = %q, %v, want %q", tt.key, got, err, tt.want)
+		}
+	}
+}
+
+func TestDualReadCacherDelOldFirst(t *testing.T) {
+	calls := []string{}
+	current := newMemCacher("new", &calls)
+	old := newMemCacher("old", &calls)
+	current.values["a"] = "new a"
+	old.values["a"] = "old a"
+	dual := NewDualReadCacher(current, old)
+
+	err := dual.Del("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 2 || calls[0] != "old:del" || calls[1] != "new:del" {
+		t.Errorf("calls = %v, want old:del then new:del", calls)
+	}
+	if got, _ := dual.Get("a"); got != "" {
+		t.Errorf("Get after Del = %q, want miss", got)
+	}
+}
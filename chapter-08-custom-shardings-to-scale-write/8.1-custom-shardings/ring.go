@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultVirtualNodes is the number of virtual nodes per 1 weight of shard
+const defaultVirtualNodes = 160
+
+// ShardConfig is the config of one shard in the hash ring
+type ShardConfig struct {
+	// Name is the stable name of shard, virtual nodes are placed by name,
+	// so changing endpoint of shard will not move any keys
+	Name string
+	// Weight is the relative capacity of shard, shard with weight 2 get twice keys of shard with weight 1
+	Weight int
+	Cacher ICacherConfig
+}
+
+// NewShardConfig return new ShardConfig
+func NewShardConfig(name string, weight int, cacher ICacherConfig) *ShardConfig {
+	return &ShardConfig{
+		Name:   name,
+		Weight: weight,
+		Cacher: cacher,
+	}
+}
+
+type ringNode struct {
+	hash  uint64
+	shard int // index of shard in HashRing.shards
+}
+
+// HashRing is the consistent hash ring with weighted virtual nodes,
+// adding or removing one shard only move the keys of that shard
+type HashRing struct {
+	shards []*ShardConfig
+	nodes  []ringNode // sorted by hash
+	// replicationFactor is the number of shards that keep each key, the first one is the primary
+	replicationFactor int
+}
+
+// NewHashRing create hash ring from shards, virtualNodes is the number of virtual nodes per 1 weight
+func NewHashRing(shards []*ShardConfig, virtualNodes int) *HashRing {
+	if virtualNodes <= 0 {
+		virtualNodes = defaultVirtualNodes
+	}
+
+	nodes := []ringNode{}
+	for i, shard := range shards {
+		weight := shard.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		for v := 0; v < weight*virtualNodes; v++ {
+			nodes = append(nodes, ringNode{
+				hash:  ringHash(fmt.Sprintf("%s#%d", shard.Name, v)),
+				shard: i,
+			})
+		}
+	}
+
+	// Sort by hash, if hash is collided sort by shard name so the ring is deterministic
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].hash != nodes[j].hash {
+			return nodes[i].hash < nodes[j].hash
+		}
+		return shards[nodes[i].shard].Name < shards[nodes[j].shard].Name
+	})
+
+	return &HashRing{
+		shards:            shards,
+		nodes:             nodes,
+		replicationFactor: 1,
+	}
+}
+
+// SetReplicationFactor set the number of shards that keep each key,
+// eg. 2 means each key is written to the primary and one backup shard
+func (ring *HashRing) SetReplicationFactor(n int) *HashRing {
+	if n < 1 {
+		n = 1
+	}
+	if n > len(ring.shards) {
+		n = len(ring.shards)
+	}
+	ring.replicationFactor = n
+	return ring
+}
+
+// ReplicationFactor return the number of shards that keep each key
+func (ring *HashRing) ReplicationFactor() int {
+	return ring.replicationFactor
+}
+
+// Shards return every shards in the ring
+func (ring *HashRing) Shards() []*ShardConfig {
+	return ring.shards
+}
+
+// ID return the id of ring that is computed from shards and replication factor,
+// the rings that place keys to the same shards have the same id
+func (ring *HashRing) ID() string {
+	b := strings.Builder{}
+	for _, shard := range ring.shards {
+		fmt.Fprintf(&b, "%s#%d,", shard.Name, shard.Weight)
+	}
+	fmt.Fprintf(&b, "rf%d,n%d", ring.replicationFactor, len(ring.nodes))
+	return strconv.FormatUint(ringHash(b.String()), 36)
+}
+
+// Get return the shard that own key
+func (ring *HashRing) Get(key string) *ShardConfig {
+	idx := ring.shardIndexOfHash(ringHash(key))
+	if idx < 0 {
+		return nil
+	}
+	return ring.shards[idx]
+}
+
+// GetN return n distinct shards that own key, the first one is the primary and the rest are backups
+func (ring *HashRing) GetN(key string, n int) []*ShardConfig {
+	shards := []*ShardConfig{}
+	for _, idx := range ring.shardIndexesOfHash(ringHash(key), n) {
+		shards = append(shards, ring.shards[idx])
+	}
+	return shards
+}
+
+// shardIndexesOfHash return indexes of n distinct shards clockwise from hash
+func (ring *HashRing) shardIndexesOfHash(hash uint64, n int) []int {
+	if len(ring.nodes) == 0 {
+		return nil
+	}
+	if n > len(ring.shards) {
+		n = len(ring.shards)
+	}
+
+	i := sort.Search(len(ring.nodes), func(i int) bool {
+		return ring.nodes[i].hash >= hash
+	})
+
+	idxs := []int{}
+	found := map[int]bool{}
+	for j := 0; j < len(ring.nodes) && len(idxs) < n; j++ {
+		node := ring.nodes[(i+j)%len(ring.nodes)]
+		if found[node.shard] {
+			continue
+		}
+		found[node.shard] = true
+		idxs = append(idxs, node.shard)
+	}
+	return idxs
+}
+
+// shardIndexOfHash return index of shard that own hash, the owner is the first node clockwise from hash
+func (ring *HashRing) shardIndexOfHash(hash uint64) int {
+	if len(ring.nodes) == 0 {
+		return -1
+	}
+	i := sort.Search(len(ring.nodes), func(i int) bool {
+		return ring.nodes[i].hash >= hash
+	})
+	// Wrap around the ring
+	if i == len(ring.nodes) {
+		i = 0
+	}
+	return ring.nodes[i].shard
+}
+
+// RingChangeReport is the report of keys that would move when the ring changes
+type RingChangeReport struct {
+	TotalKeys int `json:"total_keys"`
+	MovedKeys int `json:"moved_keys"`
+	// Moves is the number of moved keys by "from shard -> to shard"
+	Moves map[string]int `json:"moves"`
+	// MovedRatio is the ratio of the whole hash space that change owner, no need to sample keys
+	MovedRatio float64 `json:"moved_ratio"`
+}
+
+// CompareKeys report how many of keys would move from this ring to newRing
+func (ring *HashRing) CompareKeys(newRing *HashRing, keys []string) *RingChangeReport {
+	report := &RingChangeReport{
+		TotalKeys:  len(keys),
+		Moves:      map[string]int{},
+		MovedRatio: ring.MovedRatio(newRing),
+	}
+
+	for _, key := range keys {
+		from := ring.Get(key)
+		to := newRing.Get(key)
+		if from == nil || to == nil || from.Name == to.Name {
+			continue
+		}
+		report.MovedKeys++
+		report.Moves[fmt.Sprintf("%s -> %s", from.Name, to.Name)]++
+	}
+	return report
+}
+
+// MovedRatio return the ratio (0-1) of hash space that has different owner in newRing
+func (ring *HashRing) MovedRatio(newRing *HashRing) float64 {
+	if len(ring.nodes) == 0 || len(newRing.nodes) == 0 {
+		return 1
+	}
+
+	// Every node hash of both rings is the boundary, between two boundaries the owner do not change
+	bounds := make([]uint64, 0, len(ring.nodes)+len(newRing.nodes))
+	for _, node := range ring.nodes {
+		bounds = append(bounds, node.hash)
+	}
+	for _, node := range newRing.nodes {
+		bounds = append(bounds, node.hash)
+	}
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i] < bounds[j] })
+
+	var moved float64
+	for i, bound := range bounds {
+		// The arc (prev, bound] is owned by the owner of bound
+		var prev uint64
+		if i == 0 {
+			prev = bounds[len(bounds)-1]
+		} else {
+			prev = bounds[i-1]
+		}
+		arc := bound - prev // wrap around for the first arc
+		if arc == 0 {
+			continue
+		}
+		if ring.shards[ring.shardIndexOfHash(bound)].Name != newRing.shards[newRing.shardIndexOfHash(bound)].Name {
+			moved += float64(arc)
+		}
+	}
+	return moved / math.Pow(2, 64)
+}
+
+// ringHash hash key and mix the bits, so similar keys (eg. shard1#1, shard1#2) spread over the ring
+func ringHash(key string) uint64 {
+	h := FastHash(key)
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func newTestRing(weights ...int) *HashRing {
+	shards := make([]*ShardConfig, len(weights))
+	for i, weight := range weights {
+		shards[i] = NewShardConfig(fmt.Sprintf("shard%d", i+1), weight, nil)
+	}
+	return NewHashRing(shards, 0)
+}
+
+func testKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("register::user_%d", i)
+	}
+	return keys
+}
+
+func TestHashRingGet(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []int
+	}{
+		{"one shard", []int{1}},
+		{"three shards", []int{1, 1, 1}},
+		{"weighted shards", []int{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ring := newTestRing(tt.weights...)
+			again := newTestRing(tt.weights...)
+			for _, key := range testKeys(1000) {
+				shard := ring.Get(key)
+				if shard == nil {
+					t.Fatalf("Get(%q) = nil", key)
+				}
+				// The ring is deterministic, so every instances route the key to the same shard
+				if again.Get(key).Name != shard.Name {
+					t.Fatalf("Get(%q) = %s on the same ring, want %s", key, again.Get(key).Name, shard.Name)
+				}
+				if primary := ring.GetN(key, 1)[0]; primary.Name != shard.Name {
+					t.Fatalf("GetN(%q, 1)[0] = %s, want %s", key, primary.Name, shard.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestHashRingGetEmpty(t *testing.T) {
+	ring := NewHashRing(nil, 0)
+	if shard := ring.Get("key"); shard != nil {
+		t.Errorf("Get of empty ring = %s, want nil", shard.Name)
+	}
+	if shards := ring.GetN("key", 2); len(shards) != 0 {
+		t.Errorf("GetN of empty ring = %d shards, want 0", len(shards))
+	}
+}
+
+func TestHashRingGetN(t *testing.T) {
+	tests := []struct {
+		n    int
+		want int
+	}{
+		{1, 1},
+		{2, 2},
+		{3, 3},
+		// n is limited by the number of shards
+		{5, 3},
+	}
+	ring := newTestRing(1, 1, 1)
+	for _, tt := range tests {
+		for _, key := range testKeys(200) {
+			shards := ring.GetN(key, tt.n)
+			if len(shards) != tt.want {
+				t.Fatalf("len(GetN(%q, %d)) = %d, want %d", key, tt.n, len(shards), tt.want)
+			}
+			seen := map[string]bool{}
+			for _, shard := range shards {
+				if seen[shard.Name] {
+					t.Fatalf("GetN(%q, %d) has %s twice", key, tt.n, shard.Name)
+				}
+				seen[shard.Name] = true
+			}
+		}
+	}
+}
+
+func TestHashRingWeight(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []int
+	}{
+		{"equal weights", []int{1, 1, 1, 1}},
+		{"double weight", []int{1, 2}},
+		{"mixed weights", []int{1, 2, 3}},
+	}
+	keys := testKeys(100000)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ring := newTestRing(tt.weights...)
+			counts := map[string]int{}
+			for _, key := range keys {
+				counts[ring.Get(key).Name]++
+			}
+
+			totalWeight := 0
+			for _, weight := range tt.weights {
+				totalWeight += weight
+			}
+			for i, weight := range tt.weights {
+				name := fmt.Sprintf("shard%d", i+1)
+				want := float64(len(keys)) * float64(weight) / float64(totalWeight)
+				// Virtual nodes spread keys close to the weight, not exactly
+				if math.Abs(float64(counts[name])-want)/want > 0.15 {
+					t.Errorf("%s has %d keys, want about %.0f", name, counts[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestHashRingAddShard(t *testing.T) {
+	oldRing := newTestRing(1, 1, 1)
+	newRing := newTestRing(1, 1, 1, 1)
+	keys := testKeys(10000)
+
+	for _, key := range keys {
+		from := oldRing.Get(key).Name
+		to := newRing.Get(key).Name
+		// Only the keys of new shard move, the other keys stay in the same shard
+		if from != to && to != "shard4" {
+			t.Fatalf("%s move from %s to %s, want stay or move to shard4", key, from, to)
+		}
+	}
+
+	report := oldRing.CompareKeys(newRing, keys)
+	if report.TotalKeys != len(keys) {
+		t.Errorf("TotalKeys = %d, want %d", report.TotalKeys, len(keys))
+	}
+	sampled := float64(report.MovedKeys) / float64(report.TotalKeys)
+	// 1 of 4 shards is added, so about 1/4 of keys move
+	if math.Abs(report.MovedRatio-0.25) > 0.05 {
+		t.Errorf("MovedRatio = %.3f, want about 0.25", report.MovedRatio)
+	}
+	if math.Abs(sampled-report.MovedRatio) > 0.03 {
+		t.Errorf("moved keys ratio = %.3f, want close to MovedRatio %.3f", sampled, report.MovedRatio)
+	}
+}
+
+func TestHashRingMovedRatio(t *testing.T) {
+	tests := []struct {
+		name    string
+		oldRing *HashRing
+		newRing *HashRing
+		want    float64
+	}{
+		{"same ring", newTestRing(1, 1, 1), newTestRing(1, 1, 1), 0},
+		{"empty ring", NewHashRing(nil, 0), newTestRing(1), 1},
+		{"remove one of two shards", newTestRing(1, 1), newTestRing(1), 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.oldRing.MovedRatio(tt.newRing)
+			if math.Abs(got-tt.want) > 0.05 {
+				t.Errorf("MovedRatio = %.3f, want about %.3f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashRingSetReplicationFactor(t *testing.T) {
+	tests := []struct {
+		n    int
+		want int
+	}{
+		{0, 1},
+		{1, 1},
+		{2, 2},
+		{4, 3},
+	}
+	for _, tt := range tests {
+		ring := newTestRing(1, 1, 1).SetReplicationFactor(tt.n)
+		if got := ring.ReplicationFactor(); got != tt.want {
+			t.Errorf("SetReplicationFactor(%d) = %d, want %d", tt.n, got, tt.want)
+		}
+	}
+}
@@ -2,16 +2,9 @@ package main
 
 func setup(cfg IConfig) error {
 
-	// Clear all caches
-	cfgs := []ICacherConfig{
-		cfg.CacherConfig1(),
-		cfg.CacherConfig2(),
-		cfg.CacherConfig3(),
-		cfg.CacherConfig4(),
-		cfg.CacherConfig5(),
-	}
-	for _, cacheCfg := range cfgs {
-		cacher := NewCacher(cacheCfg)
+	// Clear all caches in the namespace of this service, Keys and Del use KeyPrefix of config
+	for _, shard := range cfg.CacherShards() {
+		cacher := NewCacher(shard.Cacher)
 		allKeys, err := cacher.Keys("*")
 		if err != nil {
 			return err
@@ -0,0 +1,973 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+// shardDownTime is the time that failed shard is out of rotation before try again
+const shardDownTime = 5 * time.Second
+
+// shardHealth track the failure of one shard
+type shardHealth struct {
+	downUntil int64 // unix nano, the shard is out of rotation until this time
+}
+
+func (health *shardHealth) isUp() bool {
+	return time.Now().UnixNano() >= atomic.LoadInt64(&health.downUntil)
+}
+
+func (health *shardHealth) markDown() {
+	atomic.StoreInt64(&health.downUntil, time.Now().Add(shardDownTime).UnixNano())
+}
+
+// maxHintsPerShard limit the hints that are kept in memory for one shard,
+// the write that is missed after the limit has no hint, the shard can return the old value of that key
+// until the key is written again or expired, the hinted keys are still repaired by read repair
+const maxHintsPerShard = 100000
+
+// shardHints keep the keys that one shard missed the writes, up to maxHintsPerShard keys
+type shardHints struct {
+	keys  sync.Map // key -> struct{}
+	count int64
+}
+
+// add return false when the hint is dropped because the shard has maxHintsPerShard hints
+func (hints *shardHints) add(key string) bool {
+	if _, ok := hints.keys.Load(key); ok {
+		return true
+	}
+	if atomic.AddInt64(&hints.count, 1) > maxHintsPerShard {
+		atomic.AddInt64(&hints.count, -1)
+		return false
+	}
+	if _, loaded := hints.keys.LoadOrStore(key, struct{}{}); loaded {
+		atomic.AddInt64(&hints.count, -1)
+	}
+	return true
+}
+
+func (hints *shardHints) remove(key string) {
+	if _, loaded := hints.keys.LoadAndDelete(key); loaded {
+		atomic.AddInt64(&hints.count, -1)
+	}
+}
+
+func (hints *shardHints) has(key string) bool {
+	_, ok := hints.keys.Load(key)
+	return ok
+}
+
+func (hints *shardHints) len() int {
+	return int(atomic.LoadInt64(&hints.count))
+}
+
+// keyCopier is implemented by Cacher, it is used by read repair to copy key from fresh shard to stale shard
+type keyCopier interface {
+	Dump(key string) (string, error)
+	PTTL(key string) (time.Duration, error)
+	RestoreReplace(key string, ttl time.Duration, value string) error
+	Del(keys ...string) error
+}
+
+// ShardedCacher implement ICacher over the shards in hash ring,
+// single key commands are routed by key, multi keys commands are scattered by shard
+// and gathered in the original order, so the caller do not need to know about shards.
+// When ring.ReplicationFactor() > 1, writes are sent to the primary and backup shards concurrently
+// and reads fall back to the backup when the primary is failed.
+// The owner that miss a write (down or failed) get a hint of key, the read skip the stale owner
+// and copy the key from the fresh owner to it (read repair). Hints are kept in memory of this process only,
+// up to maxHintsPerShard keys per shard
+type ShardedCacher struct {
+	ring       *HashRing
+	cachers    []ICacher // index is the same as ring.Shards()
+	healths    []*shardHealth
+	hints      []*shardHints // index is the same as ring.Shards()
+	subsribers *sync.Map
+}
+
+// NewShardedCacher return new ShardedCacher, cachers must be in the same order as ring.Shards()
+func NewShardedCacher(ring *HashRing, cachers []ICacher) *ShardedCacher {
+	healths := make([]*shardHealth, len(cachers))
+	hints := make([]*shardHints, len(cachers))
+	for i := range healths {
+		healths[i] = &shardHealth{}
+		hints[i] = &shardHints{}
+	}
+	return &ShardedCacher{
+		ring:       ring,
+		cachers:    cachers,
+		healths:    healths,
+		hints:      hints,
+		subsribers: &sync.Map{},
+	}
+}
+
+// shardedSub is the subscription that subscribe to multiple shards
+type shardedSub struct {
+	subIDs map[int]string // shard index -> subID of shard
+	// done is closed by Unsub, so the forwarders stop even when nobody read the merged channel
+	done chan struct{}
+}
+
+// ShardsUp return the health of every shards by shard name
+func (sc *ShardedCacher) ShardsUp() map[string]bool {
+	ups := map[string]bool{}
+	for i, shard := range sc.ring.Shards() {
+		ups[shard.Name] = sc.healths[i].isUp()
+	}
+	return ups
+}
+
+// shardOf return index of primary shard that own key
+func (sc *ShardedCacher) shardOf(key string) int {
+	return sc.ring.shardIndexOfHash(ringHash(key))
+}
+
+// cacherOf return cacher of primary shard that own key
+func (sc *ShardedCacher) cacherOf(key string) ICacher {
+	return sc.cachers[sc.shardOf(key)]
+}
+
+// healthyOwners return indexes of shards that own key and are not out of rotation, primary first
+func (sc *ShardedCacher) healthyOwners(key string) []int {
+	owners := []int{}
+	for _, shard := range sc.ring.shardIndexesOfHash(ringHash(key), sc.ring.ReplicationFactor()) {
+		if sc.healths[shard].isUp() {
+			owners = append(owners, shard)
+		}
+	}
+	return owners
+}
+
+// readOwners return healthy owners of key, the stale owners that missed writes of key are moved to the end
+func (sc *ShardedCacher) readOwners(key string) []int {
+	fresh := []int{}
+	stale := []int{}
+	for _, shard := range sc.healthyOwners(key) {
+		if sc.isStale(shard, key) {
+			stale = append(stale, shard)
+			continue
+		}
+		fresh = append(fresh, shard)
+	}
+	return append(fresh, stale...)
+}
+
+// writeOwners return healthy owners of key to write, and give hint to owners that are down
+func (sc *ShardedCacher) writeOwners(key string) []int {
+	owners := []int{}
+	for _, shard := range sc.ring.shardIndexesOfHash(ringHash(key), sc.ring.ReplicationFactor()) {
+		if !sc.healths[shard].isUp() {
+			sc.hint(shard, key)
+			continue
+		}
+		owners = append(owners, shard)
+	}
+	return owners
+}
+
+// hint remember that shard missed the write of key, the hint is dropped when the shard has too many hints
+func (sc *ShardedCacher) hint(shard int, key string) {
+	sc.hints[shard].add(key)
+}
+
+func (sc *ShardedCacher) isStale(shard int, key string) bool {
+	return sc.hints[shard].has(key)
+}
+
+// repairAfterRead copy key from source to the stale owners of key in background,
+// it is called after key is read from source that is not stale
+func (sc *ShardedCacher) repairAfterRead(key string, source int) {
+	for _, shard := range sc.healthyOwners(key) {
+		if shard != source && sc.isStale(shard, key) {
+			go sc.repair(key, source, shard)
+		}
+	}
+}
+
+// repair copy key from source to target with DUMP / RESTORE REPLACE, the key that is not exists on source is deleted
+func (sc *ShardedCacher) repair(key string, source int, target int) {
+	from, ok := sc.cachers[source].(keyCopier)
+	if !ok {
+		return
+	}
+	to, ok := sc.cachers[target].(keyCopier)
+	if !ok {
+		return
+	}
+
+	// The hint is removed first, so the write during repair give the hint again
+	sc.hints[target].remove(key)
+	err := copyKey(key, from, to)
+	if err != nil {
+		sc.checkShardError(target, err)
+		sc.hint(target, key)
+		fmt.Println("sharded cacher: repair", key, err.Error())
+	}
+}
+
+func copyKey(key string, from keyCopier, to keyCopier) error {
+	ttl, err := from.PTTL(key)
+	if err != nil {
+		return err
+	}
+	// -2 means key is not exists
+	if ttl == -2 {
+		return to.Del(key)
+	}
+	// -1 means key has no expire, RESTORE use 0 for no expire
+	if ttl < 0 {
+		ttl = 0
+	}
+
+	value, err := from.Dump(key)
+	if err != nil {
+		return err
+	}
+	if len(value) == 0 {
+		return to.Del(key)
+	}
+	return to.RestoreReplace(key, ttl, value)
+}
+
+// checkShardError mark shard down when the error is not the reply from redis (eg. connection error)
+func (sc *ShardedCacher) checkShardError(shard int, err error) {
+	if err == nil {
+		return
+	}
+	if isRedisError(err) {
+		return
+	}
+	sc.healths[shard].markDown()
+}
+
+// isRedisError return true when err is the reply error from redis, it is not a failure of shard
+func isRedisError(err error) bool {
+	var redisErr redis.Error
+	return errors.As(err, &redisErr)
+}
+
+func noHealthyShardError(key string) error {
+	return fmt.Errorf("sharded cacher: every shards of %s are down", key)
+}
+
+// write run fn on every healthy owners of key concurrently, the write is success if at least one owner success,
+// fn must be idempotent (eg. SET, HSET, DEL), the counters use writeCounter
+func (sc *ShardedCacher) write(key string, fn func(cacher ICacher) error) error {
+	owners := sc.writeOwners(key)
+	if len(owners) == 0 {
+		return noHealthyShardError(key)
+	}
+	return sc.writeTo(key, owners, fn)
+}
+
+// writeTo run fn on shards concurrently, success if at least one shard success, the failed shards get the hint of key
+func (sc *ShardedCacher) writeTo(key string, shards []int, fn func(cacher ICacher) error) error {
+	errs := make([]error, len(shards))
+	wg := sync.WaitGroup{}
+	for i, shard := range shards {
+		wg.Add(1)
+		go func(i int, shard int) {
+			defer wg.Done()
+			err := fn(sc.cachers[shard])
+			if err != nil {
+				sc.checkShardError(shard, err)
+				sc.hint(shard, key)
+			}
+			errs[i] = err
+		}(i, shard)
+	}
+	wg.Wait()
+
+	var lastErr error
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+	}
+	return lastErr
+}
+
+// writeCounter run fn (eg. INCR) on the first healthy owner of key only, the command is not idempotent,
+// so it is not run again on backups, then replicate copy the result to the other owners (eg. SET the new value).
+// If the first owner has connection error, fn is run on the next owner
+func (sc *ShardedCacher) writeCounter(key string, fn func(cacher ICacher) error, replicate func(cacher ICacher) error) error {
+	owners := sc.writeOwners(key)
+	if len(owners) == 0 {
+		return noHealthyShardError(key)
+	}
+
+	var err error
+	for i, shard := range owners {
+		err = fn(sc.cachers[shard])
+		if err == nil {
+			if i+1 < len(owners) {
+				// The backup that failed to replicate get the hint, the counter is still success
+				sc.writeTo(key, owners[i+1:], replicate)
+			}
+			return nil
+		}
+		// The reply error from redis will be the same on backup, so do not fall back
+		if isRedisError(err) {
+			return err
+		}
+		sc.checkShardError(shard, err)
+		sc.hint(shard, key)
+	}
+	return err
+}
+
+// read run fn on the first healthy owner of key, and fall back to the next owner when error,
+// the owner that missed writes of key is read last and it is repaired after the read from fresh owner
+func (sc *ShardedCacher) read(key string, fn func(cacher ICacher) error) error {
+	owners := sc.readOwners(key)
+	if len(owners) == 0 {
+		return noHealthyShardError(key)
+	}
+
+	var err error
+	for _, shard := range owners {
+		err = fn(sc.cachers[shard])
+		if err == nil {
+			if !sc.isStale(shard, key) {
+				sc.repairAfterRead(key, shard)
+			}
+			return nil
+		}
+		// The reply error from redis will be the same on backup, so do not fall back
+		if isRedisError(err) {
+			return err
+		}
+		sc.checkShardError(shard, err)
+	}
+	return err
+}
+
+// groupKeysToWrite group keys by every healthy owners, the value is indexes of keys,
+// the owners that are down get the hint of keys
+func (sc *ShardedCacher) groupKeysToWrite(keys []string) map[int][]int {
+	groups := map[int][]int{}
+	for i, key := range keys {
+		for _, shard := range sc.writeOwners(key) {
+			groups[shard] = append(groups[shard], i)
+		}
+	}
+	return groups
+}
+
+// writeKeys write keys to every healthy owners, success if every keys are written to at least one owner
+func (sc *ShardedCacher) writeKeys(keys []string, fn func(shard int, idxs []int) error) error {
+	written := make([]int32, len(keys))
+	lastErr := sc.scatter(sc.groupKeysToWrite(keys), func(shard int, idxs []int) error {
+		err := fn(shard, idxs)
+		if err != nil {
+			sc.checkShardError(shard, err)
+			for _, idx := range idxs {
+				sc.hint(shard, keys[idx])
+			}
+			return err
+		}
+		for _, idx := range idxs {
+			atomic.AddInt32(&written[idx], 1)
+		}
+		return nil
+	})
+
+	for i, count := range written {
+		if count > 0 {
+			continue
+		}
+		if lastErr != nil {
+			return lastErr
+		}
+		return noHealthyShardError(keys[i])
+	}
+	return nil
+}
+
+// scatter run fn on every shards in groups concurrently and return the last error
+func (sc *ShardedCacher) scatter(groups map[int][]int, fn func(shard int, idxs []int) error) error {
+	var lastErr error
+	errMutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for shard, idxs := range groups {
+		wg.Add(1)
+		go func(shard int, idxs []int) {
+			defer wg.Done()
+			err := fn(shard, idxs)
+			if err != nil {
+				errMutex.Lock()
+				lastErr = err
+				errMutex.Unlock()
+			}
+		}(shard, idxs)
+	}
+	wg.Wait()
+	return lastErr
+}
+
+// healthyShards return groups that contains every healthy shards, used to fan out to all shards
+func (sc *ShardedCacher) healthyShards() map[int][]int {
+	groups := map[int][]int{}
+	for i := range sc.cachers {
+		if sc.healths[i].isUp() {
+			groups[i] = nil
+		}
+	}
+	return groups
+}
+
+func pickKeys(keys []string, idxs []int) []string {
+	picked := make([]string, len(idxs))
+	for i, idx := range idxs {
+		picked[i] = keys[idx]
+	}
+	return picked
+}
+
+// intCounter run string counter fn on one owner and SET the new value on the other owners
+func (sc *ShardedCacher) intCounter(key string, fn func(cacher ICacher) (int, error)) (int, error) {
+	var val int
+	err := sc.writeCounter(key, func(cacher ICacher) error {
+		var err error
+		val, err = fn(cacher)
+		return err
+	}, func(cacher ICacher) error {
+		return cacher.SetSKeepTTL(key, strconv.Itoa(val))
+	})
+	return val, err
+}
+
+// hashCounter run hash counter fn on one owner and HSET the new value of field on the other owners
+func (sc *ShardedCacher) hashCounter(key string, field string, fn func(cacher ICacher) (int, error)) (int, error) {
+	var val int
+	err := sc.writeCounter(key, func(cacher ICacher) error {
+		var err error
+		val, err = fn(cacher)
+		return err
+	}, func(cacher ICacher) error {
+		return cacher.HMSet(key, map[string]interface{}{field: val})
+	})
+	return val, err
+}
+
+func (sc *ShardedCacher) Autonumber(name string) (int, error) {
+	key, err := KeyAutonumber.Key(name)
+	if err != nil {
+		return -1, err
+	}
+	return sc.intCounter(key, func(cacher ICacher) (int, error) {
+		return cacher.Autonumber(name)
+	})
+}
+
+// BitFieldBulkUpdate group cmds by key and run them with BitField, so INCRBY is run once and replicated by value
+func (sc *ShardedCacher) BitFieldBulkUpdate(cmds []*BitFieldCmd) error {
+	keys := []string{}
+	keyCmds := map[string][]*BitFieldCmd{}
+	keyExpires := map[string]time.Duration{}
+	for _, cmd := range cmds {
+		if len(cmd.CacheKey) == 0 {
+			continue
+		}
+		if _, ok := keyCmds[cmd.CacheKey]; !ok {
+			keys = append(keys, cmd.CacheKey)
+		}
+		keyCmds[cmd.CacheKey] = append(keyCmds[cmd.CacheKey], cmd)
+		if cmd.CacheExpire > 0 {
+			keyExpires[cmd.CacheKey] = cmd.CacheExpire
+		}
+	}
+
+	var lastErr error
+	errMutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for _, key := range keys {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			_, err := sc.BitField(key, keyCmds[key])
+			if err == nil {
+				if expire, ok := keyExpires[key]; ok {
+					err = sc.Expire(key, expire)
+				}
+			}
+			if err != nil {
+				errMutex.Lock()
+				lastErr = err
+				errMutex.Unlock()
+			}
+		}(key)
+	}
+	wg.Wait()
+	return lastErr
+}
+
+// BitField run cmds on one owner, and replicate to the other owners by SET the results of INCRBY,
+// GET is not replicated
+func (sc *ShardedCacher) BitField(key string, cmds []*BitFieldCmd) ([]int64, error) {
+	var vals []int64
+	err := sc.writeCounter(key, func(cacher ICacher) error {
+		var err error
+		vals, err = cacher.BitField(key, cmds)
+		return err
+	}, func(cacher ICacher) error {
+		replicaCmds := bitFieldReplicaCmds(cmds, vals)
+		if len(replicaCmds) == 0 {
+			return nil
+		}
+		_, err := cacher.BitField(key, replicaCmds)
+		return err
+	})
+	return vals, err
+}
+
+// bitFieldReplicaCmds return cmds that make the other owner the same as the owner that run cmds and return vals,
+// vals has one value per cmd that is not OVERFLOW
+func bitFieldReplicaCmds(cmds []*BitFieldCmd, vals []int64) []*BitFieldCmd {
+	replicaCmds := []*BitFieldCmd{}
+	i := 0
+	for _, cmd := range cmds {
+		switch cmd.CmdType {
+		case BitFieldCmdTypeOverflow:
+			replicaCmds = append(replicaCmds, cmd)
+			continue
+		case BitFieldCmdTypeSet:
+			replicaCmds = append(replicaCmds, cmd)
+		case BitFieldCmdTypeIncrBy:
+			if i < len(vals) {
+				set := *cmd
+				set.CmdType = BitFieldCmdTypeSet
+				set.Value = vals[i]
+				replicaCmds = append(replicaCmds, &set)
+			}
+		}
+		i++
+	}
+
+	// Only OVERFLOW left, nothing to write
+	for _, cmd := range replicaCmds {
+		if cmd.CmdType != BitFieldCmdTypeOverflow {
+			return replicaCmds
+		}
+	}
+	return nil
+}
+
+func (sc *ShardedCacher) BitFieldGet(key string, byteSize int, position int) (int64, error) {
+	var val int64
+	err := sc.read(key, func(cacher ICacher) error {
+		var err error
+		val, err = cacher.BitFieldGet(key, byteSize, position)
+		return err
+	})
+	return val, err
+}
+
+// BitFieldSet return the previous value of the owner that is written first
+func (sc *ShardedCacher) BitFieldSet(key string, byteSize int, position int, value interface{}) (int64, error) {
+	var val int64
+	err := sc.writeCounter(key, func(cacher ICacher) error {
+		var err error
+		val, err = cacher.BitFieldSet(key, byteSize, position, value)
+		return err
+	}, func(cacher ICacher) error {
+		_, err := cacher.BitFieldSet(key, byteSize, position, value)
+		return err
+	})
+	return val, err
+}
+
+func (sc *ShardedCacher) BitFieldIncrBy(key string, byteSize int, position int, value int64) (int64, error) {
+	var val int64
+	err := sc.writeCounter(key, func(cacher ICacher) error {
+		var err error
+		val, err = cacher.BitFieldIncrBy(key, byteSize, position, value)
+		return err
+	}, func(cacher ICacher) error {
+		_, err := cacher.BitFieldSet(key, byteSize, position, val)
+		return err
+	})
+	return val, err
+}
+
+func (sc *ShardedCacher) HScan(
+	key string, cursor uint64, fieldPattern string, count int64) ([]string, uint64 /*next cursor*/, error) {
+	var fields []string
+	var nextCursor uint64
+	err := sc.read(key, func(cacher ICacher) error {
+		var err error
+		fields, nextCursor, err = cacher.HScan(key, cursor, fieldPattern, count)
+		return err
+	})
+	return fields, nextCursor, err
+}
+
+func (sc *ShardedCacher) HSetS(key string, field string, value string, expire time.Duration) error {
+	return sc.write(key, func(cacher ICacher) error {
+		return cacher.HSetS(key, field, value, expire)
+	})
+}
+
+func (sc *ShardedCacher) HSetSNoExpire(key string, field string, value string) error {
+	return sc.write(key, func(cacher ICacher) error {
+		return cacher.HSetSNoExpire(key, field, value)
+	})
+}
+
+func (sc *ShardedCacher) HIncrBy(key string, field string, val int) (int, error) {
+	return sc.hashCounter(key, field, func(cacher ICacher) (int, error) {
+		return cacher.HIncrBy(key, field, val)
+	})
+}
+
+func (sc *ShardedCacher) HDecrBy(key string, field string, val int) (int, error) {
+	return sc.hashCounter(key, field, func(cacher ICacher) (int, error) {
+		return cacher.HDecrBy(key, field, val)
+	})
+}
+
+func (sc *ShardedCacher) HIncr(key string, field string) (int, error) {
+	return sc.hashCounter(key, field, func(cacher ICacher) (int, error) {
+		return cacher.HIncr(key, field)
+	})
+}
+
+func (sc *ShardedCacher) HDecr(key string, field string) (int, error) {
+	return sc.hashCounter(key, field, func(cacher ICacher) (int, error) {
+		return cacher.HDecr(key, field)
+	})
+}
+
+func (sc *ShardedCacher) HMSet(key string, fieldValues map[string]interface{}) error {
+	return sc.write(key, func(cacher ICacher) error {
+		return cacher.HMSet(key, fieldValues)
+	})
+}
+
+func (sc *ShardedCacher) HGet(key string, field string) (string, error) {
+	var val string
+	err := sc.read(key, func(cacher ICacher) error {
+		var err error
+		val, err = cacher.HGet(key, field)
+		return err
+	})
+	return val, err
+}
+
+func (sc *ShardedCacher) HMGet(key string, fields []string) ([]interface{}, error) {
+	var vals []interface{}
+	err := sc.read(key, func(cacher ICacher) error {
+		var err error
+		vals, err = cacher.HMGet(key, fields)
+		return err
+	})
+	return vals, err
+}
+
+func (sc *ShardedCacher) HDel(key string, fields ...string) error {
+	return sc.write(key, func(cacher ICacher) error {
+		return cacher.HDel(key, fields...)
+	})
+}
+
+func (sc *ShardedCacher) HExists(key string, field string) (bool, error) {
+	var exists bool
+	err := sc.read(key, func(cacher ICacher) error {
+		var err error
+		exists, err = cacher.HExists(key, field)
+		return err
+	})
+	return exists, err
+}
+
+func (sc *ShardedCacher) HFields(key string, pattern string) ([]string, error) {
+	var fields []string
+	err := sc.read(key, func(cacher ICacher) error {
+		var err error
+		fields, err = cacher.HFields(key, pattern)
+		return err
+	})
+	return fields, err
+}
+
+func (sc *ShardedCacher) Set(key string, value interface{}, expire time.Duration) error {
+	return sc.write(key, func(cacher ICacher) error {
+		return cacher.Set(key, value, expire)
+	})
+}
+
+func (sc *ShardedCacher) SetS(key string, value string, expire time.Duration) error {
+	return sc.write(key, func(cacher ICacher) error {
+		return cacher.SetS(key, value, expire)
+	})
+}
+
+func (sc *ShardedCacher) SetNoExpire(key string, value interface{}) error {
+	return sc.write(key, func(cacher ICacher) error {
+		return cacher.SetNoExpire(key, value)
+	})
+}
+
+func (sc *ShardedCacher) SetSNoExpire(key string, value string) error {
+	return sc.write(key, func(cacher ICacher) error {
+		return cacher.SetSNoExpire(key, value)
+	})
+}
+
+func (sc *ShardedCacher) SetSKeepTTL(key string, value string) error {
+	return sc.write(key, func(cacher ICacher) error {
+		return cacher.SetSKeepTTL(key, value)
+	})
+}
+
+func (sc *ShardedCacher) IncrBy(key string, val int) (int, error) {
+	return sc.intCounter(key, func(cacher ICacher) (int, error) {
+		return cacher.IncrBy(key, val)
+	})
+}
+
+func (sc *ShardedCacher) DecrBy(key string, val int) (int, error) {
+	return sc.intCounter(key, func(cacher ICacher) (int, error) {
+		return cacher.DecrBy(key, val)
+	})
+}
+
+func (sc *ShardedCacher) Incr(key string) (int, error) {
+	return sc.intCounter(key, func(cacher ICacher) (int, error) {
+		return cacher.Incr(key)
+	})
+}
+
+func (sc *ShardedCacher) Decr(key string) (int, error) {
+	return sc.intCounter(key, func(cacher ICacher) (int, error) {
+		return cacher.Decr(key)
+	})
+}
+
+// MSet set multiple key value, keys are grouped and MSET by shard
+func (sc *ShardedCacher) MSet(kv map[string]interface{}) error {
+	keys := []string{}
+	for k := range kv {
+		keys = append(keys, k)
+	}
+
+	return sc.writeKeys(keys, func(shard int, idxs []int) error {
+		shardKV := map[string]interface{}{}
+		for _, idx := range idxs {
+			shardKV[keys[idx]] = kv[keys[idx]]
+		}
+		return sc.cachers[shard].MSet(shardKV)
+	})
+}
+
+func (sc *ShardedCacher) Get(key string) (string, error) {
+	var val string
+	err := sc.read(key, func(cacher ICacher) error {
+		var err error
+		val, err = cacher.Get(key)
+		return err
+	})
+	return val, err
+}
+
+// MGet get by multiple keys from every shards, the values are in the same order as keys,
+// the keys of failed shard are read again from the next healthy owner
+func (sc *ShardedCacher) MGet(keys []string) ([]interface{}, error) {
+	vals := make([]interface{}, len(keys))
+	pending := make([]int, len(keys))
+	for i := range keys {
+		pending[i] = i
+	}
+
+	for attempt := 0; attempt < sc.ring.ReplicationFactor() && len(pending) > 0; attempt++ {
+		// Group pending keys by the first healthy owner, the failed shard is marked down in previous attempt
+		// and the stale owner is read last
+		groups := map[int][]int{}
+		for _, idx := range pending {
+			owners := sc.readOwners(keys[idx])
+			if len(owners) == 0 {
+				return nil, noHealthyShardError(keys[idx])
+			}
+			groups[owners[0]] = append(groups[owners[0]], idx)
+		}
+
+		failedMutex := sync.Mutex{}
+		failed := []int{}
+		err := sc.scatter(groups, func(shard int, idxs []int) error {
+			shardVals, err := sc.cachers[shard].MGet(pickKeys(keys, idxs))
+			if err != nil {
+				sc.checkShardError(shard, err)
+				failedMutex.Lock()
+				failed = append(failed, idxs...)
+				failedMutex.Unlock()
+				return err
+			}
+			// Each goroutine write to different indexes, so no need to lock
+			for i, idx := range idxs {
+				if i < len(shardVals) {
+					vals[idx] = shardVals[i]
+				}
+				if !sc.isStale(shard, keys[idx]) {
+					sc.repairAfterRead(keys[idx], shard)
+				}
+			}
+			return nil
+		})
+		if err != nil && attempt == sc.ring.ReplicationFactor()-1 {
+			return nil, err
+		}
+		pending = failed
+	}
+	return vals, nil
+}
+
+func (sc *ShardedCacher) Expire(key string, expire time.Duration) error {
+	return sc.write(key, func(cacher ICacher) error {
+		return cacher.Expire(key, expire)
+	})
+}
+
+func (sc *ShardedCacher) Expires(keys []string, expire time.Duration) error {
+	return sc.writeKeys(keys, func(shard int, idxs []int) error {
+		return sc.cachers[shard].Expires(pickKeys(keys, idxs), expire)
+	})
+}
+
+func (sc *ShardedCacher) Del(keys ...string) error {
+	return sc.writeKeys(keys, func(shard int, idxs []int) error {
+		return sc.cachers[shard].Del(pickKeys(keys, idxs)...)
+	})
+}
+
+func (sc *ShardedCacher) Exists(key string) (bool, error) {
+	var exists bool
+	err := sc.read(key, func(cacher ICacher) error {
+		var err error
+		exists, err = cacher.Exists(key)
+		return err
+	})
+	return exists, err
+}
+
+// Pub publish to the primary shard that own channel
+func (sc *ShardedCacher) Pub(channel string, message interface{}) error {
+	return sc.cacherOf(channel).Pub(channel, message)
+}
+
+// Sub subscribe channels on the primary shards that own them, messages from every shards are merged into one channel
+func (sc *ShardedCacher) Sub(channels ...string) (<-chan *redis.Message /*subID (used for close)*/, string, error) {
+	shardChannels := map[int][]string{}
+	for _, channel := range channels {
+		shard := sc.shardOf(channel)
+		shardChannels[shard] = append(shardChannels[shard], channel)
+	}
+
+	// The buffer is the same as the channel of redis.PubSub
+	merged := make(chan *redis.Message, 100)
+	sub := &shardedSub{subIDs: map[int]string{}, done: make(chan struct{})}
+	wg := sync.WaitGroup{}
+	for shard, channels := range shardChannels {
+		msgs, subID, err := sc.cachers[shard].Sub(channels...)
+		if err != nil {
+			for shard, subID := range sub.subIDs {
+				sc.cachers[shard].Unsub(subID)
+			}
+			return nil, "", err
+		}
+		sub.subIDs[shard] = subID
+
+		wg.Add(1)
+		go func(msgs <-chan *redis.Message) {
+			defer wg.Done()
+			for msg := range msgs {
+				select {
+				case merged <- msg:
+				case <-sub.done:
+					return
+				}
+			}
+		}(msgs)
+	}
+
+	// Close merged channel when every shards are unsubscribed
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+
+	subID := NewUUID()
+	sc.subsribers.Store(subID, sub)
+	return merged, subID, nil
+}
+
+// Unsub unsubscribe from every shards of subscription
+func (sc *ShardedCacher) Unsub(subID string) error {
+	// LoadAndDelete make sure that done is closed once when Unsub is called concurrently
+	val, ok := sc.subsribers.LoadAndDelete(subID)
+	if !ok {
+		return nil
+	}
+	sub := val.(*shardedSub)
+	close(sub.done)
+
+	var lastErr error
+	for shard, shardSubID := range sub.subIDs {
+		err := sc.cachers[shard].Unsub(shardSubID)
+		if err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// Close unsubscribe every subscriptions of sharded cacher, the cachers of shards are not closed,
+// they are owned by the caller of NewShardedCacher (eg. closed by Microservice.Cleanup())
+func (sc *ShardedCacher) Close() error {
+	var lastErr error
+	sc.subsribers.Range(func(key, value interface{}) bool {
+		err := sc.Unsub(key.(string))
+		if err != nil {
+			lastErr = err
+		}
+		return true
+	})
+	return lastErr
+}
+
+// Keys returns keys by given pattern from every healthy shards,
+// the keys on backup shards are the same keys, so the result is deduplicated
+func (sc *ShardedCacher) Keys(pattern string) ([]string, error) {
+	keysMutex := sync.Mutex{}
+	allKeys := map[string]struct{}{}
+	err := sc.scatter(sc.healthyShards(), func(shard int, _ []int) error {
+		keys, err := sc.cachers[shard].Keys(pattern)
+		if err != nil {
+			sc.checkShardError(shard, err)
+			return err
+		}
+		keysMutex.Lock()
+		for _, key := range keys {
+			allKeys[key] = struct{}{}
+		}
+		keysMutex.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	retKeys := []string{}
+	for key := range allKeys {
+		retKeys = append(retKeys, key)
+	}
+	return retKeys, nil
+}
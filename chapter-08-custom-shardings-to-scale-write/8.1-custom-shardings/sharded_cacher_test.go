@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+// newTestShardedCacher return ShardedCacher over 3 shards without cachers, the owners do not use cachers
+func newTestShardedCacher(replicationFactor int) *ShardedCacher {
+	ring := newTestRing(1, 1, 1).SetReplicationFactor(replicationFactor)
+	return NewShardedCacher(ring, make([]ICacher, len(ring.Shards())))
+}
+
+func TestShardedCacherWriteOwners(t *testing.T) {
+	tests := []struct {
+		name              string
+		replicationFactor int
+		down              []int // index in the owners of key
+		want              []int // index in the owners of key
+	}{
+		{"every owners are up", 2, nil, []int{0, 1}},
+		{"primary is down", 2, []int{0}, []int{1}},
+		{"backup is down", 2, []int{1}, []int{0}},
+		{"every owners are down", 2, []int{0, 1}, []int{}},
+		{"no replication", 1, nil, []int{0}},
+		{"three replicas, middle is down", 3, []int{1}, []int{0, 2}},
+	}
+	key := "register::user_1"
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := newTestShardedCacher(tt.replicationFactor)
+			owners := sc.ring.shardIndexesOfHash(ringHash(key), tt.replicationFactor)
+			for _, i := range tt.down {
+				sc.healths[owners[i]].markDown()
+			}
+
+			got := sc.writeOwners(key)
+			if len(got) != len(tt.want) {
+				t.Fatalf("writeOwners = %v, want %v", got, tt.want)
+			}
+			for i, j := range tt.want {
+				if got[i] != owners[j] {
+					t.Fatalf("writeOwners = %v, want owners %v of %v", got, tt.want, owners)
+				}
+			}
+			// The owners that are down missed the write, so they get the hint of key
+			for _, i := range tt.down {
+				if !sc.isStale(owners[i], key) {
+					t.Errorf("owner %d is down but has no hint", owners[i])
+				}
+			}
+			for _, j := range tt.want {
+				if sc.isStale(owners[j], key) {
+					t.Errorf("owner %d is written but has hint", owners[j])
+				}
+			}
+		})
+	}
+}
+
+func TestShardedCacherReadOwners(t *testing.T) {
+	tests := []struct {
+		name  string
+		stale []int // index in the owners of key
+		down  []int // index in the owners of key
+		want  []int // index in the owners of key
+	}{
+		{"every owners are fresh", nil, nil, []int{0, 1, 2}},
+		{"primary is stale", []int{0}, nil, []int{1, 2, 0}},
+		{"primary and backup are stale", []int{0, 1}, nil, []int{2, 0, 1}},
+		{"primary is down", nil, []int{0}, []int{1, 2}},
+		{"primary is down and backup is stale", []int{1}, []int{0}, []int{2, 1}},
+	}
+	key := "register::user_1"
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := newTestShardedCacher(3)
+			owners := sc.ring.shardIndexesOfHash(ringHash(key), 3)
+			for _, i := range tt.stale {
+				sc.hint(owners[i], key)
+			}
+			for _, i := range tt.down {
+				sc.healths[owners[i]].markDown()
+			}
+
+			got := sc.readOwners(key)
+			if len(got) != len(tt.want) {
+				t.Fatalf("readOwners = %v, want %v", got, tt.want)
+			}
+			for i, j := range tt.want {
+				if got[i] != owners[j] {
+					t.Fatalf("readOwners = %v, want owners %v of %v", got, tt.want, owners)
+				}
+			}
+		})
+	}
+}
+
+func TestShardedCacherHintIsPerKey(t *testing.T) {
+	sc := newTestShardedCacher(2)
+	sc.hint(0, "register::user_1")
+	if !sc.isStale(0, "register::user_1") {
+		t.Error("shard 0 is not stale for the hinted key")
+	}
+	if sc.isStale(0, "register::user_2") {
+		t.Error("shard 0 is stale for the other key")
+	}
+	if sc.isStale(1, "register::user_1") {
+		t.Error("shard 1 is stale for the key that is hinted on shard 0")
+	}
+}
+
+func TestShardHintsLimit(t *testing.T) {
+	hints := &shardHints{}
+	for _, key := range testKeys(maxHintsPerShard) {
+		if !hints.add(key) {
+			t.Fatalf("add(%q) is dropped before the limit", key)
+		}
+	}
+	// The key that is hinted already is not counted again
+	if !hints.add("register::user_0") || hints.len() != maxHintsPerShard {
+		t.Fatalf("len = %d after add the same key, want %d", hints.len(), maxHintsPerShard)
+	}
+	if hints.add("register::over_limit") || hints.has("register::over_limit") {
+		t.Error("the hint over the limit is kept")
+	}
+
+	hints.remove("register::user_0")
+	hints.remove("register::user_0")
+	if hints.len() != maxHintsPerShard-1 {
+		t.Errorf("len = %d after remove, want %d", hints.len(), maxHintsPerShard-1)
+	}
+	if !hints.add("register::over_limit") {
+		t.Error("the hint is dropped after the other hint is removed")
+	}
+}
+
+func TestIsRedisError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"reply error", redis.Nil, true},
+		{"wrapped reply error", fmt.Errorf("get: %w", redis.Nil), true},
+		{"connection error", errors.New("dial tcp: connection refused"), false},
+	}
+	for _, tt := range tests {
+		if got := isRedisError(tt.err); got != tt.want {
+			t.Errorf("%s: isRedisError = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+// VoteState is the state of citizen in ballot, it use 2 bits per citizen
+type VoteState int64
+
+const (
+	VoteNone    VoteState = 0
+	VoteYes     VoteState = 1
+	VoteNo      VoteState = 2
+	VoteAbstain VoteState = 3
+)
+
+var voteStateNames = []string{"none", "yes", "no", "abstain"}
+
+func (state VoteState) String() string {
+	if state < 0 || int(state) >= len(voteStateNames) {
+		return fmt.Sprintf("unknown(%d)", state)
+	}
+	return voteStateNames[state]
+}
+
+// ParseVoteState return the state of vote yes, no or abstain
+func ParseVoteState(vote string) (VoteState, error) {
+	switch vote {
+	case "yes":
+		return VoteYes, nil
+	case "no":
+		return VoteNo, nil
+	case "abstain":
+		return VoteAbstain, nil
+	}
+	return VoteNone, fmt.Errorf("vote must be yes, no or abstain, got %q", vote)
+}
+
+// RevoteRule is how the vote of citizen who already voted is handled
+type RevoteRule string
+
+const (
+	// RevoteReject keep the first vote, the next votes return ErrAlreadyVoted
+	RevoteReject RevoteRule = "reject"
+	// RevoteAllow change the vote to the new choice, vote the same choice again does nothing
+	RevoteAllow RevoteRule = "allow"
+	// RevoteLastWriteWins always write the vote, the last vote is kept
+	RevoteLastWriteWins RevoteRule = "last_write_wins"
+)
+
+// ErrAlreadyVoted is returned by RevoteReject when citizen already voted
+var ErrAlreadyVoted = errors.New("already voted")
+
+// shouldWriteVote return true if the vote of state is written when the citizen is in prev state,
+// the first vote is always written and the next votes are handled by rule
+func shouldWriteVote(rule RevoteRule, prev VoteState, state VoteState) bool {
+	if prev == VoteNone {
+		return true
+	}
+	switch rule {
+	case RevoteReject:
+		return false
+	case RevoteAllow:
+		return prev != state
+	}
+	return true
+}
+
+// voteWriteMask return the transitions to state from every previous states for ballotScript,
+// the character i is 1 if the vote is written when the previous state is i, eg. "1000" for RevoteReject
+func voteWriteMask(rule RevoteRule, state VoteState) string {
+	mask := make([]byte, len(voteStateNames))
+	for prev := range mask {
+		mask[prev] = '0'
+		if shouldWriteVote(rule, VoteState(prev), state) {
+			mask[prev] = '1'
+		}
+	}
+	return string(mask)
+}
+
+// ballotScript set the state of citizen and update the tally in the same script,
+// so the tally is always the same as the states even when the same citizen vote concurrently.
+// The transition rules are in shouldWriteVote, the script only look up the mask by the previous state
+// KEYS[1] states, KEYS[2] tally, ARGV[1] position (#citizen), ARGV[2] new state, ARGV[3] voteWriteMask
+// return {previous state, 1 if state is written}
+var ballotScript = redis.NewScript(`
+local prev = redis.call('BITFIELD', KEYS[1], 'GET', 'u2', ARGV[1])[1]
+local state = tonumber(ARGV[2])
+if string.sub(ARGV[3], prev + 1, prev + 1) ~= '1' then
+	return {prev, 0}
+end
+redis.call('BITFIELD', KEYS[1], 'SET', 'u2', ARGV[1], state)
+local names = {'yes', 'no', 'abstain'}
+if prev == 0 then
+	redis.call('HINCRBY', KEYS[2], 'turnout', 1)
+else
+	redis.call('HINCRBY', KEYS[2], names[prev], -1)
+end
+redis.call('HINCRBY', KEYS[2], names[state], 1)
+return {prev, 1}
+`)
+
+// Ballot keep the state of every citizens in PackedArray of u2 (ballot:0, ballot:1, ...)
+// and the number of yes, no, abstain and turnout in hash tally::vote
+type Ballot struct {
+	cacher   ICacher
+	states   *PackedArray
+	tallyKey string
+	rule     RevoteRule
+}
+
+// NewBallot return ballot that handle revote by rule
+func NewBallot(cacher ICacher, rule RevoteRule) (*Ballot, error) {
+	switch rule {
+	case RevoteReject, RevoteAllow, RevoteLastWriteWins:
+	default:
+		return nil, fmt.Errorf("invalid revote rule %s", rule)
+	}
+
+	states, err := NewPackedArray(cacher, KeyBallot.MustKey(), 2, false, BitFieldOverflowTypeSat)
+	if err != nil {
+		return nil, err
+	}
+	return &Ballot{
+		cacher:   cacher,
+		states:   states,
+		tallyKey: KeyVoteTally.MustKey(),
+		rule:     rule,
+	}, nil
+}
+
+// Vote set the state of citizen and return the previous state, changed is false if the state is not written,
+// ErrAlreadyVoted is returned with the previous state if citizen already voted and rule is RevoteReject
+func (ballot *Ballot) Vote(citizenID int, state VoteState) (prev VoteState, changed bool, err error) {
+	if state == VoteNone {
+		return VoteNone, false, fmt.Errorf("vote must be yes, no or abstain")
+	}
+	if citizenID < 0 {
+		return VoteNone, false, fmt.Errorf("citizen %d is out of range", citizenID)
+	}
+
+	key, position := ballot.states.KeyOf(citizenID)
+	res, err := ballot.cacher.Eval(
+		ballotScript,
+		[]string{key, ballot.tallyKey},
+		fmt.Sprintf("#%d", position),
+		int64(state),
+		voteWriteMask(ballot.rule, state))
+	if err != nil {
+		return VoteNone, false, err
+	}
+
+	vals, ok := res.([]interface{})
+	if !ok || len(vals) != 2 {
+		return VoteNone, false, fmt.Errorf("invalid ballot script result %v", res)
+	}
+	prevVal, _ := vals[0].(int64)
+	written, _ := vals[1].(int64)
+	prev = VoteState(prevVal)
+	if prev != VoteNone && ballot.rule == RevoteReject {
+		return prev, false, ErrAlreadyVoted
+	}
+	return prev, written == 1, nil
+}
+
+// State return the state of citizen
+func (ballot *Ballot) State(citizenID int) (VoteState, error) {
+	state, err := ballot.states.Get(citizenID)
+	if err != nil {
+		return VoteNone, err
+	}
+	return VoteState(state), nil
+}
+
+// Tally return the number of yes, no, abstain and turnout
+func (ballot *Ballot) Tally() (*VoteResults, error) {
+	vals, err := ballot.cacher.HMGet(ballot.tallyKey, []string{"yes", "no", "abstain", "turnout"})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make([]int64, 4)
+	for i, val := range vals {
+		str, ok := val.(string)
+		if !ok {
+			// The field is not set yet
+			continue
+		}
+		counts[i], err = strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &VoteResults{
+		Yes:     counts[0],
+		No:      counts[1],
+		Abstain: counts[2],
+		Turnout: counts[3],
+	}, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import "testing"
+
+func TestShouldWriteVote(t *testing.T) {
+	tests := []struct {
+		rule  RevoteRule
+		prev  VoteState
+		state VoteState
+		want  bool
+	}{
+		// The first vote is always written
+		{RevoteReject, VoteNone, VoteYes, true},
+		{RevoteAllow, VoteNone, VoteNo, true},
+		{RevoteLastWriteWins, VoteNone, VoteAbstain, true},
+
+		// Reject keep the first vote
+		{RevoteReject, VoteYes, VoteYes, false},
+		{RevoteReject, VoteYes, VoteNo, false},
+		{RevoteReject, VoteAbstain, VoteYes, false},
+
+		// Allow change the vote, the same choice is not written
+		{RevoteAllow, VoteYes, VoteNo, true},
+		{RevoteAllow, VoteNo, VoteAbstain, true},
+		{RevoteAllow, VoteNo, VoteNo, false},
+		{RevoteAllow, VoteAbstain, VoteAbstain, false},
+
+		// Last write wins always write
+		{RevoteLastWriteWins, VoteYes, VoteNo, true},
+		{RevoteLastWriteWins, VoteNo, VoteNo, true},
+	}
+	for _, tt := range tests {
+		if got := shouldWriteVote(tt.rule, tt.prev, tt.state); got != tt.want {
+			t.Errorf("shouldWriteVote(%s, %s, %s) = %v, want %v", tt.rule, tt.prev, tt.state, got, tt.want)
+		}
+	}
+}
+
+func TestVoteWriteMask(t *testing.T) {
+	tests := []struct {
+		rule  RevoteRule
+		state VoteState
+		want  string
+	}{
+		{RevoteReject, VoteYes, "1000"},
+		{RevoteReject, VoteAbstain, "1000"},
+		{RevoteAllow, VoteYes, "1011"},
+		{RevoteAllow, VoteNo, "1101"},
+		{RevoteAllow, VoteAbstain, "1110"},
+		{RevoteLastWriteWins, VoteNo, "1111"},
+	}
+	for _, tt := range tests {
+		if got := voteWriteMask(tt.rule, tt.state); got != tt.want {
+			t.Errorf("voteWriteMask(%s, %s) = %q, want %q", tt.rule, tt.state, got, tt.want)
+		}
+	}
+}
+
+func TestParseVoteState(t *testing.T) {
+	tests := []struct {
+		vote    string
+		want    VoteState
+		wantErr bool
+	}{
+		{"yes", VoteYes, false},
+		{"no", VoteNo, false},
+		{"abstain", VoteAbstain, false},
+		// Not voted is the state, it cannot be voted
+		{"none", VoteNone, true},
+		{"YES", VoteNone, true},
+		{"", VoteNone, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseVoteState(tt.vote)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseVoteState(%q) error = %v, wantErr %v", tt.vote, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("ParseVoteState(%q) = %s, want %s", tt.vote, got, tt.want)
+		}
+	}
+}
+
+func TestVoteStateString(t *testing.T) {
+	tests := []struct {
+		state VoteState
+		want  string
+	}{
+		{VoteNone, "none"},
+		{VoteYes, "yes"},
+		{VoteNo, "no"},
+		{VoteAbstain, "abstain"},
+		{VoteState(4), "unknown(4)"},
+		{VoteState(-1), "unknown(-1)"},
+	}
+	for _, tt := range tests {
+		if got := tt.state.String(); got != tt.want {
+			t.Errorf("VoteState(%d).String() = %q, want %q", int64(tt.state), got, tt.want)
+		}
+	}
+}
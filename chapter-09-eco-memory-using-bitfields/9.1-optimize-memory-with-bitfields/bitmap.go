@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// BitRangeUnit is the unit of start and end in BITCOUNT and BITPOS
+type BitRangeUnit string
+
+const (
+	// BitRangeUnitByte is the default unit, start and end are byte index
+	BitRangeUnitByte BitRangeUnit = "BYTE"
+	// BitRangeUnitBit is the bit index, it is supported since redis 7.0
+	BitRangeUnitBit BitRangeUnit = "BIT"
+)
+
+// BitOpType is the operation of BITOP
+type BitOpType string
+
+const (
+	BitOpAnd BitOpType = "AND"
+	BitOpOr  BitOpType = "OR"
+	BitOpXor BitOpType = "XOR"
+	BitOpNot BitOpType = "NOT"
+)
+
+// bitRangeArgs return start end [BIT], BYTE is not sent so it work with redis before 7.0
+func bitRangeArgs(start int64, end int64, unit BitRangeUnit) []interface{} {
+	args := []interface{}{start, end}
+	if unit == BitRangeUnitBit {
+		args = append(args, string(unit))
+	}
+	return args
+}
+
+// BitCount count the bits that are 1 in key
+func (cache *Cacher) BitCount(key string) (int64, error) {
+
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	return c.BitCount(context.Background(), key, nil).Result()
+}
+
+// BitCountRange count the bits that are 1 between start and end (include), the negative index count from the end
+func (cache *Cacher) BitCountRange(key string, start int64, end int64, unit BitRangeUnit) (int64, error) {
+
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	args := append([]interface{}{"bitcount", key}, bitRangeArgs(start, end, unit)...)
+	return c.Do(context.Background(), args...).Int64()
+}
+
+// BitPos return the position of the first bit that is bit (0 or 1), -1 if not found
+func (cache *Cacher) BitPos(key string, bit int) (int64, error) {
+
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	return c.BitPos(context.Background(), key, int64(bit)).Result()
+}
+
+// BitPosRange return the position of the first bit that is bit (0 or 1) between start and end (include), -1 if not found
+func (cache *Cacher) BitPosRange(key string, bit int, start int64, end int64, unit BitRangeUnit) (int64, error) {
+
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	args := append([]interface{}{"bitpos", key, bit}, bitRangeArgs(start, end, unit)...)
+	return c.Do(context.Background(), args...).Int64()
+}
+
+// BitOp store the result of op on keys into destKey and return the size of destKey in bytes, NOT accept only one key
+func (cache *Cacher) BitOp(op BitOpType, destKey string, keys ...string) (int64, error) {
+
+	if op == BitOpNot && len(keys) != 1 {
+		return 0, fmt.Errorf("bitop NOT accept only one key, got %d keys", len(keys))
+	}
+
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	switch op {
+	case BitOpAnd:
+		return c.BitOpAnd(context.Background(), destKey, keys...).Result()
+	case BitOpOr:
+		return c.BitOpOr(context.Background(), destKey, keys...).Result()
+	case BitOpXor:
+		return c.BitOpXor(context.Background(), destKey, keys...).Result()
+	case BitOpNot:
+		return c.BitOpNot(context.Background(), destKey, keys[0]).Result()
+	}
+	return 0, fmt.Errorf("invalid bitop %s", op)
+}
+
+// SetBit set bit at offset to value (0 or 1) and return the previous bit
+func (cache *Cacher) SetBit(key string, offset int64, value int) (int, error) {
+
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	val, err := c.SetBit(context.Background(), key, offset, value).Result()
+	if err != nil {
+		return 0, err
+	}
+	return int(val), nil
+}
+
+// GetBit return bit at offset, the bit that is never set is 0
+func (cache *Cacher) GetBit(key string, offset int64) (int, error) {
+
+	c, err := cache.getClient()
+	if err != nil {
+		return 0, err
+	}
+
+	val, err := c.GetBit(context.Background(), key, offset).Result()
+	if err != nil {
+		return 0, err
+	}
+	return int(val), nil
+}
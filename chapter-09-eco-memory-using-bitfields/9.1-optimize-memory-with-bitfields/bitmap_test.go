@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBitRangeArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		start int64
+		end   int64
+		unit  BitRangeUnit
+		want  []interface{}
+	}{
+		// BYTE is the default unit, it is not sent so the command work with redis before 7.0
+		{"byte", 0, 10, BitRangeUnitByte, []interface{}{int64(0), int64(10)}},
+		{"empty unit", 1, 2, BitRangeUnit(""), []interface{}{int64(1), int64(2)}},
+		{"bit", 5, 100, BitRangeUnitBit, []interface{}{int64(5), int64(100), "BIT"}},
+		{"negative index", -8, -1, BitRangeUnitBit, []interface{}{int64(-8), int64(-1), "BIT"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bitRangeArgs(tt.start, tt.end, tt.unit); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("bitRangeArgs(%d, %d, %s) = %v, want %v", tt.start, tt.end, tt.unit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBitOpNotArity(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+	}{
+		{"no key", nil},
+		{"two keys", []string{"a", "b"}},
+	}
+	// The arity is checked before connect, so the cacher without client is enough
+	cache := &Cacher{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := cache.BitOp(BitOpNot, "dest", tt.keys...); err == nil {
+				t.Errorf("BitOp(NOT, %v) error = nil, want error", tt.keys)
+			}
+		})
+	}
+}
@@ -22,6 +22,14 @@ type ICacher interface {
 	BitFieldSet(key string, byteSize int, position int, value interface{}) (int64, error)
 	BitFieldIncrBy(key string, byteSize int, position int, value int64) (int64, error)
 
+	BitCount(key string) (int64, error)
+	BitCountRange(key string, start int64, end int64, unit BitRangeUnit) (int64, error)
+	BitPos(key string, bit int) (int64, error)
+	BitPosRange(key string, bit int, start int64, end int64, unit BitRangeUnit) (int64, error)
+	BitOp(op BitOpType, destKey string, keys ...string) (int64, error)
+	SetBit(key string, offset int64, value int) (int, error)
+	GetBit(key string, offset int64) (int, error)
+
 	HScan(key string, cursor uint64, fieldPattern string, count int64) ([]string, uint64 /*next cursor*/, error)
 	HSetS(key string, field string, value string, expire time.Duration) error
 	HSetSNoExpire(key string, field string, value string) error
@@ -52,6 +60,9 @@ type ICacher interface {
 	Del(keys ...string) error
 	Exists(key string) (bool, error)
 
+	// Eval run lua script by EVALSHA, it fallback to EVAL if script is not loaded
+	Eval(script *redis.Script, keys []string, args ...interface{}) (interface{}, error)
+
 	Pub(channel string, message interface{}) error
 	Sub(channels ...string) (<-chan *redis.Message, string /*subID used for close*/, error)
 	Unsub(subID string) error
@@ -67,6 +78,9 @@ type ICacherConfig interface {
 	Endpoint() string
 	Password() string
 	DB() int
+	// KeyPrefix is the namespace of service, it is added to every keys and channels, eg. lesson9.1:
+	// so the services that share redis DB do not see (or delete) the keys of each others
+	KeyPrefix() string
 	ConnectionSettings() ICacherConnectionSettings
 }
 
@@ -134,6 +148,8 @@ func (setting *DefaultCacherConnectionSettings) WriteTimeout() time.Duration {
 type pubsubChannels struct {
 	ps       *redis.PubSub
 	channels []string
+	// done is closed by Unsub to stop the forwarder of messages
+	done chan struct{}
 }
 
 // Cacher is the struct for cache service
@@ -158,7 +174,7 @@ func NewCacher(config ICacherConfig) *Cacher {
 func (cache *Cacher) newClient() *redis.Client {
 	cfg := cache.config
 	settings := cfg.ConnectionSettings()
-	return redis.NewClient(&redis.Options{
+	client := redis.NewClient(&redis.Options{
 		Addr:               cfg.Endpoint(),
 		Password:           cfg.Password(),
 		DB:                 cfg.DB(),
@@ -173,6 +189,8 @@ func (cache *Cacher) newClient() *redis.Client {
 		ReadTimeout:        settings.ReadTimeout(),
 		WriteTimeout:       settings.WriteTimeout(),
 	})
+	cache.addKeyPrefixHook(client)
+	return client
 }
 
 func (cache *Cacher) getClient() (*redis.Client, error) {
@@ -296,9 +314,10 @@ func (cache *Cacher) Keys(pattern string) ([]string, error) {
 
 	}
 
+	// The key prefix is removed, so the keys can be passed to other commands
 	retKeys := []string{}
 	for key := range allKeys {
-		retKeys = append(retKeys, key)
+		retKeys = append(retKeys, cache.unprefixKey(key))
 	}
 	return retKeys, nil
 }
@@ -1028,6 +1047,7 @@ func (cache *Cacher) BitFieldIncrBy(key string, byteSize int, position int, valu
 	return ress[0], nil
 }
 
+// BitField run cmds on key, return redis.Nil if any command fail by OVERFLOW FAIL
 func (cache *Cacher) BitField(
 	key string,
 	cmds []*BitFieldCmd) ([]int64, error) {
@@ -1074,11 +1094,26 @@ func (cache *Cacher) bitfield(
 		}
 	}
 
-	res, err := c.BitField(context.Background(), key, args...).Result()
+	// Read the reply as []interface{}, because the command that fail by OVERFLOW FAIL return nil,
+	// and IntSliceCmd stop reading at nil and leave the rest of reply in connection
+	reply, err := c.Do(context.Background(), append([]interface{}{"bitfield", key}, args...)...).Slice()
 	if err != nil {
 		return nil, err
 	}
 
+	res := make([]int64, 0, len(reply))
+	overflow := false
+	for _, val := range reply {
+		num, ok := val.(int64)
+		if !ok {
+			overflow = true
+		}
+		res = append(res, num)
+	}
+	if overflow {
+		return nil, redis.Nil
+	}
+
 	return res, nil
 }
 
@@ -1339,6 +1374,24 @@ func NewBitFieldCmdIncrByU32(itemPosition int, value int64) *BitFieldCmd {
 	return NewBitFieldCmdIncrByU(32, itemPosition, value)
 }
 
+func NewBitFieldCmdGetI(byteSize int, itemPosition int) *BitFieldCmd {
+	cmd := NewBitFieldCmdGetU(byteSize, itemPosition)
+	cmd.Sign = true
+	return cmd
+}
+
+func NewBitFieldCmdSetI(byteSize int, itemPosition int, value interface{}) *BitFieldCmd {
+	cmd := NewBitFieldCmdSetU(byteSize, itemPosition, value)
+	cmd.Sign = true
+	return cmd
+}
+
+func NewBitFieldCmdIncrByI(byteSize int, itemPosition int, value int64) *BitFieldCmd {
+	cmd := NewBitFieldCmdIncrByU(byteSize, itemPosition, value)
+	cmd.Sign = true
+	return cmd
+}
+
 func NewBitFieldCmdU(cmdType BitFieldCmdType, byteSize int, itemPosition int, value int) *BitFieldCmd {
 	return &BitFieldCmd{
 		CmdType:      cmdType,
@@ -1388,8 +1441,22 @@ func NewBitFieldCmdU32(cmdType BitFieldCmdType, itemPosition int, value int) *Bi
 	return NewBitFieldCmdU(cmdType, 32, itemPosition, value)
 }
 
+// Eval run lua script by EVALSHA, it fallback to EVAL if script is not loaded
+func (cache *Cacher) Eval(script *redis.Script, keys []string, args ...interface{}) (interface{}, error) {
+
+	c, err := cache.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return script.Run(context.Background(), c, keys, args...).Result()
+}
+
 func (cache *Cacher) Autonumber(name string) (int, error) {
-	key := fmt.Sprintf("autonumber_%s", name)
+	key, err := KeyAutonumber.Key(name)
+	if err != nil {
+		return -1, err
+	}
 	nextNumber, err := cache.Incr(key)
 	if err != nil {
 		return -1, err
@@ -1434,15 +1501,19 @@ func (cache *Cacher) Sub(channels ...string) (<-chan *redis.Message /*subID (use
 		return nil, "", err
 	}
 
+	// SUBSCRIBE is not sent through hooks, so add the key prefix here
+	channels = cache.prefixKeys(channels)
 	ps := c.Subscribe(context.Background(), channels...)
 	subID := NewUUID()
+	done := make(chan struct{})
 
 	cache.subsribers.Store(subID, &pubsubChannels{
 		ps:       ps,
 		channels: channels,
+		done:     done,
 	})
 
-	return ps.Channel(), subID, nil
+	return cache.unprefixMessages(ps.Channel(), done), subID, nil
 }
 
 // Unsub will unsub subscriber
@@ -1451,7 +1522,7 @@ func (cache *Cacher) Unsub(subID string) error {
 		return nil
 	}
 
-	psChannels, ok := cache.subsribers.Load(subID)
+	psChannels, ok := cache.subsribers.LoadAndDelete(subID)
 	if !ok {
 		return nil
 	}
@@ -1459,6 +1530,7 @@ func (cache *Cacher) Unsub(subID string) error {
 	if !ok {
 		return nil
 	}
+	close(pubsubChannels.done)
 
 	if pubsubChannels.ps != nil {
 		err := pubsubChannels.ps.Unsubscribe(context.Background(), pubsubChannels.channels...)
@@ -1473,7 +1545,5 @@ func (cache *Cacher) Unsub(subID string) error {
 		}
 	}
 
-	cache.subsribers.Delete(subID)
-
 	return nil
 }
@@ -3,6 +3,8 @@ package main
 type IConfig interface {
 	PersisterConfig() IPersisterConfig
 	CacherConfig() ICacherConfig
+	// RevoteRule is how the vote of citizen who already voted is handled
+	RevoteRule() RevoteRule
 }
 
 type Config struct{}
@@ -19,6 +21,10 @@ func (cfg *Config) CacherConfig() ICacherConfig {
 	return NewCacherConfig()
 }
 
+func (cfg *Config) RevoteRule() RevoteRule {
+	return RevoteReject
+}
+
 type CacherConfig struct{}
 
 func NewCacherConfig() *CacherConfig {
@@ -37,6 +43,11 @@ func (cfg *CacherConfig) DB() int {
 	return 0
 }
 
+// KeyPrefix is the namespace of this lesson, setup() delete only the keys in this namespace
+func (cfg *CacherConfig) KeyPrefix() string {
+	return "lesson9.1:"
+}
+
 func (cfg *CacherConfig) ConnectionSettings() ICacherConnectionSettings {
 	return NewDefaultCacherConnectionSettings()
 }
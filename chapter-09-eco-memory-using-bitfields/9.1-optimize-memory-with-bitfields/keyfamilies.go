@@ -0,0 +1,44 @@
+package main
+
+import "time"
+
+// keySchemas is the registry of every key families of this lesson
+var keySchemas = NewKeyRegistry()
+
+var (
+	// KeyBallot is the packed array of vote states, 2 bits per citizen
+	KeyBallot = keySchemas.Register(&KeyFamily{
+		Name:             "ballot",
+		Pattern:          "ballot",
+		ValueType:        KeyValueBitmap,
+		DefaultTTL:       0,
+		EvictionCritical: true,
+		Version:          1,
+	})
+	// KeyVoteTally is the hash of vote counters, the fields are yes, no, abstain and turnout
+	KeyVoteTally = keySchemas.Register(&KeyFamily{
+		Name:             "vote_tally",
+		Pattern:          "tally::vote",
+		ValueType:        KeyValueHash,
+		DefaultTTL:       0,
+		EvictionCritical: true,
+		Version:          1,
+	})
+	// KeyVoteResults is the JSON of vote results that is read from the tally
+	KeyVoteResults = keySchemas.Register(&KeyFamily{
+		Name:       "vote_results",
+		Pattern:    "results::vote",
+		ValueType:  KeyValueJSON,
+		DefaultTTL: 2 * time.Second,
+		Version:    1,
+	})
+	// KeyAutonumber is the running number of cacher.Autonumber
+	KeyAutonumber = keySchemas.Register(&KeyFamily{
+		Name:             "autonumber",
+		Pattern:          "autonumber_{name}",
+		ValueType:        KeyValueCounter,
+		DefaultTTL:       0,
+		EvictionCritical: true,
+		Version:          1,
+	})
+)
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -36,8 +37,8 @@ func main() {
 		}
 
 		// worldCitizenID has value between 0 - 2,000,000,000
-		// each world citizen can vote yes or no
-		// so we will use 2,000,000,000 bits
+		// each world citizen has one of 4 vote states (none, yes, no, abstain)
+		// so we will use 2 bits per citizen, 4,000,000,000 bits in total
 		citizenIDStr, ok := payload["world_citizen_id"].(string)
 		if !ok {
 			ctx.Response(http.StatusOK, map[string]interface{}{"status": "invalid input"})
@@ -52,15 +53,26 @@ func main() {
 			return nil
 		}
 
-		// vote value (yes/no)
-		voteYes := false
-		voteStr, ok := payload["vote"].(string)
-		if ok && voteStr == "yes" {
-			voteYes = true
+		// vote value (yes/no/abstain)
+		voteStr, _ := payload["vote"].(string)
+		state, err := ParseVoteState(voteStr)
+		if err != nil {
+			ctx.Response(http.StatusOK, map[string]interface{}{
+				"status": "invalid input",
+				"error":  err.Error(),
+			})
+			return nil
 		}
 
-		_, err = vote(ctx, cfg, cititzenID, voteYes)
-		if err != nil {
+		prev, changed, err := vote(ctx, cfg, cititzenID, state)
+		if errors.Is(err, ErrAlreadyVoted) {
+			ctx.Response(http.StatusConflict, map[string]interface{}{
+				"status":     "already voted",
+				"citizen_id": cititzenID,
+				"previous":   prev.String(),
+			})
+			return nil
+		} else if err != nil {
 			ctx.Response(http.StatusInternalServerError, map[string]interface{}{
 				"status": "error",
 				"error":  err.Error(),
@@ -72,6 +84,54 @@ func main() {
 			"status":     "ok",
 			"citizen_id": cititzenID,
 			"vote":       voteStr,
+			"previous":   prev.String(),
+			"changed":    changed,
+		}
+		ctx.Response(http.StatusOK, resp)
+		return nil
+	})
+
+	// 4. GET vote results, the results are read from the tally of ballot and cached for 2 seconds
+	ms.GET("/vote/results", func(ctx IContext) error {
+		cacher := ctx.Cacher(cfg.CacherConfig())
+		cacheKey := KeyVoteResults.MustKey()
+		cacheTimeout := KeyVoteResults.DefaultTTL
+
+		results := &VoteResults{}
+		resultsJS, err := cacher.Get(cacheKey)
+		if err != nil {
+			ctx.Log(err.Error())
+		}
+
+		if len(resultsJS) > 0 {
+			err = json.Unmarshal([]byte(resultsJS), results)
+			if err != nil {
+				ctx.Log(err.Error())
+				resultsJS = ""
+			}
+		}
+
+		if len(resultsJS) == 0 {
+			results, err = countVotes(cfg, cacher)
+			if err != nil {
+				ctx.Response(http.StatusInternalServerError, map[string]interface{}{
+					"status": "error",
+					"error":  err.Error(),
+				})
+				return nil
+			}
+			err = cacher.Set(cacheKey, results, cacheTimeout)
+			if err != nil {
+				ctx.Log(err.Error())
+			}
+		}
+
+		resp := map[string]interface{}{
+			"status":  "ok",
+			"yes":     results.Yes,
+			"no":      results.No,
+			"abstain": results.Abstain,
+			"turnout": results.Turnout,
 		}
 		ctx.Response(http.StatusOK, resp)
 		return nil
@@ -82,18 +142,21 @@ func main() {
 	ms.Start()
 }
 
-func vote(ctx IContext, cfg IConfig, citizenID int, voteYes bool) (int /*prev value*/, error) {
+func vote(ctx IContext, cfg IConfig, citizenID int, state VoteState) (VoteState /*prev state*/, bool /*changed*/, error) {
 	cacher := ctx.Cacher(cfg.CacherConfig())
-	cacheKey := "vote"
+	ballot, err := NewBallot(cacher, cfg.RevoteRule())
+	if err != nil {
+		return VoteNone, false, err
+	}
+	// citizenID is the position in ballot, 2 bits per citizen because none|yes|no|abstain use 2 bits
+	return ballot.Vote(citizenID, state)
+}
 
-	voteVal := 0
-	if voteYes {
-		voteVal = 1
+// countVotes return the tally of ballot, it is updated with the vote so it does not need to count the bits
+func countVotes(cfg IConfig, cacher ICacher) (*VoteResults, error) {
+	ballot, err := NewBallot(cacher, cfg.RevoteRule())
+	if err != nil {
+		return nil, err
 	}
-	val, err := cacher.BitFieldSet(
-		cacheKey,
-		1,         // 1 bit because 0|1 only use 1 bit
-		citizenID, // the position in bitfield
-		voteVal)
-	return int(val), err
+	return ballot.Tally()
 }
@@ -12,3 +12,11 @@ type Member struct {
 func (*Member) TableName() string {
 	return "members"
 }
+
+// VoteResults is the number of yes, no, abstain and citizens who voted
+type VoteResults struct {
+	Yes     int64 `json:"yes"`
+	No      int64 `json:"no"`
+	Abstain int64 `json:"abstain"`
+	Turnout int64 `json:"turnout"`
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+// ErrPackedArrayOverflow is returned when Set or Incr overflow with BitFieldOverflowTypeFail
+var ErrPackedArrayOverflow = errors.New("packed array: overflow")
+
+const (
+	// defaultPackedBitsPerKey is 8MB per key, redis string can be 512MB but the big key block redis
+	// while it is deleted or migrated, so the array is split into keys of 8MB
+	defaultPackedBitsPerKey = 8 * 1024 * 1024 * 8
+	// defaultPackedChunkSize is the max number of commands in one BITFIELD call
+	defaultPackedChunkSize = 500
+)
+
+// PackedArray is the array of integers with fixed width that are packed into redis strings by BITFIELD,
+// item i is at position #i of width, eg. the array of u2 keep 4 items per byte.
+// The array is split into keys <key>:0, <key>:1, ... each keep ItemsPerKey items
+type PackedArray struct {
+	cacher      ICacher
+	key         string
+	width       int
+	signed      bool
+	overflow    BitFieldOverflowType
+	itemsPerKey int
+	chunkSize   int
+}
+
+// PackedUpdate is the update of one item in BulkUpdate, Incr is true to add Value instead of set it
+type PackedUpdate struct {
+	Index int
+	Value int64
+	Incr  bool
+}
+
+// NewPackedArray return array of width bits integers on key, signed width can be 1-64 and unsigned width can be 1-63,
+// overflow is how Set and Incr handle the value that does not fit in width (WRAP, SAT or FAIL)
+func NewPackedArray(
+	cacher ICacher,
+	key string,
+	width int,
+	signed bool,
+	overflow BitFieldOverflowType) (*PackedArray, error) {
+
+	maxWidth := 63
+	if signed {
+		maxWidth = 64
+	}
+	if width < 1 || width > maxWidth {
+		return nil, fmt.Errorf("packed array: width must be 1-%d, got %d", maxWidth, width)
+	}
+	switch overflow {
+	case BitFieldOverflowTypeWrap, BitFieldOverflowTypeSat, BitFieldOverflowTypeFail:
+	default:
+		return nil, fmt.Errorf("packed array: invalid overflow %s", overflow)
+	}
+
+	return &PackedArray{
+		cacher:      cacher,
+		key:         key,
+		width:       width,
+		signed:      signed,
+		overflow:    overflow,
+		itemsPerKey: defaultPackedBitsPerKey / width,
+		chunkSize:   defaultPackedChunkSize,
+	}, nil
+}
+
+// SetItemsPerKey set number of items in each key, it must be the same for every writers and readers of array
+func (arr *PackedArray) SetItemsPerKey(itemsPerKey int) *PackedArray {
+	if itemsPerKey > 0 {
+		arr.itemsPerKey = itemsPerKey
+	}
+	return arr
+}
+
+// SetChunkSize set max number of commands in one BITFIELD call of GetRange and BulkUpdate
+func (arr *PackedArray) SetChunkSize(chunkSize int) *PackedArray {
+	if chunkSize > 0 {
+		arr.chunkSize = chunkSize
+	}
+	return arr
+}
+
+// KeyOf return the key and the position in key of item i
+func (arr *PackedArray) KeyOf(i int) (string, int) {
+	return fmt.Sprintf("%s:%d", arr.key, i/arr.itemsPerKey), i % arr.itemsPerKey
+}
+
+// Keys return every keys of array that has n items
+func (arr *PackedArray) Keys(n int) []string {
+	keys := []string{}
+	for i := 0; i < n; i += arr.itemsPerKey {
+		key, _ := arr.KeyOf(i)
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (arr *PackedArray) newCmd(cmdType BitFieldCmdType, position int, value int64) *BitFieldCmd {
+	return &BitFieldCmd{
+		CmdType:      cmdType,
+		ByteSize:     arr.width,
+		Sign:         arr.signed,
+		ItemPosition: position,
+		Value:        value,
+	}
+}
+
+func (arr *PackedArray) overflowCmd() *BitFieldCmd {
+	return &BitFieldCmd{
+		CmdType:      BitFieldCmdTypeOverflow,
+		OverflowType: arr.overflow,
+	}
+}
+
+func (arr *PackedArray) checkIndex(i int) error {
+	if i < 0 {
+		return fmt.Errorf("packed array: index %d is out of range", i)
+	}
+	return nil
+}
+
+// bitfield run cmds on key, the nil result of overflow FAIL is returned as ErrPackedArrayOverflow
+func (arr *PackedArray) bitfield(key string, cmds []*BitFieldCmd) ([]int64, error) {
+	res, err := arr.cacher.BitField(key, cmds)
+	if err == redis.Nil {
+		return nil, ErrPackedArrayOverflow
+	}
+	return res, err
+}
+
+// Get return item i, the item that is never set is 0
+func (arr *PackedArray) Get(i int) (int64, error) {
+	if err := arr.checkIndex(i); err != nil {
+		return 0, err
+	}
+	key, position := arr.KeyOf(i)
+	res, err := arr.bitfield(key, []*BitFieldCmd{arr.newCmd(BitFieldCmdTypeGet, position, 0)})
+	if err != nil {
+		return 0, err
+	}
+	return res[0], nil
+}
+
+// Set set item i to v and return the previous value
+func (arr *PackedArray) Set(i int, v int64) (int64, error) {
+	if err := arr.checkIndex(i); err != nil {
+		return 0, err
+	}
+	key, position := arr.KeyOf(i)
+	res, err := arr.bitfield(key, []*BitFieldCmd{arr.overflowCmd(), arr.newCmd(BitFieldCmdTypeSet, position, v)})
+	if err != nil {
+		return 0, err
+	}
+	return res[0], nil
+}
+
+// Incr add d to item i and return the new value
+func (arr *PackedArray) Incr(i int, d int64) (int64, error) {
+	if err := arr.checkIndex(i); err != nil {
+		return 0, err
+	}
+	key, position := arr.KeyOf(i)
+	res, err := arr.bitfield(key, []*BitFieldCmd{arr.overflowCmd(), arr.newCmd(BitFieldCmdTypeIncrBy, position, d)})
+	if err != nil {
+		return 0, err
+	}
+	return res[0], nil
+}
+
+// GetRange return items from (include) to (exclude), the items are read by chunks of ChunkSize items per BITFIELD
+func (arr *PackedArray) GetRange(from int, to int) ([]int64, error) {
+	if err := arr.checkIndex(from); err != nil {
+		return nil, err
+	}
+	if to <= from {
+		return []int64{}, nil
+	}
+
+	values := make([]int64, 0, to-from)
+	for i := from; i < to; {
+		key, position := arr.KeyOf(i)
+		// The chunk end at chunkSize items or at the end of key
+		n := arr.chunkSize
+		if n > to-i {
+			n = to - i
+		}
+		if n > arr.itemsPerKey-position {
+			n = arr.itemsPerKey - position
+		}
+
+		cmds := make([]*BitFieldCmd, 0, n)
+		for j := 0; j < n; j++ {
+			cmds = append(cmds, arr.newCmd(BitFieldCmdTypeGet, position+j, 0))
+		}
+		res, err := arr.bitfield(key, cmds)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, res...)
+		i += n
+	}
+	return values, nil
+}
+
+// BulkUpdate set or incr many items, the updates are grouped by key and sent in chunks of ChunkSize commands,
+// the updates of the same key are run in the same order. With overflow FAIL the other updates in chunk are still applied
+func (arr *PackedArray) BulkUpdate(updates []*PackedUpdate) error {
+	keys := []string{}
+	keyCmds := map[string][]*BitFieldCmd{}
+	for _, update := range updates {
+		if err := arr.checkIndex(update.Index); err != nil {
+			return err
+		}
+		key, position := arr.KeyOf(update.Index)
+		cmdType := BitFieldCmdTypeSet
+		if update.Incr {
+			cmdType = BitFieldCmdTypeIncrBy
+		}
+		if _, ok := keyCmds[key]; !ok {
+			keys = append(keys, key)
+		}
+		keyCmds[key] = append(keyCmds[key], arr.newCmd(cmdType, position, update.Value))
+	}
+
+	var lastErr error
+	for _, key := range keys {
+		cmds := keyCmds[key]
+		for start := 0; start < len(cmds); start += arr.chunkSize {
+			end := start + arr.chunkSize
+			if end > len(cmds) {
+				end = len(cmds)
+			}
+			chunk := append([]*BitFieldCmd{arr.overflowCmd()}, cmds[start:end]...)
+			_, err := arr.bitfield(key, chunk)
+			if err != nil {
+				lastErr = err
+			}
+		}
+	}
+	return lastErr
+}
@@ -0,0 +1,151 @@
+package main
+
+import "testing"
+
+func TestNewPackedArrayWidth(t *testing.T) {
+	tests := []struct {
+		name     string
+		width    int
+		signed   bool
+		overflow BitFieldOverflowType
+		wantErr  bool
+	}{
+		{"u1", 1, false, BitFieldOverflowTypeWrap, false},
+		{"u2", 2, false, BitFieldOverflowTypeSat, false},
+		{"u63", 63, false, BitFieldOverflowTypeFail, false},
+		{"u64 is not supported by redis", 64, false, BitFieldOverflowTypeWrap, true},
+		{"i1", 1, true, BitFieldOverflowTypeWrap, false},
+		{"i64", 64, true, BitFieldOverflowTypeWrap, false},
+		{"i65", 65, true, BitFieldOverflowTypeWrap, true},
+		{"zero width", 0, false, BitFieldOverflowTypeWrap, true},
+		{"negative width", -1, true, BitFieldOverflowTypeWrap, true},
+		{"invalid overflow", 8, false, BitFieldOverflowType("CLAMP"), true},
+		{"empty overflow", 8, false, BitFieldOverflowType(""), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arr, err := NewPackedArray(nil, "arr", tt.width, tt.signed, tt.overflow)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewPackedArray(%d, %v, %s) error = %v, wantErr %v", tt.width, tt.signed, tt.overflow, err, tt.wantErr)
+			}
+			if err == nil && arr.itemsPerKey != defaultPackedBitsPerKey/tt.width {
+				t.Errorf("itemsPerKey = %d, want %d", arr.itemsPerKey, defaultPackedBitsPerKey/tt.width)
+			}
+		})
+	}
+}
+
+func TestPackedArrayKeyOf(t *testing.T) {
+	tests := []struct {
+		name         string
+		width        int
+		itemsPerKey  int
+		index        int
+		wantKey      string
+		wantPosition int
+	}{
+		{"first item", 2, 0, 0, "ballot:0", 0},
+		{"last item of first key", 2, 0, defaultPackedBitsPerKey/2 - 1, "ballot:0", defaultPackedBitsPerKey/2 - 1},
+		{"first item of second key", 2, 0, defaultPackedBitsPerKey / 2, "ballot:1", 0},
+		{"u16 has less items per key", 16, 0, defaultPackedBitsPerKey / 16, "ballot:1", 0},
+		{"custom items per key", 2, 10, 9, "ballot:0", 9},
+		{"custom items per key next key", 2, 10, 10, "ballot:1", 0},
+		{"custom items per key far key", 2, 10, 305, "ballot:30", 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arr, err := NewPackedArray(nil, "ballot", tt.width, false, BitFieldOverflowTypeSat)
+			if err != nil {
+				t.Fatal(err)
+			}
+			arr.SetItemsPerKey(tt.itemsPerKey)
+			key, position := arr.KeyOf(tt.index)
+			if key != tt.wantKey || position != tt.wantPosition {
+				t.Errorf("KeyOf(%d) = %s, %d, want %s, %d", tt.index, key, position, tt.wantKey, tt.wantPosition)
+			}
+		})
+	}
+}
+
+func TestPackedArrayKeys(t *testing.T) {
+	tests := []struct {
+		n    int
+		want []string
+	}{
+		{0, []string{}},
+		{1, []string{"arr:0"}},
+		{10, []string{"arr:0"}},
+		{11, []string{"arr:0", "arr:1"}},
+		{30, []string{"arr:0", "arr:1", "arr:2"}},
+	}
+	arr, err := NewPackedArray(nil, "arr", 4, false, BitFieldOverflowTypeWrap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	arr.SetItemsPerKey(10)
+	for _, tt := range tests {
+		got := arr.Keys(tt.n)
+		if len(got) != len(tt.want) {
+			t.Errorf("Keys(%d) = %v, want %v", tt.n, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Keys(%d) = %v, want %v", tt.n, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestPackedArraySetters(t *testing.T) {
+	arr, err := NewPackedArray(nil, "arr", 8, true, BitFieldOverflowTypeFail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The value <= 0 keep the current value
+	arr.SetItemsPerKey(0).SetChunkSize(-1)
+	if arr.itemsPerKey != defaultPackedBitsPerKey/8 || arr.chunkSize != defaultPackedChunkSize {
+		t.Errorf("itemsPerKey, chunkSize = %d, %d, want defaults", arr.itemsPerKey, arr.chunkSize)
+	}
+	arr.SetItemsPerKey(100).SetChunkSize(10)
+	if arr.itemsPerKey != 100 || arr.chunkSize != 10 {
+		t.Errorf("itemsPerKey, chunkSize = %d, %d, want 100, 10", arr.itemsPerKey, arr.chunkSize)
+	}
+}
+
+func TestPackedArrayCheckIndex(t *testing.T) {
+	arr, err := NewPackedArray(nil, "arr", 1, false, BitFieldOverflowTypeWrap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		index   int
+		wantErr bool
+	}{
+		{0, false},
+		{defaultPackedBitsPerKey * 3, false},
+		{-1, true},
+	}
+	for _, tt := range tests {
+		if err := arr.checkIndex(tt.index); (err != nil) != tt.wantErr {
+			t.Errorf("checkIndex(%d) error = %v, wantErr %v", tt.index, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPackedArrayNewCmd(t *testing.T) {
+	arr, err := NewPackedArray(nil, "arr", 12, true, BitFieldOverflowTypeSat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := arr.newCmd(BitFieldCmdTypeIncrBy, 7, -3)
+	if cmd.CmdType != BitFieldCmdTypeIncrBy || cmd.ByteSize != 12 || !cmd.Sign || cmd.ItemPosition != 7 || cmd.Value != int64(-3) {
+		t.Errorf("newCmd = %+v, want INCRBY i12 #7 -3", cmd)
+	}
+	overflow := arr.overflowCmd()
+	if overflow.CmdType != BitFieldCmdTypeOverflow || overflow.OverflowType != BitFieldOverflowTypeSat {
+		t.Errorf("overflowCmd = %+v, want OVERFLOW SAT", overflow)
+	}
+}
@@ -2,7 +2,7 @@ package main
 
 func setup(cfg IConfig) error {
 
-	// Clear all caches
+	// Clear all caches in the namespace of this service, Keys and Del use KeyPrefix of config
 	cacher := NewCacher(cfg.CacherConfig())
 	allKeys, err := cacher.Keys("*")
 	if err != nil {
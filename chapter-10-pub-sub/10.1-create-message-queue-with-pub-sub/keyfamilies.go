@@ -0,0 +1,35 @@
+package main
+
+import "time"
+
+// keySchemas is the registry of every key families of this lesson
+var keySchemas = NewKeyRegistry()
+
+var (
+	// KeyRegister is the member that is registered by username, it is used to check the duplicated username
+	KeyRegister = keySchemas.Register(&KeyFamily{
+		Name:             "register",
+		Pattern:          "register::{username}",
+		ValueType:        KeyValueJSON,
+		DefaultTTL:       0,
+		EvictionCritical: true,
+		Version:          1,
+	})
+	// KeyTransaction is the counter of workers that receive the transaction, only the first worker handle it
+	KeyTransaction = keySchemas.Register(&KeyFamily{
+		Name:       "transaction",
+		Pattern:    "transaction::{id}",
+		ValueType:  KeyValueCounter,
+		DefaultTTL: 60 * time.Second,
+		Version:    1,
+	})
+	// KeyAutonumber is the running number of cacher.Autonumber
+	KeyAutonumber = keySchemas.Register(&KeyFamily{
+		Name:             "autonumber",
+		Pattern:          "autonumber_{name}",
+		ValueType:        KeyValueCounter,
+		DefaultTTL:       0,
+		EvictionCritical: true,
+		Version:          1,
+	})
+)
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// KeyValueType is the type of value that is stored in the key family
+type KeyValueType string
+
+const (
+	// KeyValueString is the string value (SET, GET)
+	KeyValueString KeyValueType = "string"
+	// KeyValueJSON is the JSON string value (Set, Get of cacher)
+	KeyValueJSON KeyValueType = "json"
+	// KeyValueHash is the hash value (HSET, HGET)
+	KeyValueHash KeyValueType = "hash"
+	// KeyValueCounter is the integer value (INCR, DECR)
+	KeyValueCounter KeyValueType = "counter"
+	// KeyValueBitmap is the bitmap value (SETBIT, BITFIELD)
+	KeyValueBitmap KeyValueType = "bitmap"
+	// KeyValueSet is the set value (SADD, SMEMBERS)
+	KeyValueSet KeyValueType = "set"
+	// KeyValueSortedSet is the sorted set value (ZADD, ZRANGEBYSCORE)
+	KeyValueSortedSet KeyValueType = "zset"
+)
+
+// KeyFamily is the declaration of keys that have the same format, eg. user::{username}
+type KeyFamily struct {
+	// Name is the unique name of family
+	Name string
+	// Pattern is the format of key, the parameter is in {}, eg. user::{username}
+	Pattern string
+	// ValueType is the type of value
+	ValueType KeyValueType
+	// DefaultTTL is the expire of key, 0 means no expire
+	DefaultTTL time.Duration
+	// EvictionCritical is true if the key cannot be loaded again from database when it is evicted,
+	// eg. counter and autonumber, so maxmemory-policy must not evict them (use volatile-* policy without expire)
+	EvictionCritical bool
+	// Version is the schema version of value, the key of version > 1 has suffix :v<version>,
+	// so the value of old schema is not read after the version is bumped
+	Version int
+
+	params []string
+	regex  *regexp.Regexp
+}
+
+var keyParamRegex = regexp.MustCompile(`\{(\w+)\}`)
+
+// compile parse the parameters of pattern, and create regex to parse the key
+func (family *KeyFamily) compile() {
+	family.params = nil
+	expr := "^"
+	last := 0
+	for _, match := range keyParamRegex.FindAllStringSubmatchIndex(family.Pattern, -1) {
+		expr += regexp.QuoteMeta(family.Pattern[last:match[0]]) + "(.+?)"
+		family.params = append(family.params, family.Pattern[match[2]:match[3]])
+		last = match[1]
+	}
+	expr += regexp.QuoteMeta(family.Pattern[last:]) + regexp.QuoteMeta(family.versionSuffix()) + "$"
+	family.regex = regexp.MustCompile(expr)
+}
+
+func (family *KeyFamily) versionSuffix() string {
+	if family.Version <= 1 {
+		return ""
+	}
+	return fmt.Sprintf(":v%d", family.Version)
+}
+
+// Key return the key of family, params are in the same order as in the pattern,
+// it return error if the number of params is not the same as in the pattern
+func (family *KeyFamily) Key(params ...string) (string, error) {
+	if len(params) != len(family.params) {
+		return "", fmt.Errorf("keyschema: %s needs %d params, got %d", family.Name, len(family.params), len(params))
+	}
+	i := 0
+	key := keyParamRegex.ReplaceAllStringFunc(family.Pattern, func(string) string {
+		param := params[i]
+		i++
+		return param
+	})
+	return key + family.versionSuffix(), nil
+}
+
+// MustKey is like Key but it panics if the number of params is not the same as in the pattern,
+// it is used when the number of params is fixed in code, eg. the key helpers of lesson
+func (family *KeyFamily) MustKey(params ...string) string {
+	key, err := family.Key(params...)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// Parse return the params of key by name, ok is false if key is not in this family
+func (family *KeyFamily) Parse(key string) (params map[string]string, ok bool) {
+	matches := family.regex.FindStringSubmatch(key)
+	if matches == nil {
+		return nil, false
+	}
+	params = map[string]string{}
+	for i, name := range family.params {
+		params[name] = matches[i+1]
+	}
+	return params, true
+}
+
+// ScanPattern return the pattern to SCAN every keys of family, eg. user::*
+func (family *KeyFamily) ScanPattern() string {
+	return keyParamRegex.ReplaceAllString(family.Pattern, "*") + family.versionSuffix()
+}
+
+// KeyRegistry keep every key families, so the key formats are declared in one place
+type KeyRegistry struct {
+	mutex    sync.RWMutex
+	families []*KeyFamily
+}
+
+// NewKeyRegistry return new KeyRegistry
+func NewKeyRegistry() *KeyRegistry {
+	return &KeyRegistry{}
+}
+
+// Register add family to registry and return it, it panics if the name is already registered
+func (registry *KeyRegistry) Register(family *KeyFamily) *KeyFamily {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	for _, registered := range registry.families {
+		if registered.Name == family.Name {
+			panic(fmt.Sprintf("keyschema: %s is already registered", family.Name))
+		}
+	}
+	family.compile()
+	registry.families = append(registry.families, family)
+	return family
+}
+
+// Families return every families in the registered order
+func (registry *KeyRegistry) Families() []*KeyFamily {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	families := make([]*KeyFamily, len(registry.families))
+	copy(families, registry.families)
+	return families
+}
+
+// Match return the family of key and its params, or nil if key is not in any families
+func (registry *KeyRegistry) Match(key string) (*KeyFamily, map[string]string) {
+	for _, family := range registry.Families() {
+		if params, ok := family.Parse(key); ok {
+			return family, params
+		}
+	}
+	return nil, nil
+}
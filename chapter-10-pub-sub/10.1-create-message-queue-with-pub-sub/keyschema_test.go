@@ -0,0 +1,178 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func newTestFamily(pattern string, version int) *KeyFamily {
+	registry := NewKeyRegistry()
+	return registry.Register(&KeyFamily{
+		Name:      "test",
+		Pattern:   pattern,
+		ValueType: KeyValueString,
+		Version:   version,
+	})
+}
+
+func TestKeyFamilyKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		version int
+		params  []string
+		want    string
+		wantErr bool
+	}{
+		{"one param", "user::{username}", 1, []string{"alice"}, "user::alice", false},
+		{"two params", "order::{shop}::{id}", 1, []string{"s1", "42"}, "order::s1::42", false},
+		{"no param", "members::latest", 1, nil, "members::latest", false},
+		{"version suffix", "user::{username}", 2, []string{"alice"}, "user::alice:v2", false},
+		{"version 0 has no suffix", "user::{username}", 0, []string{"alice"}, "user::alice", false},
+		{"too few params", "order::{shop}::{id}", 1, []string{"s1"}, "", true},
+		{"too many params", "user::{username}", 1, []string{"alice", "bob"}, "", true},
+		{"params for no param", "members::latest", 1, []string{"x"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			family := newTestFamily(tt.pattern, tt.version)
+			got, err := family.Key(tt.params...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Key(%v) error = %v, wantErr %v", tt.params, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Key(%v) = %q, want %q", tt.params, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyFamilyParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		version int
+		key     string
+		want    map[string]string
+		wantOK  bool
+	}{
+		{"one param", "user::{username}", 1, "user::alice", map[string]string{"username": "alice"}, true},
+		{"param with separator", "user::{username}", 1, "user::a::b", map[string]string{"username": "a::b"}, true},
+		{"two params", "order::{shop}::{id}", 1, "order::s1::42", map[string]string{"shop": "s1", "id": "42"}, true},
+		{"version suffix", "user::{username}", 2, "user::alice:v2", map[string]string{"username": "alice"}, true},
+		{"old version", "user::{username}", 2, "user::alice", nil, false},
+		{"other family", "user::{username}", 1, "register::alice", nil, false},
+		{"empty param", "user::{username}", 1, "user::", nil, false},
+		// The regex is quoted, so . in pattern is not any character
+		{"quoted pattern", "a.b::{id}", 1, "axb::1", nil, false},
+		{"no param", "members::latest", 1, "members::latest", map[string]string{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			family := newTestFamily(tt.pattern, tt.version)
+			got, ok := family.Parse(tt.key)
+			if ok != tt.wantOK {
+				t.Fatalf("Parse(%q) ok = %v, want %v", tt.key, ok, tt.wantOK)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Parse(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+			for name, value := range tt.want {
+				if got[name] != value {
+					t.Errorf("Parse(%q)[%s] = %q, want %q", tt.key, name, got[name], value)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyFamilyKeyParseRoundTrip(t *testing.T) {
+	family := newTestFamily("order::{shop}::{id}", 3)
+	key, err := family.Key("shop_1", "1001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params, ok := family.Parse(key)
+	if !ok || params["shop"] != "shop_1" || params["id"] != "1001" {
+		t.Errorf("Parse(%q) = %v, %v, want shop_1 and 1001", key, params, ok)
+	}
+}
+
+func TestKeyFamilyScanPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		version int
+		want    string
+	}{
+		{"user::{username}", 1, "user::*"},
+		{"order::{shop}::{id}", 1, "order::*::*"},
+		{"user::{username}", 2, "user::*:v2"},
+		{"members::latest", 1, "members::latest"},
+	}
+	for _, tt := range tests {
+		if got := newTestFamily(tt.pattern, tt.version).ScanPattern(); got != tt.want {
+			t.Errorf("ScanPattern of %s v%d = %q, want %q", tt.pattern, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestKeyFamilyMustKey(t *testing.T) {
+	family := newTestFamily("order::{shop}::{id}", 1)
+	if got := family.MustKey("s1", "42"); got != "order::s1::42" {
+		t.Errorf("MustKey = %q, want order::s1::42", got)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("MustKey with too few params does not panic")
+		}
+	}()
+	family.MustKey("s1")
+}
+
+func TestKeyRegistryMatch(t *testing.T) {
+	registry := NewKeyRegistry()
+	member := registry.Register(&KeyFamily{Name: "member", Pattern: "user::{username}"})
+	latest := registry.Register(&KeyFamily{Name: "latest", Pattern: "members::latest"})
+	autonumber := registry.Register(&KeyFamily{Name: "autonumber", Pattern: "autonumber_{name}"})
+	tests := []struct {
+		key    string
+		family *KeyFamily
+	}{
+		{"user::alice", member},
+		{"members::latest", latest},
+		{"autonumber_members", autonumber},
+		{"unknown::key", nil},
+	}
+	for _, tt := range tests {
+		family, _ := registry.Match(tt.key)
+		if family != tt.family {
+			t.Errorf("Match(%q) = %v, want %v", tt.key, family, tt.family)
+		}
+	}
+}
+
+// TestKeySchemas check that the key of every families of this lesson is matched to its own family,
+// so the families do not overlap
+func TestKeySchemas(t *testing.T) {
+	for _, family := range keySchemas.Families() {
+		params := make([]string, len(family.params))
+		for i := range params {
+			params[i] = "p" + strconv.Itoa(i)
+		}
+		key := family.MustKey(params...)
+		if matched, _ := keySchemas.Match(key); matched != family {
+			t.Errorf("Match(%q) = %v, want %s", key, matched, family.Name)
+		}
+	}
+}
+
+func TestKeyRegistryRegisterDuplicated(t *testing.T) {
+	registry := NewKeyRegistry()
+	registry.Register(&KeyFamily{Name: "dup", Pattern: "a::{id}"})
+	defer func() {
+		if recover() == nil {
+			t.Error("Register the same name again does not panic")
+		}
+	}()
+	registry.Register(&KeyFamily{Name: "dup", Pattern: "b::{id}"})
+}
@@ -7,7 +7,6 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	_ "github.com/3dsinteractive/wrkgo"
 )
@@ -164,13 +163,13 @@ type RegisterPayload struct {
 }
 
 func isSelectedWorker(cacher ICacher, transactionID string) (bool, error) {
-	cacheKey := fmt.Sprintf("transaction::%s", transactionID)
+	cacheKey := KeyTransaction.MustKey(transactionID)
 	id, err := cacher.Incr(cacheKey)
 	if err != nil {
 		return false, err
 	}
 	// Expire key in 60 seconds after use
-	cacher.Expire(cacheKey, 60*time.Second)
+	cacher.Expire(cacheKey, KeyTransaction.DefaultTTL)
 	// only first worker that call this function will get id == 1,
 	// if the worker get the id == 1, so it is the selected worker
 	if id == 1 {
@@ -219,5 +218,5 @@ func nextRegisterOrder(cacher ICacher) (int, error) {
 }
 
 func getRegisterCacheKey(username string) string {
-	return fmt.Sprintf("register::%s", username)
+	return KeyRegister.MustKey(username)
 }
@@ -4,9 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	redis "github.com/go-redis/redis/v8"
@@ -40,6 +40,9 @@ type ICacher interface {
 	SetS(key string, value string, expire time.Duration) error
 	SetNoExpire(key string, value interface{}) error
 	SetSNoExpire(key string, value string) error
+	// SetWithTags set value and add key to tags, InvalidateTags delete every keys of tags
+	SetWithTags(key string, value interface{}, expire time.Duration, tags ...string) error
+	InvalidateTags(tags ...string) ([]string /*deleted keys*/, error)
 	IncrBy(key string, val int) (int, error)
 	DecrBy(key string, val int) (int, error)
 	Incr(key string) (int, error)
@@ -53,8 +56,13 @@ type ICacher interface {
 	Exists(key string) (bool, error)
 
 	Pub(channel string, message interface{}) error
-	Sub(channels ...string) (<-chan *redis.Message, string /*subID used for close*/, error)
-	Unsub(subID string) error
+	// Sub and PSub return subscription that is subscribed again when the connection is broken, close with sub.Close()
+	Sub(channels ...string) (*Subscription, error)
+	PSub(patterns ...string) (*Subscription, error)
+	// DroppedMessages return the number of messages dropped because subscribers are too slow
+	DroppedMessages() int64
+	// OnKeyEvent call handler when the key that match patterns got the events, close with sub.Close()
+	OnKeyEvent(patterns []string, eventTypes []KeyEventType, handler func(event *KeyEvent)) (*Subscription, error)
 
 	Close() error
 
@@ -65,9 +73,15 @@ type ICacher interface {
 // ICacherConfig is cacher configuration interface
 type ICacherConfig interface {
 	Endpoint() string
+	// MasterName is the name of master monitored by sentinels, if not empty, cacher use sentinel failover client
+	MasterName() string
+	SentinelEndpoints() []string
 	Password() string
 	DB() int
 	ConnectionSettings() ICacherConnectionSettings
+	// KeyPrefix is the namespace of service, it is added to every keys and channels, eg. lesson10.2:
+	// the keyspace notifications channels are not prefixed, their keys are
+	KeyPrefix() string
 }
 
 // ICacherConnectionSettings is connection settings for cacher
@@ -82,6 +96,10 @@ type ICacherConnectionSettings interface {
 	PoolTimeout() time.Duration
 	ReadTimeout() time.Duration
 	WriteTimeout() time.Duration
+	// SubBufferSize is the number of messages buffered for each subscription
+	SubBufferSize() int
+	// SubSlowConsumerPolicy is what subscription do when the buffer is full
+	SubSlowConsumerPolicy() SlowConsumerPolicy
 }
 
 // DefaultCacherConnectionSettings contains default connection settings, this intend to use as embed struct
@@ -131,9 +149,12 @@ func (setting *DefaultCacherConnectionSettings) WriteTimeout() time.Duration {
 	return time.Minute
 }
 
-type pubsubChannels struct {
-	ps       *redis.PubSub
-	channels []string
+func (setting *DefaultCacherConnectionSettings) SubBufferSize() int {
+	return 100
+}
+
+func (setting *DefaultCacherConnectionSettings) SubSlowConsumerPolicy() SlowConsumerPolicy {
+	return SlowConsumerBlock
 }
 
 // Cacher is the struct for cache service
@@ -141,16 +162,18 @@ type Cacher struct {
 	config      ICacherConfig
 	clientMutex sync.Mutex
 	client      *redis.Client
-	oldClients  []*redis.Client
-	subsribers  *sync.Map
-	serviceID   int
+	// subClient is the client of every subscriptions, it is never renewed,
+	// redis.PubSub reconnect and subscribe again by itself
+	subClient  *redis.Client
+	subsribers *sync.Map
+	dropped    int64
+	serviceID  int
 }
 
 // NewCacher return new Cacher
 func NewCacher(config ICacherConfig) *Cacher {
 	return &Cacher{
 		config:     config,
-		oldClients: nil,
 		subsribers: &sync.Map{},
 	}
 }
@@ -158,7 +181,29 @@ func NewCacher(config ICacherConfig) *Cacher {
 func (cache *Cacher) newClient() *redis.Client {
 	cfg := cache.config
 	settings := cfg.ConnectionSettings()
-	return redis.NewClient(&redis.Options{
+	if cache.isSentinel() {
+		// Failover client ask sentinels for the master address,
+		// and reconnect to the new master when sentinels switch master
+		client := redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:         cfg.MasterName(),
+			SentinelAddrs:      cfg.SentinelEndpoints(),
+			Password:           cfg.Password(),
+			DB:                 cfg.DB(),
+			PoolSize:           settings.PoolSize(),
+			MinIdleConns:       settings.MinIdleConns(),
+			MaxRetries:         settings.MaxRetries(),
+			MinRetryBackoff:    settings.MinRetryBackoff(),
+			MaxRetryBackoff:    settings.MaxRetryBackoff(),
+			IdleTimeout:        settings.IdleTimeout(),
+			IdleCheckFrequency: settings.IdleCheckFrequency(),
+			PoolTimeout:        settings.PoolTimeout(),
+			ReadTimeout:        settings.ReadTimeout(),
+			WriteTimeout:       settings.WriteTimeout(),
+		})
+		cache.addKeyPrefixHook(client)
+		return client
+	}
+	client := redis.NewClient(&redis.Options{
 		Addr:               cfg.Endpoint(),
 		Password:           cfg.Password(),
 		DB:                 cfg.DB(),
@@ -173,6 +218,12 @@ func (cache *Cacher) newClient() *redis.Client {
 		ReadTimeout:        settings.ReadTimeout(),
 		WriteTimeout:       settings.WriteTimeout(),
 	})
+	cache.addKeyPrefixHook(client)
+	return client
+}
+
+func (cache *Cacher) isSentinel() bool {
+	return len(cache.config.MasterName()) > 0
 }
 
 func (cache *Cacher) getClient() (*redis.Client, error) {
@@ -195,8 +246,10 @@ func (cache *Cacher) getClient() (*redis.Client, error) {
 
 		_, err := client.Ping(context.Background()).Result()
 		if err != nil {
-			// Wait by retry delay then reset client and try connect again
+			// Wait by retry delay then reset client and try connect again,
+			// the old client might still run commands of other callers, so it is closed after they are done
 			time.Sleep(time.Millisecond * time.Duration(retriesDelayMs[retries]))
+			go closeWhenDrained(client)
 			cache.client = nil
 			continue
 		}
@@ -206,11 +259,74 @@ func (cache *Cacher) getClient() (*redis.Client, error) {
 	}
 }
 
-// Close close the redis client
+const (
+	drainCheckInterval = 100 * time.Millisecond
+	drainTimeout       = 30 * time.Second
+)
+
+// closeWhenDrained close client when no connection is used by commands, or when drainTimeout is passed
+func closeWhenDrained(client *redis.Client) {
+	deadline := time.Now().Add(drainTimeout)
+	for time.Now().Before(deadline) {
+		stats := client.PoolStats()
+		if stats.TotalConns == stats.IdleConns {
+			break
+		}
+		time.Sleep(drainCheckInterval)
+	}
+
+	err := client.Close()
+	if err != nil {
+		fmt.Println("cacher:", err.Error())
+	}
+}
+
+// getSubClient return the client of subscriptions, it does not PING,
+// redis.PubSub connect when it subscribe and reconnect by itself
+func (cache *Cacher) getSubClient() *redis.Client {
+	cache.clientMutex.Lock()
+	defer cache.clientMutex.Unlock()
+
+	if cache.subClient == nil {
+		cache.subClient = cache.newClient()
+	}
+	return cache.subClient
+}
+
+// closeSubscriptions close every subscriptions, subscribers will receive nil message
+func (cache *Cacher) closeSubscriptions() {
+	cache.subsribers.Range(func(key, value interface{}) bool {
+		sub, ok := value.(*Subscription)
+		if ok {
+			err := sub.Close()
+			if err != nil {
+				fmt.Println("cacher:", err.Error())
+			}
+		}
+		cache.subsribers.Delete(key)
+		return true
+	})
+}
+
+// Close close subscriptions and the redis client
 func (cache *Cacher) Close() error {
+	// Subscriptions must be closed before the client, so they do not subscribe again
+	cache.closeSubscriptions()
+
 	cache.clientMutex.Lock()
 	defer cache.clientMutex.Unlock()
 
+	// Close the client of subscriptions
+	subClient := cache.subClient
+	if subClient != nil {
+		cache.subClient = nil
+
+		err := subClient.Close()
+		if err != nil {
+			return err
+		}
+	}
+
 	// Close current client
 	client := cache.client
 	if client != nil {
@@ -220,17 +336,6 @@ func (cache *Cacher) Close() error {
 		if err != nil {
 			return err
 		}
-
-		// Close old clients
-		for _, client := range cache.oldClients {
-			err := client.Close()
-			if err != nil {
-				return err
-			}
-		}
-		if len(cache.oldClients) > 0 {
-			cache.oldClients = nil
-		}
 	}
 
 	return nil
@@ -296,9 +401,10 @@ func (cache *Cacher) Keys(pattern string) ([]string, error) {
 
 	}
 
+	// Return keys without KeyPrefix, so they can be used with the other commands
 	retKeys := []string{}
 	for key := range allKeys {
-		retKeys = append(retKeys, key)
+		retKeys = append(retKeys, cache.unprefixKey(key))
 	}
 	return retKeys, nil
 }
@@ -1389,7 +1495,10 @@ func NewBitFieldCmdU32(cmdType BitFieldCmdType, itemPosition int, value int) *Bi
 }
 
 func (cache *Cacher) Autonumber(name string) (int, error) {
-	key := fmt.Sprintf("autonumber_%s", name)
+	key, err := KeyAutonumber.Key(name)
+	if err != nil {
+		return -1, err
+	}
 	nextNumber, err := cache.Incr(key)
 	if err != nil {
 		return -1, err
@@ -1426,54 +1535,38 @@ func (cache *Cacher) Pub(channel string, message interface{}) error {
 	}
 }
 
-// Sub subscribe to channel
-func (cache *Cacher) Sub(channels ...string) (<-chan *redis.Message /*subID (used for close)*/, string, error) {
-
-	c, err := cache.getClient()
-	if err != nil {
-		return nil, "", err
-	}
-
-	ps := c.Subscribe(context.Background(), channels...)
-	subID := NewUUID()
-
-	cache.subsribers.Store(subID, &pubsubChannels{
-		ps:       ps,
-		channels: channels,
-	})
+// Sub subscribe to channels, the subscription is subscribed again when the connection is broken
+func (cache *Cacher) Sub(channels ...string) (*Subscription, error) {
+	return cache.sub(channels, false, cache.config.KeyPrefix(), nil)
+}
 
-	return ps.Channel(), subID, nil
+// PSub subscribe to channels that match patterns (eg. channel::*), the subscription is subscribed again when the connection is broken
+func (cache *Cacher) PSub(patterns ...string) (*Subscription, error) {
+	return cache.sub(patterns, true, cache.config.KeyPrefix(), nil)
 }
 
-// Unsub will unsub subscriber
-func (cache *Cacher) Unsub(subID string) error {
-	if len(subID) == 0 {
-		return nil
-	}
+// sub create subscription owned by cacher, prefix is added to channels (or patterns) and removed from the received messages,
+// onSubscribe is called with the client before subscribe and after reconnect
+func (cache *Cacher) sub(channels []string, patterns bool, prefix string, onSubscribe func(client *redis.Client)) (*Subscription, error) {
 
-	psChannels, ok := cache.subsribers.Load(subID)
-	if !ok {
-		return nil
-	}
-	pubsubChannels, ok := psChannels.(*pubsubChannels)
-	if !ok {
-		return nil
+	// Check that redis can be connected before subscribe
+	_, err := cache.getClient()
+	if err != nil {
+		return nil, err
 	}
 
-	if pubsubChannels.ps != nil {
-		err := pubsubChannels.ps.Unsubscribe(context.Background(), pubsubChannels.channels...)
-		if err != nil {
-			_, fn, line, _ := runtime.Caller(1)
-			fmt.Println(err.Error(), fn, line)
-		}
-		err = pubsubChannels.ps.Close()
-		if err != nil {
-			_, fn, line, _ := runtime.Caller(1)
-			fmt.Println(err.Error(), fn, line)
-		}
+	sub := newSubscription(channels, patterns, prefix, cache.config.ConnectionSettings(), &cache.dropped)
+	sub.onSubscribe = onSubscribe
+	sub.onClose = func() {
+		cache.subsribers.Delete(sub.ID())
 	}
+	cache.subsribers.Store(sub.ID(), sub)
+	sub.subscribe(cache.getSubClient())
 
-	cache.subsribers.Delete(subID)
+	return sub, nil
+}
 
-	return nil
+// DroppedMessages return the number of messages dropped because subscribers are too slow
+func (cache *Cacher) DroppedMessages() int64 {
+	return atomic.LoadInt64(&cache.dropped)
 }
@@ -1,5 +1,10 @@
 package main
 
+import (
+	"fmt"
+	"strings"
+)
+
 type IConfig interface {
 	PersisterConfig() IPersisterConfig
 	CacherConfig() ICacherConfig
@@ -17,16 +22,48 @@ func (cfg *Config) PersisterConfig() IPersisterConfig {
 
 func (cfg *Config) CacherConfig() ICacherConfig {
 	return NewCacherConfig()
+
+	// Use redis sentinel, start redis and sentinels with
+	// $ docker compose -f docker-compose-sentinel.yml up -d
+	// return NewSentinelCacherConfig(
+	// 	"mymaster",
+	// 	"127.0.0.1:26379",
+	// 	"127.0.0.1:26380",
+	// 	"127.0.0.1:26381",
+	// )
 }
 
-type CacherConfig struct{}
+type CacherConfig struct {
+	endpoint          string
+	masterName        string
+	sentinelEndpoints []string
+}
 
 func NewCacherConfig() *CacherConfig {
-	return &CacherConfig{}
+	return &CacherConfig{
+		endpoint: "127.0.0.1:6379",
+	}
+}
+
+// NewSentinelCacherConfig return config of redis master monitored by sentinels
+func NewSentinelCacherConfig(masterName string, sentinelEndpoints ...string) *CacherConfig {
+	return &CacherConfig{
+		endpoint:          fmt.Sprintf("%s@%s", masterName, strings.Join(sentinelEndpoints, ",")),
+		masterName:        masterName,
+		sentinelEndpoints: sentinelEndpoints,
+	}
 }
 
 func (cfg *CacherConfig) Endpoint() string {
-	return "127.0.0.1:6379"
+	return cfg.endpoint
+}
+
+func (cfg *CacherConfig) MasterName() string {
+	return cfg.masterName
+}
+
+func (cfg *CacherConfig) SentinelEndpoints() []string {
+	return cfg.sentinelEndpoints
 }
 
 func (cfg *CacherConfig) Password() string {
@@ -37,6 +74,11 @@ func (cfg *CacherConfig) DB() int {
 	return 0
 }
 
+// KeyPrefix is the namespace of this lesson, setup() delete only the keys in this namespace
+func (cfg *CacherConfig) KeyPrefix() string {
+	return "lesson10.2:"
+}
+
 func (cfg *CacherConfig) ConnectionSettings() ICacherConnectionSettings {
 	return NewDefaultCacherConnectionSettings()
 }
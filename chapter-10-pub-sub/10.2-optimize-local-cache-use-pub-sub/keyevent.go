@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+// KeyEventType is the event name published by redis keyspace notifications
+type KeyEventType string
+
+const (
+	// KeyEventExpired is published when the key is deleted because it is expired
+	KeyEventExpired KeyEventType = "expired"
+	// KeyEventEvicted is published when the key is deleted by maxmemory policy (eg. allkeys-lru)
+	KeyEventEvicted KeyEventType = "evicted"
+	// KeyEventDel is published when the key is deleted by DEL
+	KeyEventDel KeyEventType = "del"
+	// KeyEventExpire is published when the expire of key is set
+	KeyEventExpire KeyEventType = "expire"
+	// KeyEventSet is published when the string key is set by SET
+	KeyEventSet KeyEventType = "set"
+	// KeyEventHSet is published when the field of hash key is set by HSET
+	KeyEventHSet KeyEventType = "hset"
+	// KeyEventHDel is published when the field of hash key is deleted by HDEL
+	KeyEventHDel KeyEventType = "hdel"
+)
+
+// keyEventFlags is the flag of notify-keyspace-events that enable the event
+var keyEventFlags = map[KeyEventType]string{
+	KeyEventExpired: "x",
+	KeyEventEvicted: "e",
+	KeyEventDel:     "g",
+	KeyEventExpire:  "g",
+	KeyEventSet:     "$",
+	KeyEventHSet:    "h",
+	KeyEventHDel:    "h",
+}
+
+// KeyEvent is the event of key from keyspace notifications
+type KeyEvent struct {
+	Key   string
+	Event KeyEventType
+	DB    int
+}
+
+// keyEventChannel return the channel of event in db, eg. __keyevent@0__:expired
+func keyEventChannel(db int, eventType KeyEventType) string {
+	return fmt.Sprintf("__keyevent@%d__:%s", db, eventType)
+}
+
+// parseKeyEvent return the event from message of __keyevent@<db>__:<event> channel
+func parseKeyEvent(msg *Message) (*KeyEvent, error) {
+	prefix := "__keyevent@"
+	if !strings.HasPrefix(msg.Channel, prefix) {
+		return nil, fmt.Errorf("cacher: %s is not key event channel", msg.Channel)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(msg.Channel, prefix), "__:", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("cacher: %s is not key event channel", msg.Channel)
+	}
+	db, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("cacher: %s is not key event channel", msg.Channel)
+	}
+	return &KeyEvent{
+		Key:   msg.Payload,
+		Event: KeyEventType(parts[1]),
+		DB:    db,
+	}, nil
+}
+
+// matchKeyPatterns return true if key match any pattern (glob style like KEYS), empty patterns match every keys
+func matchKeyPatterns(patterns []string, key string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matchGlob(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob match s with pattern the same way as redis KEYS and PSUBSCRIBE (stringmatchlen),
+// * match any bytes include /, ? match one byte, [abc] [^abc] [a-z] match one byte in the class,
+// \ escape the next character, and the class that is not closed match until the end of pattern
+func matchGlob(pattern string, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if matchGlob(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			matched, rest := matchGlobClass(pattern[1:], s[0])
+			if !matched {
+				return false
+			}
+			pattern = rest
+			s = s[1:]
+			continue
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+			s = s[1:]
+		}
+		pattern = pattern[1:]
+	}
+	return len(s) == 0
+}
+
+// matchGlobClass match c with the class of pattern after [, return the pattern after ]
+func matchGlobClass(pattern string, c byte) (bool, string) {
+	not := len(pattern) > 0 && pattern[0] == '^'
+	if not {
+		pattern = pattern[1:]
+	}
+	matched := false
+	for len(pattern) > 0 && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) >= 2:
+			matched = matched || pattern[1] == c
+			pattern = pattern[2:]
+		case len(pattern) >= 3 && pattern[1] == '-':
+			start, end := pattern[0], pattern[2]
+			if start > end {
+				start, end = end, start
+			}
+			matched = matched || (c >= start && c <= end)
+			pattern = pattern[3:]
+		default:
+			matched = matched || pattern[0] == c
+			pattern = pattern[1:]
+		}
+	}
+	if len(pattern) > 0 {
+		pattern = pattern[1:]
+	}
+	return matched != not, pattern
+}
+
+// mergeKeyEventFlags return flags of notify-keyspace-events that include current flags and flags of eventTypes
+func mergeKeyEventFlags(current string, eventTypes []KeyEventType) string {
+	flags := current
+	// A is alias of g$lshzxet, so every flags are already included
+	if strings.Contains(flags, "A") {
+		if !strings.Contains(flags, "E") {
+			flags += "E"
+		}
+		return flags
+	}
+	required := "E"
+	for _, eventType := range eventTypes {
+		required += keyEventFlags[eventType]
+	}
+	for _, flag := range required {
+		if !strings.ContainsRune(flags, flag) {
+			flags += string(flag)
+		}
+	}
+	return flags
+}
+
+// configKeyEvents enable notify-keyspace-events for eventTypes on client,
+// managed redis might not allow CONFIG, then the events must be enabled on the server
+func configKeyEvents(client *redis.Client, eventTypes []KeyEventType) {
+	ctx := context.Background()
+	current := ""
+	vals, err := client.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err != nil {
+		fmt.Println("cacher: cannot get notify-keyspace-events:", err.Error())
+		return
+	}
+	if len(vals) == 2 {
+		current, _ = vals[1].(string)
+	}
+
+	flags := mergeKeyEventFlags(current, eventTypes)
+	if flags == current {
+		return
+	}
+	err = client.ConfigSet(ctx, "notify-keyspace-events", flags).Err()
+	if err != nil {
+		fmt.Println("cacher: cannot set notify-keyspace-events:", err.Error())
+	}
+}
+
+// OnKeyEvent subscribe key events of cacher db and call handler when the key match patterns,
+// notify-keyspace-events is configured when subscribe (and again when cacher reconnect to new master)
+func (cache *Cacher) OnKeyEvent(patterns []string, eventTypes []KeyEventType, handler func(event *KeyEvent)) (*Subscription, error) {
+	if len(eventTypes) == 0 {
+		return nil, fmt.Errorf("cacher: event types are required")
+	}
+	for _, eventType := range eventTypes {
+		if _, ok := keyEventFlags[eventType]; !ok {
+			return nil, fmt.Errorf("cacher: unsupported key event %s", eventType)
+		}
+	}
+
+	db := cache.config.DB()
+	channels := make([]string, 0, len(eventTypes))
+	for _, eventType := range eventTypes {
+		channels = append(channels, keyEventChannel(db, eventType))
+	}
+
+	// The keyspace notifications channels are published by redis, so they are not prefixed
+	sub, err := cache.sub(channels, false, "", func(client *redis.Client) {
+		configKeyEvents(client, eventTypes)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		// messages is closed when subscription is closed
+		for msg := range sub.Messages() {
+			event, err := parseKeyEvent(msg)
+			if err != nil {
+				fmt.Println(err.Error())
+				continue
+			}
+			// The events of keys outside the namespace of this service are ignored,
+			// the key of event is without KeyPrefix like the other commands of cacher
+			prefix := cache.config.KeyPrefix()
+			if !strings.HasPrefix(event.Key, prefix) {
+				continue
+			}
+			event.Key = strings.TrimPrefix(event.Key, prefix)
+			if !matchKeyPatterns(patterns, event.Key) {
+				continue
+			}
+			handler(event)
+		}
+	}()
+
+	return sub, nil
+}
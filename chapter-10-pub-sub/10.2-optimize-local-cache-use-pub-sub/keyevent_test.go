@@ -0,0 +1,97 @@
+package main
+
+import "testing"
+
+func TestParseKeyEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		channel string
+		payload string
+		want    KeyEvent
+		wantErr bool
+	}{
+		{"expired", "__keyevent@0__:expired", "user::alice", KeyEvent{Key: "user::alice", Event: KeyEventExpired, DB: 0}, false},
+		{"other db", "__keyevent@12__:del", "a", KeyEvent{Key: "a", Event: KeyEventDel, DB: 12}, false},
+		{"key has separator", "__keyevent@0__:hset", "a__:b", KeyEvent{Key: "a__:b", Event: KeyEventHSet, DB: 0}, false},
+		{"keyspace channel", "__keyspace@0__:user::alice", "expired", KeyEvent{}, true},
+		{"no event", "__keyevent@0", "a", KeyEvent{}, true},
+		{"invalid db", "__keyevent@x__:expired", "a", KeyEvent{}, true},
+		{"other channel", "members", "a", KeyEvent{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseKeyEvent(&Message{Channel: tt.channel, Payload: tt.payload})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseKeyEvent(%q) error = %v, wantErr %v", tt.channel, err, tt.wantErr)
+			}
+			if err == nil && *got != tt.want {
+				t.Errorf("parseKeyEvent(%q) = %+v, want %+v", tt.channel, *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeKeyEventFlags(t *testing.T) {
+	tests := []struct {
+		name       string
+		current    string
+		eventTypes []KeyEventType
+		want       string
+	}{
+		{"disabled", "", []KeyEventType{KeyEventExpired}, "Ex"},
+		{"two events", "", []KeyEventType{KeyEventExpired, KeyEventEvicted}, "Exe"},
+		{"same flag of two events", "", []KeyEventType{KeyEventHSet, KeyEventHDel}, "Eh"},
+		{"keep current flags", "Kg", []KeyEventType{KeyEventSet}, "KgE$"},
+		{"already enabled", "Ex", []KeyEventType{KeyEventExpired}, "Ex"},
+		{"A include every events", "KA", []KeyEventType{KeyEventHSet}, "KAE"},
+		{"A with E", "AE", []KeyEventType{KeyEventDel}, "AE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeKeyEventFlags(tt.current, tt.eventTypes); got != tt.want {
+				t.Errorf("mergeKeyEventFlags(%q, %v) = %q, want %q", tt.current, tt.eventTypes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchKeyPatterns(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		key      string
+		want     bool
+	}{
+		{"no patterns match every keys", nil, "user::alice", true},
+		{"exact", []string{"user::alice"}, "user::alice", true},
+		{"star", []string{"user::*"}, "user::alice", true},
+		{"star match empty", []string{"user::*"}, "user::", true},
+		{"star match slash", []string{"user::*"}, "user::a/b", true},
+		{"star in the middle", []string{"user::*::level"}, "user::a/b::level", true},
+		{"many stars", []string{"**a**"}, "bab", true},
+		{"question mark", []string{"user::?"}, "user::a", true},
+		{"question mark is one byte", []string{"user::?"}, "user::ab", false},
+		{"class", []string{"user::[ab]"}, "user::b", true},
+		{"class not match", []string{"user::[ab]"}, "user::c", false},
+		{"range", []string{"user::[a-c]"}, "user::b", true},
+		{"reversed range", []string{"user::[c-a]"}, "user::b", true},
+		{"negated class", []string{"user::[^ab]"}, "user::c", true},
+		{"negated class not match", []string{"user::[^ab]"}, "user::a", false},
+		{"escaped star is literal", []string{`user::\*`}, "user::*", true},
+		{"escaped star not match", []string{`user::\*`}, "user::alice", false},
+		{"escaped bracket", []string{`user::\[a]`}, "user::[a]", true},
+		{"escaped in class", []string{`user::[\]]`}, "user::]", true},
+		{"not closed class", []string{"user::[ab"}, "user::a", true},
+		{"trailing backslash", []string{`user::\`}, `user::\`, true},
+		{"prefix only", []string{"user::"}, "user::alice", false},
+		{"any of patterns", []string{"member::*", "user::*"}, "user::alice", true},
+		{"none of patterns", []string{"member::*", "order::*"}, "user::alice", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchKeyPatterns(tt.patterns, tt.key); got != tt.want {
+				t.Errorf("matchKeyPatterns(%q, %q) = %v, want %v", tt.patterns, tt.key, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import "time"
+
+// keySchemas is the registry of every key families of this lesson
+var keySchemas = NewKeyRegistry()
+
+var (
+	// KeyMember is the hash of member data, the fields are points and level
+	KeyMember = keySchemas.Register(&KeyFamily{
+		Name:       "member",
+		Pattern:    "user::{username}",
+		ValueType:  KeyValueHash,
+		DefaultTTL: 300 * time.Second,
+		Version:    1,
+	})
+	// KeyLevels is the JSON of levels of many members, the usernames are sorted and joined by comma
+	KeyLevels = keySchemas.Register(&KeyFamily{
+		Name:       "levels",
+		Pattern:    "levels::{usernames}",
+		ValueType:  KeyValueJSON,
+		DefaultTTL: 300 * time.Second,
+		Version:    1,
+	})
+	// KeyTag is the set of keys that are set with the tag, it expire after the longest expire of its keys
+	KeyTag = keySchemas.Register(&KeyFamily{
+		Name:       "tag",
+		Pattern:    "tag::{tag}",
+		ValueType:  KeyValueSet,
+		DefaultTTL: 0,
+		Version:    1,
+	})
+	// KeyAutonumber is the running number of cacher.Autonumber
+	KeyAutonumber = keySchemas.Register(&KeyFamily{
+		Name:             "autonumber",
+		Pattern:          "autonumber_{name}",
+		ValueType:        KeyValueCounter,
+		DefaultTTL:       0,
+		EvictionCritical: true,
+		Version:          1,
+	})
+)
@@ -6,10 +6,11 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"syscall"
-	"time"
 
 	_ "github.com/3dsinteractive/wrkgo"
 )
@@ -56,7 +57,7 @@ func main() {
 		// 2. Find in redis cache
 		cacheKey := getCacheKeyForMember(username)
 		cacheField := "level"
-		cacheTimeout := 300 * time.Second
+		cacheTimeout := KeyMember.DefaultTTL
 		level = -1
 
 		cacher := ctx.Cacher(cfg.CacherConfig())
@@ -115,7 +116,9 @@ func main() {
 		ms.Log("Subscriber", "Worker clear local cache is starting")
 
 		cacher := ms.Cacher(cfg.CacherConfig())
-		onClearCache, subID, err := cacher.Sub(channelClearCache)
+		sub, err := cacher.Sub(channelClearCache, ChannelInvalidation)
+		// Or subscribe every channels that match the pattern, msg.Pattern is the matched pattern
+		// sub, err := cacher.PSub("channel::clear_*")
 		if err != nil {
 			ms.Log("Subscriber", err.Error())
 			return
@@ -126,25 +129,56 @@ func main() {
 
 		for {
 			select {
-			case msg := <-onClearCache:
+			case msg := <-sub.Messages():
 				if msg == nil {
-					// This happen when cacher close
+					// This happen when subscription or cacher close
 					return
 				}
 
-				username := msg.Payload
+				usernames := []string{}
+				if msg.Channel == ChannelInvalidation {
+					// The keys of invalidated tags, clear the local cache of member keys
+					invalidation := &Invalidation{}
+					err := msg.Decode(invalidation)
+					if err != nil {
+						ms.Log("Subscriber", err.Error())
+						continue
+					}
+					ms.Log("Subscriber", fmt.Sprintf("Invalidate tags %v keys %v", invalidation.Tags, invalidation.Keys))
+					for _, key := range invalidation.Keys {
+						if params, ok := KeyMember.Parse(key); ok {
+							usernames = append(usernames, params["username"])
+						}
+					}
+				} else {
+					usernames = append(usernames, msg.Payload)
+				}
+
+				for _, username := range usernames {
+					ms.Log("Subscriber", fmt.Sprintf("Clear cache for username %s", username))
+
+					// Delete local member level from cache
+					// when get the signal from publisher
+					levelsMutex.Lock()
+					delete(levels, username)
+					levelsMutex.Unlock()
+				}
 
-				ms.Log("Subscriber", fmt.Sprintf("Clear cache for username %s", username))
+			case _, ok := <-sub.Reconnected():
+				if !ok {
+					return
+				}
+				// The messages published while disconnected are lost,
+				// so clear every local member levels
+				ms.Log("Subscriber", "Reconnected, clear local cache")
 
-				// Delete local member level from cache
-				// when get the signal from publisher
 				levelsMutex.Lock()
-				delete(levels, username)
+				levels = map[string]int{}
 				levelsMutex.Unlock()
 
 			case <-osQuit:
-				// Unsub from channel
-				err = cacher.Unsub(subID)
+				// Close the subscription
+				err = sub.Close()
 				if err != nil {
 					ms.Log("Subscriber", err.Error())
 				}
@@ -153,7 +187,82 @@ func main() {
 		}
 	}()
 
-	// 5. API to update member level
+	// 5. Start worker to clear local cache when member cache in redis expired or evicted
+	go func() {
+
+		ms.Log("KeyEvent", "Worker clear local cache on key events is starting")
+
+		cacher := ms.Cacher(cfg.CacherConfig())
+		_, err := cacher.OnKeyEvent(
+			[]string{KeyMember.ScanPattern()},
+			[]KeyEventType{KeyEventExpired, KeyEventEvicted},
+			func(event *KeyEvent) {
+				params, ok := KeyMember.Parse(event.Key)
+				if !ok {
+					return
+				}
+				username := params["username"]
+
+				ms.Log("KeyEvent", fmt.Sprintf("Clear cache for username %s (%s)", username, event.Event))
+
+				levelsMutex.Lock()
+				delete(levels, username)
+				levelsMutex.Unlock()
+			})
+		if err != nil {
+			ms.Log("KeyEvent", err.Error())
+		}
+	}()
+
+	// 6. GET levels of many members, the result is cached with the tag of every members,
+	//    so update level of one member invalidate every results that include the member
+	ms.GET("/levels", func(ctx IContext) error {
+		usernames := strings.Split(ctx.QueryParam("u"), ",")
+		sort.Strings(usernames)
+
+		cacher := ctx.Cacher(cfg.CacherConfig())
+		cacheKey := getCacheKeyForLevels(usernames)
+		levelsJS, err := cacher.Get(cacheKey)
+		if err != nil {
+			ctx.Log(err.Error())
+		}
+
+		memberLevels := map[string]int{}
+		if len(levelsJS) > 0 {
+			err = json.Unmarshal([]byte(levelsJS), &memberLevels)
+			if err != nil {
+				ctx.Log(err.Error())
+			}
+		}
+
+		if len(memberLevels) == 0 {
+			tags := []string{}
+			for _, username := range usernames {
+				level, err := queryMemberLevel(ctx, cfg, username)
+				if err != nil {
+					ctx.Response(http.StatusInternalServerError, map[string]interface{}{"status": "error"})
+					return nil
+				}
+				memberLevels[username] = level
+				tags = append(tags, getCacheTagForMember(username))
+			}
+
+			err = cacher.SetWithTags(cacheKey, memberLevels, KeyLevels.DefaultTTL, tags...)
+			if err != nil {
+				ctx.Log(err.Error())
+			}
+		}
+
+		resp := map[string]interface{}{
+			"status": "ok",
+			"levels": memberLevels,
+		}
+		ctx.Response(http.StatusOK, resp)
+
+		return nil
+	})
+
+	// 7. API to update member level
 	ms.PUT("/member/level", func(ctx IContext) error {
 		input := ctx.ReadInput()
 		payload := map[string]interface{}{}
@@ -185,7 +294,7 @@ func main() {
 		return nil
 	})
 
-	// 5. Cleanup when exit
+	// 8. Cleanup when exit
 	defer ms.Cleanup()
 	ms.Start()
 }
@@ -249,9 +358,25 @@ func updateLevel(ctx IContext, cfg IConfig, username string, newLevel int) error
 		return err
 	}
 
+	// 4. Delete every caches that include the member (eg. GET /levels),
+	//    the invalidation is published to local caches
+	_, err = cacher.InvalidateTags(getCacheTagForMember(username))
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func getCacheKeyForMember(username string) string {
-	return fmt.Sprintf("user::%s", username)
+	return KeyMember.MustKey(username)
+}
+
+func getCacheKeyForLevels(usernames []string) string {
+	return KeyLevels.MustKey(strings.Join(usernames, ","))
+}
+
+// getCacheTagForMember is the tag of caches that include the member
+func getCacheTagForMember(username string) string {
+	return fmt.Sprintf("member:%s", username)
 }
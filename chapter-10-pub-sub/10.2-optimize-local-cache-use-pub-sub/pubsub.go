@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+// Message is the message received from the subscribed channel or pattern
+type Message struct {
+	Channel string
+	// Pattern is the matched pattern when subscribe with PSub, empty when subscribe with Sub
+	Pattern string
+	Payload string
+}
+
+// newMessage return message with the prefix of subscription removed from the channel and pattern
+func newMessage(msg *redis.Message, prefix string) *Message {
+	return &Message{
+		Channel: strings.TrimPrefix(msg.Channel, prefix),
+		Pattern: strings.TrimPrefix(msg.Pattern, escapeGlob(prefix)),
+		Payload: msg.Payload,
+	}
+}
+
+// Decode unmarshal the JSON payload into v, use this when publisher publish the JSON envelope
+func (msg *Message) Decode(v interface{}) error {
+	return json.Unmarshal([]byte(msg.Payload), v)
+}
+
+// SlowConsumerPolicy is what subscription do when the buffer of subscriber is full
+type SlowConsumerPolicy string
+
+const (
+	// SlowConsumerBlock wait until subscriber receive the message, redis might disconnect the client
+	// when the output buffer of the client exceed client-output-buffer-limit
+	SlowConsumerBlock SlowConsumerPolicy = "block"
+	// SlowConsumerDrop drop the message and count it in DroppedMessages
+	SlowConsumerDrop SlowConsumerPolicy = "drop"
+	// SlowConsumerDisconnect drop the message and close the subscription, subscriber will receive nil message
+	SlowConsumerDisconnect SlowConsumerPolicy = "disconnect"
+)
+
+// Subscription is the subscription of channels (or patterns) owned by cacher,
+// messages are forwarded from redis.PubSub to the messages channel,
+// redis.PubSub reconnect and subscribe again by itself, the forwarder detect it from the subscribe confirmations
+type Subscription struct {
+	id       string
+	mutex    sync.Mutex
+	client   *redis.Client
+	ps       *redis.PubSub
+	channels []string
+	patterns bool
+	// prefix is KeyPrefix of cacher, it is added to channels when subscribe and removed from the received messages
+	prefix      string
+	messages    chan *Message
+	reconnected chan struct{}
+	policy      SlowConsumerPolicy
+	dropped     *int64
+	done        chan struct{}
+	wg          sync.WaitGroup
+	closed      bool
+	// onSubscribe is called with the client before subscribe and after reconnect, eg. to configure the server
+	onSubscribe func(client *redis.Client)
+	// onClose is called when the subscription is closed, eg. to remove it from cacher
+	onClose func()
+}
+
+func newSubscription(channels []string, patterns bool, prefix string, settings ICacherConnectionSettings, dropped *int64) *Subscription {
+	return &Subscription{
+		id:          NewUUID(),
+		channels:    uniqueChannels(channels),
+		patterns:    patterns,
+		prefix:      prefix,
+		messages:    make(chan *Message, settings.SubBufferSize()),
+		reconnected: make(chan struct{}, 1),
+		policy:      settings.SubSlowConsumerPolicy(),
+		dropped:     dropped,
+		done:        make(chan struct{}),
+	}
+}
+
+// uniqueChannels remove duplicated channels, redis confirm the duplicated channel only once
+// and forward count the confirmations to detect reconnect
+func uniqueChannels(channels []string) []string {
+	seen := map[string]bool{}
+	unique := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		if seen[channel] {
+			continue
+		}
+		seen[channel] = true
+		unique = append(unique, channel)
+	}
+	return unique
+}
+
+// ID return the id of subscription
+func (sub *Subscription) ID() string {
+	return sub.id
+}
+
+// Channels return the subscribed channels (or patterns)
+func (sub *Subscription) Channels() []string {
+	return sub.channels
+}
+
+// prefixedChannels return the channels (or patterns) with prefix, the prefix of pattern is escaped
+func (sub *Subscription) prefixedChannels() []string {
+	if len(sub.prefix) == 0 {
+		return sub.channels
+	}
+	prefix := sub.prefix
+	if sub.patterns {
+		prefix = escapeGlob(prefix)
+	}
+	prefixed := make([]string, len(sub.channels))
+	for i, channel := range sub.channels {
+		prefixed[i] = prefix + channel
+	}
+	return prefixed
+}
+
+// Messages return the channel of messages, it is closed (receive nil message) when the subscription is closed
+func (sub *Subscription) Messages() <-chan *Message {
+	return sub.messages
+}
+
+// Reconnected return the channel that is signaled when the subscription is subscribed again after reconnect,
+// messages published while disconnected are lost, so subscriber should reload (eg. flush local cache).
+// It is never closed, so subscriber should stop when Messages() is closed
+func (sub *Subscription) Reconnected() <-chan struct{} {
+	return sub.reconnected
+}
+
+// subscribe subscribe channels on client, it is called once, redis.PubSub handle the reconnect
+func (sub *Subscription) subscribe(client *redis.Client) {
+	sub.mutex.Lock()
+	defer sub.mutex.Unlock()
+
+	if sub.closed || sub.ps != nil {
+		return
+	}
+
+	if sub.onSubscribe != nil {
+		sub.onSubscribe(client)
+	}
+
+	var ps *redis.PubSub
+	if sub.patterns {
+		ps = client.PSubscribe(context.Background(), sub.prefixedChannels()...)
+	} else {
+		ps = client.Subscribe(context.Background(), sub.prefixedChannels()...)
+	}
+	sub.client = client
+	sub.ps = ps
+
+	sub.wg.Add(1)
+	go sub.forward(ps)
+}
+
+// forward forward messages from ps to subscriber and signal Reconnected when ps subscribe again
+func (sub *Subscription) forward(ps *redis.PubSub) {
+	defer sub.wg.Done()
+	confirmed := 0
+	for received := range ps.ChannelWithSubscriptions(context.Background(), cap(sub.messages)) {
+		switch msg := received.(type) {
+		case *redis.Subscription:
+			if msg.Kind != "subscribe" && msg.Kind != "psubscribe" {
+				continue
+			}
+			// redis.PubSub subscribe again by itself when the connection is broken,
+			// so every channels are confirmed again after the first time
+			confirmed++
+			if confirmed%len(sub.channels) == 0 && confirmed > len(sub.channels) {
+				// The server might be restarted, so configure it again,
+				// it run in the receive loop without any lock held
+				if sub.onSubscribe != nil {
+					sub.onSubscribe(sub.client)
+				}
+				sub.notifyReconnected()
+			}
+		case *redis.Message:
+			if !sub.deliver(newMessage(msg, sub.prefix)) {
+				return
+			}
+		}
+	}
+}
+
+// deliver send message to subscriber by slow consumer policy, return false if forwarder should stop
+func (sub *Subscription) deliver(message *Message) bool {
+	if sub.policy == SlowConsumerBlock {
+		select {
+		case sub.messages <- message:
+			return true
+		case <-sub.done:
+			return false
+		}
+	}
+
+	select {
+	case sub.messages <- message:
+		return true
+	case <-sub.done:
+		return false
+	default:
+		atomic.AddInt64(sub.dropped, 1)
+		if sub.policy == SlowConsumerDisconnect {
+			fmt.Println("cacher: subscriber is too slow, close subscription of", strings.Join(sub.channels, ","))
+			// Close wait for this forwarder to stop, so it must run in another goroutine
+			go sub.Close()
+			return false
+		}
+		return true
+	}
+}
+
+func (sub *Subscription) notifyReconnected() {
+	// Subscriber only need to know that it is reconnected, so the signals are merged
+	select {
+	case sub.reconnected <- struct{}{}:
+	default:
+	}
+}
+
+// Close unsubscribe channels and close messages channel, subscriber will receive nil message
+func (sub *Subscription) Close() error {
+	sub.mutex.Lock()
+	if sub.closed {
+		sub.mutex.Unlock()
+		return nil
+	}
+	sub.closed = true
+	close(sub.done)
+
+	var err error
+	if sub.ps != nil {
+		if sub.patterns {
+			err = sub.ps.PUnsubscribe(context.Background(), sub.prefixedChannels()...)
+		} else {
+			err = sub.ps.Unsubscribe(context.Background(), sub.prefixedChannels()...)
+		}
+		if err != nil {
+			fmt.Println("cacher:", err.Error())
+		}
+		err = sub.ps.Close()
+	}
+	sub.mutex.Unlock()
+
+	// Wait every forwarders to stop before close the messages channel,
+	// reconnected is not closed, the closed channel would be ready forever in select of subscriber
+	sub.wg.Wait()
+	close(sub.messages)
+
+	if sub.onClose != nil {
+		sub.onClose()
+	}
+	return err
+}
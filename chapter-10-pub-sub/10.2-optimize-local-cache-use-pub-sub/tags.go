@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+// ChannelInvalidation is the channel that InvalidateTags publish the Invalidation to, local caches subscribe it
+const ChannelInvalidation = "channel::invalidation"
+
+// Invalidation is the message of ChannelInvalidation, decode it with msg.Decode(&invalidation)
+type Invalidation struct {
+	Tags []string `json:"tags"`
+	Keys []string `json:"keys"`
+}
+
+// tagKey return the key of set that keep the keys of tag
+func tagKey(tag string) string {
+	return KeyTag.MustKey(tag)
+}
+
+// setWithTagsScript set the value and add the key to the tag sets,
+// the tag set is expired after the longest expire of its keys, so it is never expired before its keys
+// KEYS[1] is the key, KEYS[2..] are the tag sets, ARGV[1] is the value, ARGV[2] is expire in ms (0 is no expire)
+var setWithTagsScript = redis.NewScript(`
+local expire = tonumber(ARGV[2])
+if expire > 0 then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', expire)
+else
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+for i = 2, #KEYS do
+	local existed = redis.call('EXISTS', KEYS[i])
+	redis.call('SADD', KEYS[i], KEYS[1])
+	if expire <= 0 then
+		redis.call('PERSIST', KEYS[i])
+	else
+		local ttl = redis.call('PTTL', KEYS[i])
+		if existed == 0 or (ttl >= 0 and ttl < expire) then
+			redis.call('PEXPIRE', KEYS[i], expire)
+		end
+	end
+end
+return 1
+`)
+
+// invalidateTagsScript delete the keys of the tag sets and remove them from the tag sets, return the number of deleted keys,
+// the keys are resolved by SMEMBERS before, so every keys are declared in KEYS.
+// The keys that are added to the tag sets after SMEMBERS are kept, so they are deleted by the next invalidation
+// KEYS[1..ARGV[1]] are the tag sets, the other KEYS are the keys of tag sets
+var invalidateTagsScript = redis.NewScript(`
+local numTags = tonumber(ARGV[1])
+local deleted = 0
+for i = numTags + 1, #KEYS do
+	deleted = deleted + redis.call('DEL', KEYS[i])
+	for j = 1, numTags do
+		redis.call('SREM', KEYS[j], KEYS[i])
+	end
+end
+return deleted
+`)
+
+// tagPruneSample is the number of random members of tag set that are checked by SetWithTags,
+// the members whose keys no longer exist (expired or evicted) are removed, so the tag set does not grow forever
+const tagPruneSample = 10
+
+// SetWithTags set value with expire and add key to the tags, so InvalidateTags(tag) delete the key,
+// the value is stored as is if it is string, otherwise it is JSON
+func (cache *Cacher) SetWithTags(key string, value interface{}, expire time.Duration, tags ...string) error {
+
+	c, err := cache.getClient()
+	if err != nil {
+		return err
+	}
+
+	str, ok := value.(string)
+	if !ok {
+		b, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		str = string(b)
+	}
+
+	keys := []string{key}
+	for _, tag := range tags {
+		keys = append(keys, tagKey(tag))
+	}
+
+	err = setWithTagsScript.Run(context.Background(), c, keys, str, expire.Milliseconds()).Err()
+	if err != nil {
+		return err
+	}
+
+	// The tag set is not important enough to fail SetWithTags, so the error of pruning is only printed
+	err = cache.pruneTags(c, keys[1:])
+	if err != nil {
+		fmt.Println("cacher: prune tags", err.Error())
+	}
+	return nil
+}
+
+// pruneTags remove the members of tag sets whose keys no longer exist, it check tagPruneSample random members
+// of each tag set, so every SetWithTags clean the tag sets a little and the members are checked in the end
+func (cache *Cacher) pruneTags(c *redis.Client, tagKeys []string) error {
+	ctx := context.Background()
+
+	samples := make([]*redis.StringSliceCmd, len(tagKeys))
+	_, err := c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, tagKey := range tagKeys {
+			samples[i] = pipe.SRandMemberN(ctx, tagKey, tagPruneSample)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	// The members are the keys with KeyPrefix, EXISTS need the key without prefix because the hook add it
+	exists := make([][]*redis.IntCmd, len(tagKeys))
+	_, err = c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i := range tagKeys {
+			for _, member := range samples[i].Val() {
+				exists[i] = append(exists[i], pipe.Exists(ctx, cache.unprefixKey(member)))
+			}
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	_, err = c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, tagKey := range tagKeys {
+			members := samples[i].Val()
+			for j, cmd := range exists[i] {
+				if cmd.Val() == 0 {
+					// SREM of the last member delete the tag set
+					pipe.SRem(ctx, tagKey, members[j])
+				}
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// InvalidateTags delete every keys of tags and publish Invalidation to ChannelInvalidation,
+// so the local caches can delete the keys, return the deleted keys
+func (cache *Cacher) InvalidateTags(tags ...string) ([]string, error) {
+	if len(tags) == 0 {
+		return []string{}, nil
+	}
+
+	c, err := cache.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	tagKeys := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tagKeys = append(tagKeys, tagKey(tag))
+	}
+
+	// Resolve the keys of tag sets first, so the script declare every keys that it delete
+	members := make([]*redis.StringSliceCmd, len(tagKeys))
+	_, err = c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, tagKey := range tagKeys {
+			members[i] = pipe.SMembers(ctx, tagKey)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	// The key can be in many tags, so remove the duplicated keys,
+	// the members of tag sets are the keys with KeyPrefix, so the prefix is removed
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, cmd := range members {
+		for _, member := range cmd.Val() {
+			key := cache.unprefixKey(member)
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	if len(keys) > 0 {
+		scriptKeys := append(append([]string{}, tagKeys...), keys...)
+		err = invalidateTagsScript.Run(ctx, c, scriptKeys, len(tagKeys)).Err()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+	}
+
+	msg, err := json.Marshal(&Invalidation{Tags: tags, Keys: keys})
+	if err != nil {
+		return nil, err
+	}
+	err = cache.Pub(ChannelInvalidation, string(msg))
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}